@@ -28,7 +28,10 @@ Examples:
   mock-todo-server export memory
 
   # Export memory state to specific file
-  mock-todo-server export memory backup.json`,
+  mock-todo-server export memory backup.json
+
+  # Export memory state as a SQLite database (.db, .sqlite or .sqlite3)
+  mock-todo-server export memory backup.db`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := export.GetOutputPath(args, export.DefaultMemoryFile)
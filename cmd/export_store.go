@@ -27,7 +27,10 @@ Examples:
   mock-todo-server export store
 
   # Export template to specific file
-  mock-todo-server export store /path/to/template.json`,
+  mock-todo-server export store /path/to/template.json
+
+  # Export template as a SQLite database for the server's --sqlite-path flag
+  mock-todo-server export store data.db`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := export.GetOutputPath(args, export.DefaultStoreFile)
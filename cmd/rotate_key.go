@@ -0,0 +1,33 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/spf13/cobra"
+)
+
+// rotateKeyCmd represents the rotate-key command
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Rotate the JWT signing key of the running server",
+	Long: `Generate a new signing key on the running server and use it for new tokens.
+Tokens signed with the previous key stay valid for the grace period set with
+--jwt-key-grace-period, and both keys are published in the JWK Set meanwhile.
+Only available when the server runs with --jwt-key-mode rsa, ecdsa or ed25519.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		kid, err := server.RotateKey()
+		if err != nil {
+			log.Fatal("Failed to rotate key:", err)
+		}
+		fmt.Println("Active signing key:", kid)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateKeyCmd)
+}
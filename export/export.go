@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/KasumiMercury/mock-todo-server/pid"
 	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
 	"golang.org/x/crypto/bcrypt"
 	"io"
 	"log"
@@ -51,6 +52,8 @@ func getServerPort() int {
 type FileData struct {
 	Tasks []*domain.Task        `json:"tasks"`
 	Users []*domain.UserStorage `json:"users"`
+	// Clients are the OIDC clients registered at runtime
+	Clients []*domain.Client `json:"clients,omitempty"`
 }
 
 // ExportWithMode exports data based on the specified mode and file path.
@@ -88,33 +91,48 @@ func GetOutputPath(args []string, defaultFilename string) string {
 	return defaultFilename
 }
 
-func Store(filePath string) error {
+// SampleData returns the sample users and tasks used by the store template.
+// The users log in with password1 and password2.
+func SampleData() (*FileData, error) {
 	now := time.Now()
 
 	// Create hashed passwords for template users
 	hashedPassword1, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("failed to hash password for user1: %w", err)
+		return nil, fmt.Errorf("failed to hash password for user1: %w", err)
 	}
 
 	hashedPassword2, err := bcrypt.GenerateFromPassword([]byte("password2"), bcrypt.DefaultCost)
 	if err != nil {
-		return fmt.Errorf("failed to hash password for user2: %w", err)
+		return nil, fmt.Errorf("failed to hash password for user2: %w", err)
 	}
 
-	sampleData := FileData{
+	dueDate := now.Add(7 * 24 * time.Hour).UTC().Format(time.RFC3339)
+
+	return &FileData{
 		Tasks: []*domain.Task{
 			{
-				ID:        1,
-				Title:     "Sample Task 1",
-				UserID:    1,
-				CreatedAt: now.Format(time.RFC3339),
+				ID:          1,
+				Title:       "Sample Task 1",
+				Description: "A sample task with a due date",
+				Completed:   false,
+				DueDate:     &dueDate,
+				Priority:    domain.PriorityHigh,
+				Tags:        []string{"work"},
+				UserID:      1,
+				CreatedAt:   now.Format(time.RFC3339),
+				UpdatedAt:   now.Format(time.RFC3339),
 			},
 			{
-				ID:        2,
-				Title:     "Sample Task 2",
-				UserID:    2,
-				CreatedAt: now.Add(time.Minute).Format(time.RFC3339),
+				ID:          2,
+				Title:       "Sample Task 2",
+				Description: "A completed sample task",
+				Completed:   true,
+				Priority:    domain.PriorityLow,
+				Tags:        []string{},
+				UserID:      2,
+				CreatedAt:   now.Add(time.Minute).Format(time.RFC3339),
+				UpdatedAt:   now.Add(time.Minute).Format(time.RFC3339),
 			},
 		},
 		Users: []*domain.UserStorage{
@@ -123,6 +141,10 @@ func Store(filePath string) error {
 				Username:       "user1",
 				HashedPassword: string(hashedPassword1),
 				CreatedAt:      now,
+				Profile: domain.Profile{
+					Email:         "user1@example.com",
+					EmailVerified: true,
+				},
 			},
 			{
 				ID:             2,
@@ -131,22 +153,36 @@ func Store(filePath string) error {
 				CreatedAt:      now.Add(time.Minute),
 			},
 		},
-	}
+	}, nil
+}
 
-	data, err := json.MarshalIndent(sampleData, "", "  ")
+func Store(filePath string) error {
+	sampleData, err := SampleData()
 	if err != nil {
-		return fmt.Errorf("failed to marshal template data: %w", err)
+		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
+	if store.IsSQLitePath(filePath) {
+		if err := writeSQLite(sampleData, filePath); err != nil {
+			return fmt.Errorf("failed to write template database: %w", err)
+		}
+		log.Println("Template database created at:", filePath)
+	} else {
+		data, err := json.MarshalIndent(sampleData, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal template data: %w", err)
+		}
 
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write template file: %w", err)
-	}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write template file: %w", err)
+		}
 
-	log.Println("Template file created at:", filePath)
+		log.Println("Template file created at:", filePath)
+	}
 	log.Println("Template includes 2 users:")
 	log.Println("  - user1 (password: password1)")
 	log.Println("  - user2 (password: password2)")
@@ -222,6 +258,14 @@ func getMemoryStateDirectly() (*FileData, error) {
 }
 
 func saveMemoryStateToFile(data *FileData, filePath string) error {
+	if store.IsSQLitePath(filePath) {
+		if err := writeSQLite(data, filePath); err != nil {
+			return fmt.Errorf("failed to write memory state database: %w", err)
+		}
+		log.Println("Memory state database exported to:", filePath)
+		return nil
+	}
+
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal memory state data: %w", err)
@@ -239,20 +283,52 @@ func saveMemoryStateToFile(data *FileData, filePath string) error {
 	return nil
 }
 
+// writeSQLite replaces the contents of a SQLite database with data
+func writeSQLite(data *FileData, filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	users := make([]*domain.User, 0, len(data.Users))
+	for _, userStorage := range data.Users {
+		users = append(users, userStorage.ToUser())
+	}
+
+	return store.WriteSQLite(filePath, data.Tasks, users, data.Clients)
+}
+
 // OidcTemplate exports an OIDC configuration template
 func OidcTemplate(filePath string) error {
 	oidcTemplate := map[string]interface{}{
-		"client_id":     "mock-client-id-12345",
-		"client_secret": "mock-client-secret-67890",
-		"redirect_uris": []string{
-			"http://localhost:3000/callback",
-			"http://localhost:3000/auth/callback",
-			"https://your-app.example.com/callback",
-		},
 		"issuer": "http://localhost:8080",
 		"scopes": []string{
 			"openid",
 			"profile",
+			"email",
+		},
+		"clients": []map[string]interface{}{
+			{
+				"client_id":     "mock-client-id-12345",
+				"client_secret": "mock-client-secret-67890",
+				"redirect_uris": []string{
+					"http://localhost:3000/callback",
+					"http://localhost:3000/auth/callback",
+					"https://your-app.example.com/callback",
+				},
+				"post_logout_redirect_uris": []string{
+					"http://localhost:3000",
+				},
+			},
+			{
+				// Public client without a secret, which must use PKCE
+				"client_id": "mock-mobile-client",
+				"redirect_uris": []string{
+					"com.example.app:/callback",
+				},
+				"scopes":           []string{"openid"},
+				"access_token_ttl": 900,
+				"require_consent":  true,
+			},
 		},
 	}
 
@@ -2,8 +2,13 @@ package flagmanager
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/fault"
 	"github.com/spf13/cobra"
 )
 
@@ -29,11 +34,29 @@ type FlagDef struct {
 type ServeFlagConfig struct {
 	Port           int
 	JsonFilePath   string
+	SQLitePath     string
+	WatchFile      bool
 	JWTKeyModeStr  string
+	JWTAlgorithm   string
 	JWTSecretKey   string
+	JWTKeyDir      string
 	AuthRequired   bool
 	AuthModeStr    string
 	OIDCConfigPath string
+
+	JWTKeyGracePeriod int
+	AccessTokenTTL    int
+	RefreshTokenTTL   int
+
+	FaultLatencyMs     int
+	FaultJitterMs      int
+	FaultErrorRate     int
+	FaultErrorStatuses string
+	FaultResetRate     int
+	FaultTruncateRate  int
+	FaultMethods       string
+	FaultRoutes        string
+	FaultSeed          int
 }
 
 // flagDefinitions holds all flag metadata for the serve command
@@ -54,14 +77,38 @@ var flagDefinitions = []FlagDef{
 		DefaultVal:  "",
 		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JsonFilePath },
 	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "sqlite-path",
+		ShortName:   "",
+		Description: "SQLite database file as a data source (created if missing)",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.SQLitePath },
+	},
+	{
+		FlagType:    FlagTypeBool,
+		Name:        "watch-file",
+		ShortName:   "",
+		Description: "Reload the JSON data file as soon as it is edited while the server is running (without it, edits are picked up by the next write)",
+		DefaultVal:  true,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.WatchFile },
+	},
 	{
 		FlagType:    FlagTypeString,
 		Name:        "jwt-key-mode",
 		ShortName:   "",
-		Description: "JWT key mode: 'secret' or 'rsa'",
+		Description: "JWT key mode: 'secret', 'rsa', 'ecdsa' or 'ed25519'",
 		DefaultVal:  "secret",
 		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JWTKeyModeStr },
 	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "jwt-algorithm",
+		ShortName:   "",
+		Description: "JWT signing algorithm: HS256/384/512 (secret), RS256/384/512 or PS256/384/512 (rsa), ES256/384/512 (ecdsa), EdDSA (ed25519). Defaults to the first of the key mode",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JWTAlgorithm },
+	},
 	{
 		FlagType:    FlagTypeString,
 		Name:        "jwt-secret",
@@ -70,6 +117,22 @@ var flagDefinitions = []FlagDef{
 		DefaultVal:  "test-secret-key",
 		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JWTSecretKey },
 	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "jwt-key-dir",
+		ShortName:   "",
+		Description: "Directory to load signing keys from and persist generated keys to (used with the 'rsa', 'ecdsa' and 'ed25519' key modes)",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JWTKeyDir },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "jwt-key-grace-period",
+		ShortName:   "",
+		Description: "Seconds a rotated out signing key keeps verifying tokens",
+		DefaultVal:  int(auth.DefaultKeyGracePeriod.Seconds()),
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.JWTKeyGracePeriod },
+	},
 	{
 		FlagType:    FlagTypeBool,
 		Name:        "auth-required",
@@ -94,6 +157,94 @@ var flagDefinitions = []FlagDef{
 		DefaultVal:  "",
 		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.OIDCConfigPath },
 	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "access-token-ttl",
+		ShortName:   "",
+		Description: "Lifetime of access tokens in seconds",
+		DefaultVal:  int(auth.DefaultAccessTokenTTL.Seconds()),
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.AccessTokenTTL },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "refresh-token-ttl",
+		ShortName:   "",
+		Description: "Lifetime of refresh tokens in seconds",
+		DefaultVal:  int(auth.DefaultRefreshTokenTTL.Seconds()),
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.RefreshTokenTTL },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-latency-ms",
+		ShortName:   "",
+		Description: "Fixed latency added to responses in milliseconds",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultLatencyMs },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-jitter-ms",
+		ShortName:   "",
+		Description: "Random latency of up to this many milliseconds added to responses",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultJitterMs },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-error-rate",
+		ShortName:   "",
+		Description: "Percentage of requests answered with an injected error status",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultErrorRate },
+	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "fault-error-statuses",
+		ShortName:   "",
+		Description: "Comma-separated status codes (5xx or 429) for injected errors (default 500)",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultErrorStatuses },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-reset-rate",
+		ShortName:   "",
+		Description: "Percentage of requests whose connection is reset",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultResetRate },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-truncate-rate",
+		ShortName:   "",
+		Description: "Percentage of responses whose body is truncated",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultTruncateRate },
+	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "fault-methods",
+		ShortName:   "",
+		Description: "Comma-separated HTTP methods faults apply to (default all)",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultMethods },
+	},
+	{
+		FlagType:    FlagTypeString,
+		Name:        "fault-routes",
+		ShortName:   "",
+		Description: "Comma-separated routes faults apply to, e.g. 'POST /tasks,/tasks/:id' (default all)",
+		DefaultVal:  "",
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultRoutes },
+	},
+	{
+		FlagType:    FlagTypeInt,
+		Name:        "fault-seed",
+		ShortName:   "",
+		Description: "Seed for reproducible fault injection (0 uses a random seed)",
+		DefaultVal:  0,
+		BindFunc:    func(c *ServeFlagConfig) interface{} { return &c.FaultSeed },
+	},
 }
 
 // NewServeFlagConfig creates a new ServeFlagConfig with default values
@@ -153,15 +304,32 @@ func (c *ServeFlagConfig) ToServerConfig() (*server.Config, error) {
 	config := server.NewServerConfig()
 	config.Port = c.Port
 	config.JsonFilePath = c.JsonFilePath
+	config.SQLitePath = c.SQLitePath
+	config.WatchFile = c.WatchFile
+	config.JWTAlgorithm = c.JWTAlgorithm
 	config.JWTSecretKey = c.JWTSecretKey
+	config.JWTKeyDir = c.JWTKeyDir
 	config.AuthRequired = c.AuthRequired
 	config.OIDCConfigPath = c.OIDCConfigPath
 
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL <= 0 || c.JWTKeyGracePeriod <= 0 {
+		return nil, fmt.Errorf("access-token-ttl, refresh-token-ttl and jwt-key-grace-period must be positive")
+	}
+	config.JWTKeyGracePeriod = time.Duration(c.JWTKeyGracePeriod) * time.Second
+	config.AccessTokenTTL = time.Duration(c.AccessTokenTTL) * time.Second
+	config.RefreshTokenTTL = time.Duration(c.RefreshTokenTTL) * time.Second
+
 	// Validate and convert enum fields
 	if err := config.ValidateEnumFields(c.JWTKeyModeStr, c.AuthModeStr); err != nil {
 		return nil, err
 	}
 
+	faults, err := c.faultConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Faults = faults
+
 	return config, nil
 }
 
@@ -169,14 +337,93 @@ func (c *ServeFlagConfig) ToServerConfig() (*server.Config, error) {
 func (c *ServeFlagConfig) FromServerConfig(config *server.Config) {
 	c.Port = config.Port
 	c.JsonFilePath = config.JsonFilePath
+	c.SQLitePath = config.SQLitePath
+	c.WatchFile = config.WatchFile
+	c.JWTAlgorithm = config.JWTAlgorithm
 	c.JWTSecretKey = config.JWTSecretKey
+	c.JWTKeyDir = config.JWTKeyDir
 	c.AuthRequired = config.AuthRequired
 	c.OIDCConfigPath = config.OIDCConfigPath
+	// A zero lifetime means the default, which the flags cannot express otherwise
+	if config.JWTKeyGracePeriod > 0 {
+		c.JWTKeyGracePeriod = int(config.JWTKeyGracePeriod.Seconds())
+	}
+	if config.AccessTokenTTL > 0 {
+		c.AccessTokenTTL = int(config.AccessTokenTTL.Seconds())
+	}
+	if config.RefreshTokenTTL > 0 {
+		c.RefreshTokenTTL = int(config.RefreshTokenTTL.Seconds())
+	}
 
 	// Convert enum fields to strings
 	enumStrings := config.ToFlagsString()
 	c.JWTKeyModeStr = enumStrings["jwt-key-mode"]
 	c.AuthModeStr = enumStrings["auth-mode"]
+
+	// Flags can only express a single fault rule
+	c.FaultSeed = int(config.Faults.Seed)
+	if len(config.Faults.Rules) > 0 {
+		rule := config.Faults.Rules[0]
+		c.FaultLatencyMs = rule.LatencyMs
+		c.FaultJitterMs = rule.JitterMs
+		c.FaultErrorRate = int(rule.ErrorRate)
+		c.FaultResetRate = int(rule.ResetRate)
+		c.FaultTruncateRate = int(rule.TruncateRate)
+		c.FaultMethods = strings.Join(rule.Methods, ",")
+		c.FaultRoutes = strings.Join(rule.Routes, ",")
+
+		statuses := make([]string, 0, len(rule.ErrorStatuses))
+		for _, status := range rule.ErrorStatuses {
+			statuses = append(statuses, strconv.Itoa(status))
+		}
+		c.FaultErrorStatuses = strings.Join(statuses, ",")
+	}
+}
+
+// faultConfig builds the fault injection config from the fault flags
+func (c *ServeFlagConfig) faultConfig() (fault.Config, error) {
+	config := fault.Config{Seed: int64(c.FaultSeed)}
+
+	if c.FaultLatencyMs == 0 && c.FaultJitterMs == 0 && c.FaultErrorRate == 0 &&
+		c.FaultResetRate == 0 && c.FaultTruncateRate == 0 {
+		return config, nil
+	}
+
+	rule := fault.Rule{
+		Methods:      splitList(c.FaultMethods),
+		Routes:       splitList(c.FaultRoutes),
+		LatencyMs:    c.FaultLatencyMs,
+		JitterMs:     c.FaultJitterMs,
+		ErrorRate:    float64(c.FaultErrorRate),
+		ResetRate:    float64(c.FaultResetRate),
+		TruncateRate: float64(c.FaultTruncateRate),
+	}
+
+	for _, value := range splitList(c.FaultErrorStatuses) {
+		status, err := strconv.Atoi(value)
+		if err != nil {
+			return fault.Config{}, fmt.Errorf("invalid fault-error-statuses: %s", value)
+		}
+		rule.ErrorStatuses = append(rule.ErrorStatuses, status)
+	}
+
+	config.Rules = []fault.Rule{rule}
+	if err := config.Validate(); err != nil {
+		return fault.Config{}, fmt.Errorf("invalid fault flags: %w", err)
+	}
+
+	return config, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // ReconstructFlags returns the command line flags equivalent to this config
@@ -1,9 +1,12 @@
 package flagmanager
 
 import (
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
 	"github.com/spf13/cobra"
 )
 
@@ -35,7 +38,7 @@ func TestRegisterFlags(t *testing.T) {
 	config.RegisterFlags(cmd)
 
 	// Check that expected flags were registered
-	expectedFlags := []string{"port", "json-file-path", "jwt-key-mode", "jwt-secret", "auth-required", "auth-mode", "oidc-config-path"}
+	expectedFlags := []string{"port", "json-file-path", "sqlite-path", "watch-file", "jwt-key-mode", "jwt-algorithm", "jwt-secret", "jwt-key-dir", "auth-required", "auth-mode", "oidc-config-path"}
 	for _, flagName := range expectedFlags {
 		if flag := cmd.Flags().Lookup(flagName); flag == nil {
 			t.Errorf("Expected flag %s was not registered", flagName)
@@ -349,3 +352,103 @@ func TestReconstructFlagsShortVsLong(t *testing.T) {
 		}
 	}
 }
+
+func TestToServerConfigFaults(t *testing.T) {
+	flagConfig := NewServeFlagConfig()
+
+	serverConfig, err := flagConfig.ToServerConfig()
+	if err != nil {
+		t.Fatalf("ToServerConfig failed: %v", err)
+	}
+	if serverConfig.Faults.Enabled() {
+		t.Errorf("Expected faults to be disabled by default, got %+v", serverConfig.Faults)
+	}
+
+	flagConfig.FaultErrorRate = 25
+	flagConfig.FaultErrorStatuses = "503, 429"
+	flagConfig.FaultRoutes = "POST /tasks,/tasks/:id"
+	flagConfig.FaultSeed = 42
+
+	serverConfig, err = flagConfig.ToServerConfig()
+	if err != nil {
+		t.Fatalf("ToServerConfig failed: %v", err)
+	}
+
+	if serverConfig.Faults.Seed != 42 {
+		t.Errorf("Expected fault seed to be 42, got %d", serverConfig.Faults.Seed)
+	}
+	if len(serverConfig.Faults.Rules) != 1 {
+		t.Fatalf("Expected a single fault rule, got %d", len(serverConfig.Faults.Rules))
+	}
+
+	rule := serverConfig.Faults.Rules[0]
+	if rule.ErrorRate != 25 {
+		t.Errorf("Expected error rate to be 25, got %v", rule.ErrorRate)
+	}
+	if len(rule.ErrorStatuses) != 2 || rule.ErrorStatuses[0] != 503 || rule.ErrorStatuses[1] != 429 {
+		t.Errorf("Expected error statuses [503 429], got %v", rule.ErrorStatuses)
+	}
+	if len(rule.Routes) != 2 || rule.Routes[0] != "POST /tasks" || rule.Routes[1] != "/tasks/:id" {
+		t.Errorf("Expected routes [POST /tasks /tasks/:id], got %v", rule.Routes)
+	}
+
+	flagConfig.FaultErrorStatuses = "404"
+	if _, err := flagConfig.ToServerConfig(); err == nil {
+		t.Error("Expected an error for a non-5xx fault status")
+	}
+}
+
+func TestToServerConfigTokenLifetimes(t *testing.T) {
+	flagConfig := NewServeFlagConfig()
+	flagConfig.AccessTokenTTL = 5
+	flagConfig.RefreshTokenTTL = 60
+
+	serverConfig, err := flagConfig.ToServerConfig()
+	if err != nil {
+		t.Fatalf("ToServerConfig failed: %v", err)
+	}
+	if serverConfig.AccessTokenTTL != 5*time.Second {
+		t.Errorf("Expected access token TTL to be 5s, got %v", serverConfig.AccessTokenTTL)
+	}
+	if serverConfig.RefreshTokenTTL != time.Minute {
+		t.Errorf("Expected refresh token TTL to be 1m, got %v", serverConfig.RefreshTokenTTL)
+	}
+
+	flags := flagConfig.ReconstructFlags()
+	if !slices.Contains(flags, "--access-token-ttl") || !slices.Contains(flags, "--refresh-token-ttl") {
+		t.Errorf("Expected token lifetime flags in reconstructed flags: %v", flags)
+	}
+
+	flagConfig.AccessTokenTTL = 0
+	if _, err := flagConfig.ToServerConfig(); err == nil {
+		t.Error("Expected an error for a zero access token TTL")
+	}
+}
+
+func TestToServerConfigJWTAlgorithm(t *testing.T) {
+	flagConfig := NewServeFlagConfig()
+	flagConfig.JWTKeyModeStr = "ecdsa"
+	flagConfig.JWTAlgorithm = "ES384"
+
+	serverConfig, err := flagConfig.ToServerConfig()
+	if err != nil {
+		t.Fatalf("ToServerConfig failed: %v", err)
+	}
+	if serverConfig.JWTKeyMode != auth.JWTKeyModeECDSA || serverConfig.JWTAlgorithm != "ES384" {
+		t.Errorf("Expected ecdsa with ES384, got %s with %s", serverConfig.JWTKeyMode, serverConfig.JWTAlgorithm)
+	}
+	if err := serverConfig.Validate(); err != nil {
+		t.Errorf("Expected ES384 to be valid with ecdsa keys: %v", err)
+	}
+
+	reconstructed := NewServeFlagConfig()
+	reconstructed.FromServerConfig(serverConfig)
+	if reconstructed.JWTKeyModeStr != "ecdsa" || reconstructed.JWTAlgorithm != "ES384" {
+		t.Errorf("Expected ecdsa with ES384 after round trip, got %s with %s", reconstructed.JWTKeyModeStr, reconstructed.JWTAlgorithm)
+	}
+
+	serverConfig.JWTAlgorithm = "RS256"
+	if err := serverConfig.Validate(); err == nil {
+		t.Error("Expected an error for an RSA algorithm with ecdsa keys")
+	}
+}
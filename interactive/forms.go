@@ -111,6 +111,8 @@ func createJWTModeSelector() auth.JWTKeyMode {
 		Options(
 			huh.NewOption("Secret Key", auth.JWTKeyModeSecret),
 			huh.NewOption("RSA Key", auth.JWTKeyModeRSA),
+			huh.NewOption("ECDSA Key", auth.JWTKeyModeECDSA),
+			huh.NewOption("Ed25519 Key", auth.JWTKeyModeEd25519),
 		).
 		Value(&jwtKeyMode)
 
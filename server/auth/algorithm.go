@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// algorithmsByMode lists the signing algorithms of each key mode, the first one is the default
+var algorithmsByMode = map[JWTKeyMode][]string{
+	JWTKeyModeSecret:  {"HS256", "HS384", "HS512"},
+	JWTKeyModeRSA:     {"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"},
+	JWTKeyModeECDSA:   {"ES256", "ES384", "ES512"},
+	JWTKeyModeEd25519: {"EdDSA"},
+}
+
+// ResolveAlgorithm returns the signing algorithm for a key mode. An empty algorithm
+// selects the default of the mode.
+func ResolveAlgorithm(keyMode JWTKeyMode, algorithm string) (string, error) {
+	algorithms, ok := algorithmsByMode[keyMode]
+	if !ok {
+		return "", fmt.Errorf("unsupported key mode: %s", keyMode)
+	}
+
+	if algorithm == "" {
+		return algorithms[0], nil
+	}
+	if !slices.Contains(algorithms, algorithm) {
+		return "", fmt.Errorf("jwt-algorithm %s cannot be used with jwt-key-mode %s (must be one of %s)",
+			algorithm, keyMode, strings.Join(algorithms, ", "))
+	}
+	return algorithm, nil
+}
+
+// IsAsymmetric reports whether the key mode signs with a private key and publishes a JWK Set
+func (m JWTKeyMode) IsAsymmetric() bool {
+	return m == JWTKeyModeRSA || m == JWTKeyModeECDSA || m == JWTKeyModeEd25519
+}
+
+// curveForAlgorithm returns the curve an ECDSA algorithm requires
+func curveForAlgorithm(algorithm string) elliptic.Curve {
+	switch algorithm {
+	case "ES384":
+		return elliptic.P384()
+	case "ES512":
+		return elliptic.P521()
+	default:
+		return elliptic.P256()
+	}
+}
+
+// checkKeyType verifies that a key can sign with the given algorithm
+func checkKeyType(algorithm string, key crypto.Signer) error {
+	method := jwt.GetSigningMethod(algorithm)
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			return nil
+		}
+		return fmt.Errorf("%s requires an RSA key, got %s", algorithm, keyTypeName(key))
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if ok && ecKey.Curve == curveForAlgorithm(algorithm) {
+			return nil
+		}
+		return fmt.Errorf("%s requires an EC %s key, got %s", algorithm, curveForAlgorithm(algorithm).Params().Name, keyTypeName(key))
+	case *jwt.SigningMethodEd25519:
+		if _, ok := key.(ed25519.PrivateKey); ok {
+			return nil
+		}
+		return fmt.Errorf("%s requires an Ed25519 key, got %s", algorithm, keyTypeName(key))
+	default:
+		return fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// tokenHash computes the at_hash and c_hash claims: the left half of the hash of value, with
+// the hash function of the signing algorithm (OpenID Connect Core section 3.1.3.6)
+func tokenHash(algorithm, value string) string {
+	var h hash.Hash
+	switch {
+	case strings.HasSuffix(algorithm, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(algorithm, "512"), algorithm == "EdDSA":
+		// Ed25519 hashes with SHA-512
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+func keyTypeName(key crypto.Signer) string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "an RSA key"
+	case *ecdsa.PrivateKey:
+		return "an EC " + k.Curve.Params().Name + " key"
+	case ed25519.PrivateKey:
+		return "an Ed25519 key"
+	default:
+		return fmt.Sprintf("a %T", key)
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client authentication methods of the token, introspection and revocation endpoints
+const (
+	ClientAuthMethodSecretBasic   = "client_secret_basic"
+	ClientAuthMethodSecretPost    = "client_secret_post"
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+	ClientAuthMethodNone          = "none"
+)
+
+// clientAuthMethods lists the supported methods, advertised in the discovery document
+var clientAuthMethods = []string{ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost, ClientAuthMethodPrivateKeyJWT, ClientAuthMethodNone}
+
+// ClientAssertionTypeJWTBearer is the client_assertion_type of private_key_jwt (RFC 7523)
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionAlgorithms are the algorithms client assertions may be signed with.
+// HMAC would need the client secret as key, which is client_secret_jwt and not supported.
+var clientAssertionAlgorithms = slices.Concat(
+	algorithmsByMode[JWTKeyModeRSA],
+	algorithmsByMode[JWTKeyModeECDSA],
+	algorithmsByMode[JWTKeyModeEd25519],
+)
+
+// ClientCredentials are the credentials a client presented with a request
+type ClientCredentials struct {
+	// Method is one of the ClientAuthMethod constants
+	Method       string
+	ClientID     string
+	ClientSecret string
+	// Assertion is the signed JWT of private_key_jwt
+	Assertion string
+}
+
+// AuthenticateClient checks the client credentials of a request to endpoint, the URL of the
+// endpoint being called. Client assertions may name the endpoint, the token endpoint or the
+// issuer as audience.
+func (s *OIDCService) AuthenticateClient(credentials ClientCredentials, endpoint string) (*OIDCClient, error) {
+	clientID := credentials.ClientID
+	if credentials.Method == ClientAuthMethodPrivateKeyJWT && clientID == "" {
+		// The client is identified by the subject of its assertion
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(credentials.Assertion, claims); err != nil {
+			return nil, fmt.Errorf("malformed client assertion")
+		}
+		clientID, _ = claims.GetSubject()
+	}
+
+	client, exists := s.Client(clientID)
+	if !exists {
+		return nil, fmt.Errorf("unknown client")
+	}
+
+	if client.TokenEndpointAuthMethod != "" && credentials.Method != client.TokenEndpointAuthMethod {
+		return nil, fmt.Errorf("the client must authenticate with %s", client.TokenEndpointAuthMethod)
+	}
+
+	switch credentials.Method {
+	case ClientAuthMethodNone:
+		if !client.IsPublicClient() {
+			return nil, fmt.Errorf("client authentication is required")
+		}
+	case ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost:
+		if client.ClientSecret == "" || subtle.ConstantTimeCompare([]byte(credentials.ClientSecret), []byte(client.ClientSecret)) != 1 {
+			return nil, fmt.Errorf("invalid client credentials")
+		}
+	case ClientAuthMethodPrivateKeyJWT:
+		if err := s.verifyClientAssertion(client, credentials.Assertion, endpoint); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported client authentication method: %s", credentials.Method)
+	}
+
+	return client, nil
+}
+
+// verifyClientAssertion checks a private_key_jwt assertion against the keys the client
+// registered. Each assertion can be used once.
+func (s *OIDCService) verifyClientAssertion(client *OIDCClient, assertion, endpoint string) error {
+	if len(client.publicKeys) == 0 {
+		return fmt.Errorf("the client has no registered keys for private_key_jwt")
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(assertion, claims, client.verificationKeys,
+		jwt.WithValidMethods(clientAssertionAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(client.ClientID),
+		jwt.WithSubject(client.ClientID),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid client assertion: %w", err)
+	}
+
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return fmt.Errorf("invalid client assertion: %w", err)
+	}
+	accepted := []string{endpoint, s.config.Issuer + "/auth/token", s.config.Issuer}
+	if !slices.ContainsFunc(audiences, func(aud string) bool { return slices.Contains(accepted, aud) }) {
+		return fmt.Errorf("invalid client assertion: audience must be the token endpoint")
+	}
+
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return fmt.Errorf("invalid client assertion: jti is required")
+	}
+	if !s.usedAssertions.Use(token) {
+		return fmt.Errorf("invalid client assertion: the assertion has already been used")
+	}
+
+	return nil
+}
+
+// verificationKeys returns the registered keys that may have signed the token, selected
+// by the kid and alg headers
+func (c *OIDCClient) verificationKeys(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var keys jwt.VerificationKeySet
+	for _, key := range c.publicKeys {
+		if kid != "" && key.kid != kid {
+			continue
+		}
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			continue
+		}
+		keys.Keys = append(keys.Keys, key.key)
+	}
+
+	if len(keys.Keys) == 0 {
+		return nil, fmt.Errorf("no registered key matches the client assertion")
+	}
+	return keys, nil
+}
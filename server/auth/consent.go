@@ -0,0 +1,77 @@
+package auth
+
+import "slices"
+
+// consentKey identifies the scopes a user granted to a client
+type consentKey struct {
+	userID   int
+	clientID string
+}
+
+// scopeDescriptions explain the standard scopes on the consent page
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:        "Sign you in with your account",
+	ScopeProfile:       "Your username",
+	ScopeEmail:         "Your email address",
+	ScopePhone:         "Your phone number",
+	ScopeAddress:       "Your postal address",
+	ScopeOfflineAccess: "Access your data while you are not using the app",
+}
+
+// ConsentScope is a scope listed on the consent page
+type ConsentScope struct {
+	Name        string
+	Description string
+	// Required scopes cannot be deselected
+	Required bool
+}
+
+// consentScopes returns the scopes of the request as shown on the consent page. openid is
+// required, since without it the request would no longer be an OpenID Connect request.
+func consentScopes(scopes []string) []ConsentScope {
+	result := make([]ConsentScope, 0, len(scopes))
+	for _, scope := range scopes {
+		result = append(result, ConsentScope{
+			Name:        scope,
+			Description: scopeDescriptions[scope],
+			Required:    scope == ScopeOpenID,
+		})
+	}
+	return result
+}
+
+// HasConsent reports whether the user granted all scopes to the client before
+func (s *OIDCService) HasConsent(userID int, clientID string, scopes []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	granted := s.consents[consentKey{userID: userID, clientID: clientID}]
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// GrantConsent remembers that the user granted the scopes to the client, in addition to the
+// scopes granted before
+func (s *OIDCService) GrantConsent(userID int, clientID string, scopes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := consentKey{userID: userID, clientID: clientID}
+	for _, scope := range scopes {
+		if !slices.Contains(s.consents[key], scope) {
+			s.consents[key] = append(s.consents[key], scope)
+		}
+	}
+}
+
+// ClearConsents forgets the scopes granted by all users
+func (s *OIDCService) ClearConsents() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.consents = make(map[consentKey][]string)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DevicePollingInterval is the minimum time between two polls of a device code
+const DevicePollingInterval = 5 * time.Second
+
+// Polling errors of the device authorization grant (RFC 8628 section 3.5)
+var (
+	ErrAuthorizationPending = errors.New("the user has not yet approved the device")
+	ErrSlowDown             = errors.New("the device polls too fast")
+	ErrExpiredToken         = errors.New("the device code has expired")
+	ErrAccessDenied         = errors.New("the user denied the device")
+)
+
+// userCodeAlphabet has no vowels, to avoid forming words, and no characters that are easily
+// confused, as RFC 8628 section 6.1 recommends
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization is a pending login of a device, such as a CLI or a TV app
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scopes     []string
+	ExpiresAt  time.Time
+	// Interval is the minimum time between two polls, increased whenever the device polls too fast
+	Interval   time.Duration
+	lastPolled time.Time
+	// UserID and AuthTime are set once the user approved the device
+	UserID   int
+	AuthTime time.Time
+	denied   bool
+}
+
+// StartDeviceAuthorization issues a device code and user code for the client
+func (s *OIDCService) StartDeviceAuthorization(client *OIDCClient, scopes []string) (*DeviceAuthorization, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("failed to generate device code: %w", err)
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	authorization := &DeviceAuthorization{
+		DeviceCode: base64.RawURLEncoding.EncodeToString(bytes),
+		UserCode:   userCode,
+		ClientID:   client.ClientID,
+		Scopes:     scopes,
+		ExpiresAt:  time.Now().Add(client.DeviceCodeLifetime()),
+		Interval:   DevicePollingInterval,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupExpiredDeviceAuthorizations()
+	s.deviceAuthorizations[authorization.DeviceCode] = authorization
+	s.userCodes[normalizeUserCode(userCode)] = authorization.DeviceCode
+
+	return authorization, nil
+}
+
+// LookupUserCode returns the pending device authorization of a user code
+func (s *OIDCService) LookupUserCode(userCode string) (*DeviceAuthorization, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingDeviceAuthorization(userCode)
+}
+
+// ApproveDeviceAuthorization grants the device of the user code the scopes on behalf of the user.
+// The scopes replace the requested ones, as the user may grant fewer on the consent page.
+func (s *OIDCService) ApproveDeviceAuthorization(userCode string, userID int, scopes []string, authTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authorization, exists := s.pendingDeviceAuthorization(userCode)
+	if !exists {
+		return fmt.Errorf("invalid or expired user code")
+	}
+
+	authorization.UserID = userID
+	authorization.Scopes = scopes
+	authorization.AuthTime = authTime
+	delete(s.userCodes, normalizeUserCode(userCode))
+	return nil
+}
+
+// DenyDeviceAuthorization rejects the device of the user code. Its next poll gets ErrAccessDenied.
+func (s *OIDCService) DenyDeviceAuthorization(userCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if authorization, exists := s.pendingDeviceAuthorization(userCode); exists {
+		authorization.denied = true
+		delete(s.userCodes, normalizeUserCode(userCode))
+	}
+}
+
+// pendingDeviceAuthorization returns the device authorization of a user code that is neither
+// decided nor expired. The caller must hold the lock.
+func (s *OIDCService) pendingDeviceAuthorization(userCode string) (*DeviceAuthorization, bool) {
+	authorization, exists := s.deviceAuthorizations[s.userCodes[normalizeUserCode(userCode)]]
+	if !exists || authorization.UserID != 0 || authorization.denied || time.Now().After(authorization.ExpiresAt) {
+		return nil, false
+	}
+	return authorization, true
+}
+
+// PollDeviceAuthorization returns the approved device authorization of the device code and
+// consumes it. Until the user approves it, ErrAuthorizationPending or ErrSlowDown is returned.
+func (s *OIDCService) PollDeviceAuthorization(deviceCode, clientID string) (*DeviceAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authorization, exists := s.deviceAuthorizations[deviceCode]
+	if !exists || authorization.ClientID != clientID {
+		return nil, fmt.Errorf("invalid device code")
+	}
+
+	now := time.Now()
+	if now.After(authorization.ExpiresAt) {
+		s.deleteDeviceAuthorization(authorization)
+		return nil, ErrExpiredToken
+	}
+
+	if authorization.denied {
+		s.deleteDeviceAuthorization(authorization)
+		return nil, ErrAccessDenied
+	}
+	if authorization.UserID != 0 {
+		s.deleteDeviceAuthorization(authorization)
+		return authorization, nil
+	}
+
+	tooFast := now.Sub(authorization.lastPolled) < authorization.Interval
+	authorization.lastPolled = now
+	if tooFast {
+		authorization.Interval += DevicePollingInterval
+		return nil, ErrSlowDown
+	}
+	return nil, ErrAuthorizationPending
+}
+
+// deleteDeviceAuthorization removes a device authorization. The caller must hold the lock.
+func (s *OIDCService) deleteDeviceAuthorization(authorization *DeviceAuthorization) {
+	delete(s.deviceAuthorizations, authorization.DeviceCode)
+	delete(s.userCodes, normalizeUserCode(authorization.UserCode))
+}
+
+// cleanupExpiredDeviceAuthorizations drops expired device codes. The caller must hold the lock.
+func (s *OIDCService) cleanupExpiredDeviceAuthorizations() {
+	now := time.Now()
+	for _, authorization := range s.deviceAuthorizations {
+		if now.After(authorization.ExpiresAt) {
+			s.deleteDeviceAuthorization(authorization)
+		}
+	}
+}
+
+// generateUserCode returns a user code of eight characters, formatted as XXXX-XXXX
+func generateUserCode() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate user code: %w", err)
+	}
+
+	code := make([]byte, 0, 9)
+	for i, b := range bytes {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode makes user codes case insensitive and ignores dashes and spaces
+func normalizeUserCode(userCode string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+}
@@ -54,13 +54,10 @@ func (h *AuthHandler) loginWithJWT(c *gin.Context, req domain.LoginRequest) {
 		return
 	}
 
-	// Don't return password hash in response
-	responseUser := *user
-	responseUser.HashedPassword = ""
-
-	response := domain.AuthResponse{
-		Token: token,
-		User:  responseUser,
+	response, err := h.tokenResponse(user, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue refresh token"})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -102,19 +99,16 @@ func (h *AuthHandler) loginWithBoth(c *gin.Context, req domain.LoginRequest) {
 		return
 	}
 
+	response, err := h.tokenResponse(user, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue refresh token"})
+		return
+	}
+
 	// Set session cookie
 	c.SetSameSite(http.SameSiteStrictMode)
 	c.SetCookie("session_id", session.ID, 0, "/", "", false, true)
 
-	// Don't return password hash in response
-	responseUser := *user
-	responseUser.HashedPassword = ""
-
-	response := domain.AuthResponse{
-		Token: token,
-		User:  responseUser,
-	}
-
 	c.JSON(http.StatusOK, response)
 }
 
@@ -131,19 +125,76 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	response, err := h.tokenResponse(user, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented refresh token is
+// consumed; presenting it again revokes every token issued from the same login.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req domain.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, token, refreshToken, err := h.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Don't return password hash in response
 	responseUser := *user
 	responseUser.HashedPassword = ""
 
 	response := domain.AuthResponse{
-		Token: token,
-		User:  responseUser,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.authService.AccessTokenTTL().Seconds()),
+		User:         responseUser,
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusOK, response)
+}
+
+// tokenResponse builds the response of a password login, starting a new refresh token family
+func (h *AuthHandler) tokenResponse(user *domain.User, token string) (domain.AuthResponse, error) {
+	refreshToken, err := h.authService.IssueRefreshToken(user)
+	if err != nil {
+		return domain.AuthResponse{}, err
+	}
+
+	// Don't return password hash in response
+	responseUser := *user
+	responseUser.HashedPassword = ""
+
+	return domain.AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.authService.AccessTokenTTL().Seconds()),
+		User:         responseUser,
+	}, nil
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
+	// The refresh token is optional, clients without one only drop their access token
+	var req domain.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.RefreshToken != "" {
+		h.authService.RevokeRefreshToken(req.RefreshToken)
+	}
+
 	if h.authMode == AuthModeJWT {
 		c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
 		return
@@ -200,29 +251,16 @@ func (h *AuthHandler) GetOpenIDConfiguration(c *gin.Context) {
 	}
 	baseURL := scheme + "://" + c.Request.Host
 
+	// Tokens are issued by /auth/login rather than an OAuth authorization or token endpoint,
+	// so there are no response types or client authentication methods to advertise
 	config := map[string]interface{}{
-		"issuer":                 baseURL,
-		"authorization_endpoint": baseURL + "/auth/authorize",
-		"token_endpoint":         baseURL + "/auth/token",
-		"userinfo_endpoint":      baseURL + "/auth/me",
-		"jwks_uri":               baseURL + "/.well-known/jwks.json",
-		"response_types_supported": []string{
-			"code",
-			"token",
-			"id_token",
-			"code token",
-			"code id_token",
-			"token id_token",
-			"code token id_token",
-		},
-		"subject_types_supported": []string{"public"},
+		"issuer":                   baseURL,
+		"userinfo_endpoint":        baseURL + "/auth/me",
+		"jwks_uri":                 baseURL + "/.well-known/jwks.json",
+		"response_types_supported": []string{},
+		"subject_types_supported":  []string{"public"},
 		"id_token_signing_alg_values_supported": []string{
-			"RS256",
-			"HS256",
-		},
-		"token_endpoint_auth_methods_supported": []string{
-			"client_secret_post",
-			"client_secret_basic",
+			h.authService.Algorithm(),
 		},
 	}
 
@@ -0,0 +1,620 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKeyGracePeriod is how long a rotated out key keeps verifying tokens
+const DefaultKeyGracePeriod = 24 * time.Hour
+
+// keyStateFile records the active key and when the other keys were rotated out
+const keyStateFile = "keys.json"
+
+// SigningKey is an asymmetric key used to sign tokens
+type SigningKey struct {
+	Kid     string
+	Private crypto.Signer
+	// RetiredAt is set once another key became active
+	RetiredAt *time.Time
+	// path is the file the key was loaded from or saved to, if any
+	path string
+	// generated is set for keys the ring created itself. Only their files are deleted
+	// once they expire; keys supplied by the operator stay on disk as retired keys.
+	generated bool
+}
+
+// KeyRing holds the active signing key and the keys that still verify tokens.
+// With a directory the keys are persisted there, so tokens survive restarts.
+type KeyRing struct {
+	dir         string
+	algorithm   string
+	gracePeriod time.Duration
+	keys        map[string]*SigningKey
+	active      *SigningKey
+	mu          sync.RWMutex
+}
+
+type keyState struct {
+	Active  string               `json:"active"`
+	Retired map[string]time.Time `json:"retired"`
+	// Generated lists the keys the ring created, which it may delete again
+	Generated []string `json:"generated,omitempty"`
+}
+
+// NewKeyRing loads the keys in dir, generating and persisting a key for algorithm if
+// there is none. Without a directory a key is generated in memory.
+//
+// Keys are read from PEM files (PKCS#1, SEC 1 or PKCS#8) named <kid>.pem and from private
+// JWK files named <kid>.jwk or <kid>.json, and must suit algorithm. Unless keys.json
+// names the active key, the directory must hold a single key, which then signs new tokens.
+func NewKeyRing(dir, algorithm string) (*KeyRing, error) {
+	ring := &KeyRing{
+		dir:         dir,
+		algorithm:   algorithm,
+		gracePeriod: DefaultKeyGracePeriod,
+		keys:        make(map[string]*SigningKey),
+	}
+
+	if dir != "" {
+		if err := ring.load(); err != nil {
+			return nil, err
+		}
+		if ring.active != nil {
+			return ring, nil
+		}
+	}
+
+	key, err := ring.generate()
+	if err != nil {
+		return nil, err
+	}
+	ring.keys[key.Kid] = key
+	ring.active = key
+
+	if err := ring.saveState(); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// SetGracePeriod changes how long rotated out keys keep verifying tokens.
+// A zero duration keeps the current period.
+func (r *KeyRing) SetGracePeriod(gracePeriod time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if gracePeriod > 0 {
+		r.gracePeriod = gracePeriod
+	}
+}
+
+// Active returns the key signing new tokens
+func (r *KeyRing) Active() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.active
+}
+
+// Lookup returns the key with the given kid if it still verifies tokens.
+// An empty kid refers to the active key.
+func (r *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if kid == "" {
+		return r.active, true
+	}
+
+	key, exists := r.keys[kid]
+	if !exists || !r.isValid(key, time.Now()) {
+		return nil, false
+	}
+	return key, true
+}
+
+// VerificationKeys returns the keys that still verify tokens, sorted by kid
+func (r *KeyRing) VerificationKeys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]*SigningKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		if r.isValid(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b *SigningKey) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return keys
+}
+
+// Rotate makes a newly generated key the active key. The previous key keeps
+// verifying tokens for the grace period. Generated keys whose grace period is over
+// are forgotten and their files are removed from the key directory; expired keys
+// supplied by the operator are kept and stay retired in keys.json.
+func (r *KeyRing) Rotate() (*SigningKey, error) {
+	key, err := r.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	// Forget generated keys whose grace period is over. Their files must go as well,
+	// otherwise they would be loaded as valid keys after a restart.
+	for kid, k := range r.keys {
+		if r.isValid(k, now) || !k.generated {
+			continue
+		}
+		if k.path != "" {
+			if err := os.Remove(k.path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove expired key %s: %w", kid, err)
+			}
+		}
+		delete(r.keys, kid)
+	}
+
+	r.active.RetiredAt = &now
+	r.keys[key.Kid] = key
+	r.active = key
+
+	if err := r.saveState(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (r *KeyRing) isValid(key *SigningKey, now time.Time) bool {
+	return key.RetiredAt == nil || now.Before(key.RetiredAt.Add(r.gracePeriod))
+}
+
+// generate creates a key for the algorithm and writes it to the key directory, if any
+func (r *KeyRing) generate() (*SigningKey, error) {
+	var private crypto.Signer
+	var prefix string
+	var err error
+	switch {
+	case strings.HasPrefix(r.algorithm, "RS"), strings.HasPrefix(r.algorithm, "PS"):
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+		prefix = "rsa"
+	case strings.HasPrefix(r.algorithm, "ES"):
+		private, err = ecdsa.GenerateKey(curveForAlgorithm(r.algorithm), rand.Reader)
+		prefix = "ec"
+	case r.algorithm == "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+		prefix = "ed25519"
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", r.algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", r.algorithm, err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	key := &SigningKey{
+		Kid:       prefix + "-" + time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Private:   private,
+		generated: true,
+	}
+
+	if r.dir == "" {
+		return key, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	key.path = filepath.Join(r.dir, key.Kid+".pem")
+	if err := os.WriteFile(key.path, content, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key: %w", err)
+	}
+
+	return key, nil
+}
+
+// load reads the keys and the key state from the key directory, creating it if needed
+func (r *KeyRing) load() error {
+	if err := os.MkdirAll(r.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read key directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == keyStateFile {
+			continue
+		}
+
+		var key *SigningKey
+		switch filepath.Ext(name) {
+		case ".pem":
+			key, err = loadPEMKey(filepath.Join(r.dir, name))
+		case ".jwk", ".json":
+			key, err = loadJWKKey(filepath.Join(r.dir, name))
+		default:
+			continue
+		}
+		if err == nil {
+			err = checkKeyType(r.algorithm, key.Private)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load key %s: %w", name, err)
+		}
+
+		if _, exists := r.keys[key.Kid]; exists {
+			return fmt.Errorf("duplicate key ID %s in %s", key.Kid, r.dir)
+		}
+		key.path = filepath.Join(r.dir, name)
+		r.keys[key.Kid] = key
+	}
+
+	if len(r.keys) == 0 {
+		return nil
+	}
+
+	var state keyState
+	content, err := os.ReadFile(filepath.Join(r.dir, keyStateFile))
+	if err == nil {
+		if err := json.Unmarshal(content, &state); err != nil {
+			return fmt.Errorf("invalid %s: %w", keyStateFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", keyStateFile, err)
+	}
+
+	for kid, retiredAt := range state.Retired {
+		if key, exists := r.keys[kid]; exists {
+			key.RetiredAt = &retiredAt
+		}
+	}
+	for _, kid := range state.Generated {
+		if key, exists := r.keys[kid]; exists {
+			key.generated = true
+		}
+	}
+
+	if key, exists := r.keys[state.Active]; exists {
+		key.RetiredAt = nil
+		r.active = key
+		return nil
+	}
+
+	// Guessing among several keys could sign with a key the user meant to retire
+	if len(r.keys) > 1 {
+		return fmt.Errorf("%s in %s does not name the active key, cannot choose between %d keys", keyStateFile, r.dir, len(r.keys))
+	}
+	for _, key := range r.keys {
+		key.RetiredAt = nil
+		r.active = key
+	}
+
+	return nil
+}
+
+// saveState records the active key and the retirement times. The caller must hold the lock.
+func (r *KeyRing) saveState() error {
+	if r.dir == "" {
+		return nil
+	}
+
+	state := keyState{Active: r.active.Kid, Retired: make(map[string]time.Time)}
+	for kid, key := range r.keys {
+		if key.RetiredAt != nil {
+			state.Retired[kid] = *key.RetiredAt
+		}
+		if key.generated {
+			state.Generated = append(state.Generated, kid)
+		}
+	}
+	slices.Sort(state.Generated)
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, keyStateFile), content, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", keyStateFile, err)
+	}
+
+	return nil
+}
+
+// loadPEMKey reads a PKCS#1, SEC 1 or PKCS#8 private key. The kid is the file name.
+func loadPEMKey(path string) (*SigningKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	return &SigningKey{
+		Kid:     strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Private: signer,
+	}, nil
+}
+
+// privateJWK is the subset of RFC 7518 and RFC 8037 private key parameters we read
+type privateJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKKey reads a private JWK. The kid defaults to the file name.
+func loadJWKKey(path string) (*SigningKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwk privateJWK
+	if err := json.Unmarshal(content, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+
+	var private crypto.Signer
+	switch jwk.Kty {
+	case "RSA":
+		private, err = rsaKeyFromJWK(jwk)
+	case "EC":
+		private, err = ecKeyFromJWK(jwk)
+	case "OKP":
+		private, err = ed25519KeyFromJWK(jwk)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid := jwk.Kid
+	if kid == "" {
+		kid = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return &SigningKey{Kid: kid, Private: private}, nil
+}
+
+// decodeJWKParams decodes base64url encoded JWK parameters, all of which are required
+func decodeJWKParams(params map[string]string) (map[string][]byte, error) {
+	decoded := make(map[string][]byte, len(params))
+	for name, value := range params {
+		bytes, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(bytes) == 0 {
+			return nil, fmt.Errorf("invalid or missing JWK parameter %q", name)
+		}
+		decoded[name] = bytes
+	}
+	return decoded, nil
+}
+
+func rsaKeyFromJWK(jwk privateJWK) (*rsa.PrivateKey, error) {
+	params, err := decodeJWKParams(map[string]string{"n": jwk.N, "e": jwk.E, "d": jwk.D, "p": jwk.P, "q": jwk.Q})
+	if err != nil {
+		return nil, err
+	}
+
+	private := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: new(big.Int).SetBytes(params["n"]), E: int(new(big.Int).SetBytes(params["e"]).Int64())},
+		D:         new(big.Int).SetBytes(params["d"]),
+		Primes:    []*big.Int{new(big.Int).SetBytes(params["p"]), new(big.Int).SetBytes(params["q"])},
+	}
+	if err := private.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid RSA key: %w", err)
+	}
+	private.Precompute()
+
+	return private, nil
+}
+
+func ecKeyFromJWK(jwk privateJWK) (*ecdsa.PrivateKey, error) {
+	var curve elliptic.Curve
+	var exchange ecdh.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve, exchange = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, exchange = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, exchange = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+	}
+
+	params, err := decodeJWKParams(map[string]string{"x": jwk.X, "y": jwk.Y, "d": jwk.D})
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive the public point from d to make sure x and y belong to it
+	derived, err := exchange.NewPrivateKey(params["d"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid EC key: %w", err)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	point := derived.PublicKey().Bytes()
+	x, y := new(big.Int).SetBytes(point[1:1+size]), new(big.Int).SetBytes(point[1+size:])
+	if x.Cmp(new(big.Int).SetBytes(params["x"])) != 0 || y.Cmp(new(big.Int).SetBytes(params["y"])) != 0 {
+		return nil, fmt.Errorf("invalid EC key: x and y do not match d")
+	}
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+		D:         new(big.Int).SetBytes(params["d"]),
+	}, nil
+}
+
+func ed25519KeyFromJWK(jwk privateJWK) (ed25519.PrivateKey, error) {
+	if jwk.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+	}
+
+	params, err := decodeJWKParams(map[string]string{"d": jwk.D})
+	if err != nil {
+		return nil, err
+	}
+	if len(params["d"]) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid Ed25519 key: d must be %d bytes", ed25519.SeedSize)
+	}
+
+	return ed25519.NewKeyFromSeed(params["d"]), nil
+}
+
+// publicJWK converts the public part of a key to its JWK representation
+func publicJWK(key *SigningKey, algorithm string) JWK {
+	jwk := JWK{
+		Use: "sig",
+		Alg: algorithm,
+		Kid: key.Kid,
+	}
+
+	switch private := key.Private.(type) {
+	case *rsa.PrivateKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(private.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes())
+	case *ecdsa.PrivateKey:
+		// Coordinates are padded to the size of the curve as RFC 7518 requires
+		size := (private.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = private.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, size)))
+	case ed25519.PrivateKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(private.Public().(ed25519.PublicKey))
+	}
+
+	return jwk
+}
+
+// parsePublicJWK converts a public JWK, such as a key registered by a client, to a public key
+func parsePublicJWK(jwk JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		params, err := decodeJWKParams(map[string]string{"n": jwk.N, "e": jwk.E})
+		if err != nil {
+			return nil, err
+		}
+		e := new(big.Int).SetBytes(params["e"])
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, fmt.Errorf("invalid RSA key: bad exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(params["n"]), E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var exchange ecdh.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve, exchange = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, exchange = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, exchange = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+
+		params, err := decodeJWKParams(map[string]string{"x": jwk.X, "y": jwk.Y})
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(params["x"]) != size || len(params["y"]) != size {
+			return nil, fmt.Errorf("invalid EC key: x and y must be %d bytes", size)
+		}
+
+		// Parsing the uncompressed point checks that it lies on the curve
+		point := append(append([]byte{4}, params["x"]...), params["y"]...)
+		if _, err := exchange.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(params["x"]),
+			Y:     new(big.Int).SetBytes(params["y"]),
+		}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+		}
+		params, err := decodeJWKParams(map[string]string{"x": jwk.X})
+		if err != nil {
+			return nil, err
+		}
+		if len(params["x"]) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key: x must be %d bytes", ed25519.PublicKeySize)
+		}
+		return ed25519.PublicKey(params["x"]), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
@@ -2,9 +2,17 @@ package auth
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Scopes service clients need for the task API. The write scope includes reading.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
 )
 
 func AuthMiddleware(authService *AuthService, authMode AuthMode) gin.HandlerFunc {
@@ -20,7 +28,18 @@ func AuthMiddleware(authService *AuthService, authMode AuthMode) gin.HandlerFunc
 		case AuthModeBoth:
 			userID, authenticated = authenticateWithBoth(c, authService)
 		case AuthModeOIDC:
-			userID, authenticated = authenticateWithJWT(c, authService) // OIDC uses JWT tokens
+			// OIDC uses JWT tokens, which may also belong to a service client instead of a user
+			if clientID, scopes, ok := authenticateServiceClient(c, authService); ok {
+				if !serviceClientAllowed(c.Request.Method, scopes) {
+					respondInsufficientScope(c)
+					c.Abort()
+					return
+				}
+				c.Set("clientID", clientID)
+				c.Next()
+				return
+			}
+			userID, authenticated = authenticateWithJWT(c, authService)
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid auth mode"})
 			c.Abort()
@@ -81,6 +100,56 @@ func authenticateWithJWT(c *gin.Context, authService *AuthService) (int, bool) {
 	return userID, true
 }
 
+// authenticateServiceClient accepts client credentials tokens, which carry a client_id
+// but no user subject, and returns the client ID and the granted scopes.
+// Other requests are left to authenticateWithJWT.
+func authenticateServiceClient(c *gin.Context, authService *AuthService) (string, []string, bool) {
+	tokenString, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || tokenString == "" {
+		return "", nil, false
+	}
+
+	token, err := authService.ValidateToken(tokenString)
+	if err != nil || !token.Valid {
+		return "", nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, false
+	}
+	if _, hasSubject := claims["sub"]; hasSubject {
+		return "", nil, false
+	}
+	clientID, ok := claims["client_id"].(string)
+	if !ok || clientID == "" {
+		return "", nil, false
+	}
+
+	scope, _ := claims["scope"].(string)
+	return clientID, strings.Fields(scope), true
+}
+
+// serviceClientAllowed reports whether the scopes of a service client cover the request method.
+// Reading needs tasks:read or tasks:write, every other method needs tasks:write.
+func serviceClientAllowed(method string, scopes []string) bool {
+	if slices.Contains(scopes, ScopeTasksWrite) {
+		return true
+	}
+	readOnly := method == http.MethodGet || method == http.MethodHead
+	return readOnly && slices.Contains(scopes, ScopeTasksRead)
+}
+
+// respondInsufficientScope rejects a service client token without the scope the request needs (RFC 6750)
+func respondInsufficientScope(c *gin.Context) {
+	scope := ScopeTasksWrite
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		scope = ScopeTasksRead
+	}
+	c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+	c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "error_description": "The token requires the " + scope + " scope"})
+}
+
 func authenticateWithSession(c *gin.Context, authService *AuthService) (int, bool) {
 	// Get session ID from cookie
 	sessionID, err := c.Cookie("session_id")
@@ -122,6 +191,12 @@ func authenticateWithBoth(c *gin.Context, authService *AuthService) (int, bool)
 	return 0, false
 }
 
+// IsServiceClient reports whether the request was authenticated with a client credentials token
+func IsServiceClient(c *gin.Context) bool {
+	_, exists := c.Get("clientID")
+	return exists
+}
+
 func GetUserIDFromContext(c *gin.Context) (int, bool) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -1,18 +1,105 @@
 package auth
 
 import (
+	"crypto"
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"time"
 )
 
-// OIDCConfig represents the OIDC provider configuration
+// Grant types a client can be allowed to use
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	// GrantTypeImplicit allows the response types that return tokens from the authorization endpoint
+	GrantTypeImplicit = "implicit"
+)
+
+// supportedGrantTypes lists the grant types the token endpoint implements
+var supportedGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials, GrantTypeDeviceCode}
+
+// clientGrantTypes lists the grant types a client can be allowed to use
+var clientGrantTypes = append(slices.Clone(supportedGrantTypes), GrantTypeImplicit)
+
+// Scopes with a meaning to the provider
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+	ScopeAddress = "address"
+	// ScopeOfflineAccess requests a refresh token in the authorization code flow
+	ScopeOfflineAccess = "offline_access"
+)
+
+// ACRPassword is the acr of ID tokens. Users log in with a password alone, which the
+// level 0 of OpenID Connect Core describes.
+const ACRPassword = "0"
+
+// Token lifetimes of clients that do not set their own
+const (
+	DefaultOIDCAccessTokenTTL = time.Hour
+	DefaultIDTokenTTL         = time.Hour
+	DefaultDeviceCodeTTL      = 10 * time.Minute
+)
+
+// OIDCConfig represents the OIDC provider configuration.
+//
+// Clients are declared in Clients. The top-level client_id, client_secret and
+// redirect_uris of the single-client format are still accepted and describe one more client.
 type OIDCConfig struct {
+	ClientID     string        `json:"client_id,omitempty"`
+	ClientSecret string        `json:"client_secret,omitempty"`
+	RedirectURIs []string      `json:"redirect_uris,omitempty"`
+	Issuer       string        `json:"issuer"`
+	Scopes       []string      `json:"scopes"`
+	Clients      []*OIDCClient `json:"clients,omitempty"`
+
+	clients map[string]*OIDCClient
+}
+
+// OIDCClient is a client registered with the provider. Clients authenticate with their
+// secret or, when they register a JWK Set, with private_key_jwt. Without either the client
+// is public and must use PKCE.
+type OIDCClient struct {
 	ClientID     string   `json:"client_id"`
-	ClientSecret string   `json:"client_secret"`
-	RedirectURIs []string `json:"redirect_uris"`
-	Issuer       string   `json:"issuer"`
-	Scopes       []string `json:"scopes"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	// PostLogoutRedirectURIs are the URIs the end_session endpoint may redirect to
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	// JWKS holds the public keys the client signs its client assertions with
+	JWKS *JWKSet `json:"jwks,omitempty"`
+	// TokenEndpointAuthMethod restricts the client to one authentication method, any method
+	// matching its credentials is accepted when empty
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+	// Scopes the client may request, defaults to all scopes of the provider
+	Scopes []string `json:"scopes,omitempty"`
+	// GrantTypes the client may use, defaults to authorization_code. implicit allows the
+	// id_token and id_token token response types, and code id_token with authorization_code.
+	GrantTypes []string `json:"grant_types,omitempty"`
+	// AccessTokenTTL and IDTokenTTL are token lifetimes in seconds, zero means one hour
+	AccessTokenTTL int `json:"access_token_ttl,omitempty"`
+	IDTokenTTL     int `json:"id_token_ttl,omitempty"`
+	// RefreshTokenTTL is the refresh token lifetime in seconds, zero means seven days
+	RefreshTokenTTL int `json:"refresh_token_ttl,omitempty"`
+	// DeviceCodeTTL is the device code lifetime in seconds, zero means ten minutes
+	DeviceCodeTTL int `json:"device_code_ttl,omitempty"`
+	// RequireConsent shows the consent page until the user granted the requested scopes
+	RequireConsent bool `json:"require_consent,omitempty"`
+
+	// publicKeys are the parsed keys of JWKS
+	publicKeys []clientKey
+}
+
+// clientKey is a key a client registered for private_key_jwt
+type clientKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
 }
 
 // LoadOIDCConfig loads OIDC configuration from a JSON file
@@ -32,15 +119,6 @@ func LoadOIDCConfig(configPath string) (*OIDCConfig, error) {
 	}
 
 	// Validate required fields
-	if config.ClientID == "" {
-		return nil, fmt.Errorf("client_id is required in OIDC config")
-	}
-	if config.ClientSecret == "" {
-		return nil, fmt.Errorf("client_secret is required in OIDC config")
-	}
-	if len(config.RedirectURIs) == 0 {
-		return nil, fmt.Errorf("redirect_uris is required in OIDC config")
-	}
 	if config.Issuer == "" {
 		return nil, fmt.Errorf("issuer is required in OIDC config")
 	}
@@ -50,17 +128,178 @@ func LoadOIDCConfig(configPath string) (*OIDCConfig, error) {
 		config.Scopes = []string{"openid", "profile"}
 	}
 
+	if err := config.initClients(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
-// ValidateRedirectURI checks if the provided redirect URI is allowed
-func (c *OIDCConfig) ValidateRedirectURI(uri string) bool {
-	for _, allowedURI := range c.RedirectURIs {
-		if uri == allowedURI {
-			return true
+// initClients validates the clients, applies their defaults and indexes them by ID
+func (c *OIDCConfig) initClients() error {
+	clients := slices.Clone(c.Clients)
+	if c.ClientID != "" || c.ClientSecret != "" || len(c.RedirectURIs) > 0 {
+		clients = append(clients, &OIDCClient{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURIs: c.RedirectURIs,
+		})
+	}
+	if len(clients) == 0 {
+		return fmt.Errorf("clients is required in OIDC config")
+	}
+
+	c.clients = make(map[string]*OIDCClient, len(clients))
+	for i, client := range clients {
+		if client.ClientID == "" {
+			return fmt.Errorf("client_id is required for client %d in OIDC config", i+1)
 		}
+		if _, exists := c.clients[client.ClientID]; exists {
+			return fmt.Errorf("duplicate client_id %s in OIDC config", client.ClientID)
+		}
+		if err := client.validate(c.Scopes); err != nil {
+			return fmt.Errorf("invalid client %s in OIDC config: %w", client.ClientID, err)
+		}
+		c.clients[client.ClientID] = client
 	}
-	return false
+	c.Clients = clients
+
+	return nil
+}
+
+// validate checks the client settings and fills in the defaults
+func (c *OIDCClient) validate(providerScopes []string) error {
+	if len(c.GrantTypes) == 0 {
+		c.GrantTypes = []string{GrantTypeAuthorizationCode}
+	}
+	for _, grantType := range c.GrantTypes {
+		if !slices.Contains(clientGrantTypes, grantType) {
+			return fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+
+	if c.AllowsGrantType(GrantTypeAuthorizationCode) && len(c.RedirectURIs) == 0 {
+		return fmt.Errorf("redirect_uris is required for the authorization_code grant")
+	}
+	if c.AllowsGrantType(GrantTypeImplicit) && len(c.RedirectURIs) == 0 {
+		return fmt.Errorf("redirect_uris is required for the implicit grant")
+	}
+	if c.JWKS != nil {
+		if len(c.JWKS.Keys) == 0 {
+			return fmt.Errorf("jwks must contain at least one key")
+		}
+		c.publicKeys = nil
+		for i, jwk := range c.JWKS.Keys {
+			if jwk.Alg != "" && !slices.Contains(clientAssertionAlgorithms, jwk.Alg) {
+				return fmt.Errorf("unsupported algorithm %s for key %d in jwks", jwk.Alg, i+1)
+			}
+			key, err := parsePublicJWK(jwk)
+			if err != nil {
+				return fmt.Errorf("invalid key %d in jwks: %w", i+1, err)
+			}
+			c.publicKeys = append(c.publicKeys, clientKey{kid: jwk.Kid, alg: jwk.Alg, key: key})
+		}
+	}
+
+	switch c.TokenEndpointAuthMethod {
+	case "":
+	case ClientAuthMethodNone:
+		if !c.IsPublicClient() {
+			return fmt.Errorf("token_endpoint_auth_method none is only allowed for clients without credentials")
+		}
+	case ClientAuthMethodSecretBasic, ClientAuthMethodSecretPost:
+		if c.ClientSecret == "" {
+			return fmt.Errorf("client_secret is required for token_endpoint_auth_method %s", c.TokenEndpointAuthMethod)
+		}
+	case ClientAuthMethodPrivateKeyJWT:
+		if c.JWKS == nil {
+			return fmt.Errorf("jwks is required for token_endpoint_auth_method %s", c.TokenEndpointAuthMethod)
+		}
+	default:
+		return fmt.Errorf("unsupported token_endpoint_auth_method: %s", c.TokenEndpointAuthMethod)
+	}
+
+	if c.AllowsGrantType(GrantTypeClientCredentials) && c.IsPublicClient() {
+		return fmt.Errorf("client_secret or jwks is required for the client_credentials grant")
+	}
+
+	if len(c.Scopes) == 0 {
+		c.Scopes = providerScopes
+	}
+	for _, scope := range c.Scopes {
+		if !slices.Contains(providerScopes, scope) {
+			return fmt.Errorf("scope %s is not supported by the provider", scope)
+		}
+	}
+
+	if c.AccessTokenTTL < 0 || c.IDTokenTTL < 0 || c.RefreshTokenTTL < 0 || c.DeviceCodeTTL < 0 {
+		return fmt.Errorf("token lifetimes must not be negative")
+	}
+
+	return nil
+}
+
+// Client returns the client with the given ID
+func (c *OIDCConfig) Client(clientID string) (*OIDCClient, bool) {
+	client, exists := c.clients[clientID]
+	return client, exists
+}
+
+// IsPublicClient reports whether the client has no credentials, such as a SPA or a mobile app
+func (c *OIDCClient) IsPublicClient() bool {
+	return c.ClientSecret == "" && c.JWKS == nil
+}
+
+// ValidateRedirectURI checks if the provided redirect URI is allowed
+func (c *OIDCClient) ValidateRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// ValidatePostLogoutRedirectURI checks if the URI may be used after logout
+func (c *OIDCClient) ValidatePostLogoutRedirectURI(uri string) bool {
+	return slices.Contains(c.PostLogoutRedirectURIs, uri)
+}
+
+// AllowsScope checks if the client may request the scope
+func (c *OIDCClient) AllowsScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// AllowsGrantType checks if the client may use the grant type
+func (c *OIDCClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AccessTokenLifetime returns how long access tokens issued to the client are valid
+func (c *OIDCClient) AccessTokenLifetime() time.Duration {
+	if c.AccessTokenTTL > 0 {
+		return time.Duration(c.AccessTokenTTL) * time.Second
+	}
+	return DefaultOIDCAccessTokenTTL
+}
+
+// IDTokenLifetime returns how long ID tokens issued to the client are valid
+func (c *OIDCClient) IDTokenLifetime() time.Duration {
+	if c.IDTokenTTL > 0 {
+		return time.Duration(c.IDTokenTTL) * time.Second
+	}
+	return DefaultIDTokenTTL
+}
+
+// RefreshTokenLifetime returns how long refresh tokens issued to the client are valid
+func (c *OIDCClient) RefreshTokenLifetime() time.Duration {
+	if c.RefreshTokenTTL > 0 {
+		return time.Duration(c.RefreshTokenTTL) * time.Second
+	}
+	return DefaultRefreshTokenTTL
+}
+
+// DeviceCodeLifetime returns how long device codes issued to the client are valid
+func (c *OIDCClient) DeviceCodeLifetime() time.Duration {
+	if c.DeviceCodeTTL > 0 {
+		return time.Duration(c.DeviceCodeTTL) * time.Second
+	}
+	return DefaultDeviceCodeTTL
 }
 
 // ValidateScope checks if the provided scope is supported
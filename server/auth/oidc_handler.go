@@ -1,16 +1,25 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// oidcSessionCookie holds the login session of the provider, so that a user who logged in
+// once is not asked for a password by every authorization request
+const oidcSessionCookie = "oidc_session"
+
 // OIDCHandler handles OIDC endpoints
 type OIDCHandler struct {
 	oidcService *OIDCService
@@ -33,6 +42,7 @@ func (h *OIDCHandler) Authorize(c *gin.Context) {
 	responseType := c.Query("response_type")
 	scope := c.Query("scope")
 	state := c.Query("state")
+	codeChallenge := c.Query("code_challenge")
 
 	// Validate required parameters
 	if clientID == "" || redirectURI == "" || responseType == "" {
@@ -44,7 +54,8 @@ func (h *OIDCHandler) Authorize(c *gin.Context) {
 	}
 
 	// Validate client ID and redirect URI
-	if clientID != h.oidcService.config.ClientID {
+	client, exists := h.oidcService.Client(clientID)
+	if !exists {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":             "invalid_client",
 			"error_description": "Invalid client_id",
@@ -52,7 +63,7 @@ func (h *OIDCHandler) Authorize(c *gin.Context) {
 		return
 	}
 
-	if !h.oidcService.config.ValidateRedirectURI(redirectURI) {
+	if !client.ValidateRedirectURI(redirectURI) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":             "invalid_request",
 			"error_description": "Invalid redirect_uri",
@@ -60,72 +71,310 @@ func (h *OIDCHandler) Authorize(c *gin.Context) {
 		return
 	}
 
-	// Validate response type
-	if responseType != "code" {
-		redirectError(c, redirectURI, "unsupported_response_type", "Only authorization code flow is supported", state)
+	request := &AuthRequest{
+		ClientID:     clientID,
+		RedirectURI:  redirectURI,
+		State:        state,
+		Nonce:        c.Query("nonce"),
+		ResponseMode: ResponseModeQuery,
+	}
+
+	// Validate response type and response mode
+	responseTypes, ok := ParseResponseType(responseType)
+	if !ok {
+		authorizationError(c, request, "unsupported_response_type", "Supported response types are "+strings.Join(supportedResponseTypes, ", "))
+		return
+	}
+	request.ResponseTypes = responseTypes
+	request.ResponseMode = defaultResponseMode(responseTypes)
+	if responseMode := c.Query("response_mode"); responseMode != "" {
+		if !slices.Contains(responseModes, responseMode) {
+			authorizationError(c, request, "invalid_request", "Unsupported response_mode: "+responseMode)
+			return
+		}
+		if responseMode == ResponseModeQuery && request.ReturnsTokens() {
+			authorizationError(c, request, "invalid_request", "Tokens cannot be returned with response_mode=query")
+			return
+		}
+		request.ResponseMode = responseMode
+	}
+
+	if request.Returns(ResponseTypeCode) && !client.AllowsGrantType(GrantTypeAuthorizationCode) {
+		authorizationError(c, request, "unauthorized_client", "The client may not use the authorization code flow")
+		return
+	}
+	if request.ReturnsTokens() && !client.AllowsGrantType(GrantTypeImplicit) {
+		authorizationError(c, request, "unauthorized_client", "The client may not use the implicit or hybrid flow")
 		return
 	}
 
 	// Parse and validate scopes
-	scopes := h.oidcService.ParseScopes(scope)
-	if err := h.oidcService.ValidateScopes(scopes); err != nil {
-		redirectError(c, redirectURI, "invalid_scope", err.Error(), state)
+	request.Scopes = h.oidcService.ParseScopes(scope)
+	if err := h.oidcService.ValidateScopes(client, request.Scopes); err != nil {
+		authorizationError(c, request, "invalid_scope", err.Error())
+		return
+	}
+
+	// ID tokens from the authorization endpoint must be bound to the request with a nonce
+	if request.Returns(ResponseTypeIDToken) {
+		if !h.oidcService.containsScope(request.Scopes, ScopeOpenID) {
+			authorizationError(c, request, "invalid_scope", "The openid scope is required for id_token responses")
+			return
+		}
+		if request.Nonce == "" {
+			authorizationError(c, request, "invalid_request", "nonce is required for id_token responses")
+			return
+		}
+	}
+
+	// Validate PKCE parameters, which public clients must send to protect the code
+	codeChallengeMethod, err := ValidateCodeChallenge(codeChallenge, c.Query("code_challenge_method"))
+	if err != nil {
+		authorizationError(c, request, "invalid_request", err.Error())
 		return
 	}
+	if codeChallenge == "" && client.IsPublicClient() && request.Returns(ResponseTypeCode) {
+		authorizationError(c, request, "invalid_request", "code_challenge is required for public clients")
+		return
+	}
+	request.CodeChallenge = codeChallenge
+	request.CodeChallengeMethod = codeChallengeMethod
 
-	// Check if user is already authenticated (simple implementation)
+	// prompt and max_age decide whether the login session of the user may be reused
+	prompts := strings.Fields(c.Query("prompt"))
+	if slices.Contains(prompts, "none") && len(prompts) > 1 {
+		authorizationError(c, request, "invalid_request", "prompt=none cannot be combined with other values")
+		return
+	}
+	maxAge := -1
+	if value := c.Query("max_age"); value != "" {
+		maxAge, err = strconv.Atoi(value)
+		if err != nil || maxAge < 0 {
+			authorizationError(c, request, "invalid_request", "max_age must be a non-negative number of seconds")
+			return
+		}
+	}
+
+	// The login and consent forms post back to this endpoint
 	if c.Request.Method == "POST" {
-		h.handleLogin(c, clientID, redirectURI, scopes, state)
+		if decision := c.PostForm("consent"); decision != "" {
+			h.handleConsent(c, request, decision)
+			return
+		}
+		h.handleLogin(c, request, prompts)
+		return
+	}
+
+	session, loggedIn := h.currentSession(c)
+	if loggedIn && (slices.Contains(prompts, "login") || maxAge >= 0 && time.Since(session.CreatedAt) > time.Duration(maxAge)*time.Second) {
+		loggedIn = false
+	}
+
+	if loggedIn {
+		h.authorizeUser(c, request, session, prompts)
+		return
+	}
+	if slices.Contains(prompts, "none") {
+		authorizationError(c, request, "login_required", "The user must log in")
 		return
 	}
 
 	// Show login form
-	h.showLoginForm(c, clientID, redirectURI, scope, state)
+	h.showLoginForm(c, request)
+}
+
+// currentSession returns the login session of the browser, if any
+func (h *OIDCHandler) currentSession(c *gin.Context) (*Session, bool) {
+	sessionID, err := c.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil, false
+	}
+	return h.authService.ValidateSession(sessionID)
 }
 
 // handleLogin processes the login form submission
-func (h *OIDCHandler) handleLogin(c *gin.Context, clientID, redirectURI string, scopes []string, state string) {
+func (h *OIDCHandler) handleLogin(c *gin.Context, request *AuthRequest, prompts []string) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
 	if username == "" || password == "" {
-		h.showLoginForm(c, clientID, redirectURI, strings.Join(scopes, " "), state)
+		h.showLoginForm(c, request)
 		return
 	}
 
 	// Authenticate user
 	user, _, err := h.authService.Login(username, password)
 	if err != nil {
-		h.showLoginForm(c, clientID, redirectURI, strings.Join(scopes, " "), state)
+		h.showLoginForm(c, request)
+		return
+	}
+
+	session, ok := h.startSession(c, user)
+	if !ok {
 		return
 	}
 
-	// Generate authorization code
-	code, err := h.oidcService.GenerateAuthCode(clientID, user.ID, redirectURI, scopes)
+	h.authorizeUser(c, request, session, prompts)
+}
+
+// startSession keeps the user logged in at the provider for later authorization requests
+func (h *OIDCHandler) startSession(c *gin.Context, user *domain.User) (*Session, bool) {
+	session, err := h.authService.CreateSession(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":             "server_error",
-			"error_description": "Failed to generate authorization code",
+			"error_description": "Failed to create session",
 		})
+		return nil, false
+	}
+
+	// Lax sends the cookie on top-level redirects from clients, but not with cross-site form posts
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcSessionCookie, session.ID, 0, "/", "", false, true)
+	return session, true
+}
+
+// authorizeUser completes the authorization for the logged in user, or shows the consent
+// page first when the client requires consent for scopes the user has not granted yet, or
+// when the client asks for it with prompt=consent
+func (h *OIDCHandler) authorizeUser(c *gin.Context, request *AuthRequest, session *Session, prompts []string) {
+	client, _ := h.oidcService.Client(request.ClientID)
+	needsConsent := slices.Contains(prompts, "consent") ||
+		client.RequireConsent && !h.oidcService.HasConsent(session.UserID, client.ClientID, request.Scopes)
+
+	if !needsConsent {
+		h.completeAuthorization(c, request, session)
 		return
 	}
+	if slices.Contains(prompts, "none") {
+		authorizationError(c, request, "consent_required", "The user must grant the requested scopes")
+		return
+	}
+	h.showConsentForm(c, request, session)
+}
 
-	// Redirect back to client with code
-	redirectURL := fmt.Sprintf("%s?code=%s", redirectURI, code)
-	if state != "" {
-		redirectURL += fmt.Sprintf("&state=%s", url.QueryEscape(state))
+// handleConsent processes the consent form submission. The user may deselect scopes, and
+// the authorization then continues with the scopes granted.
+func (h *OIDCHandler) handleConsent(c *gin.Context, request *AuthRequest, decision string) {
+	session, ok := h.consentSession(c, request)
+	if !ok {
+		return
 	}
 
-	c.Redirect(http.StatusFound, redirectURL)
+	if decision != "approve" {
+		authorizationError(c, request, "access_denied", "The user denied the authorization request")
+		return
+	}
+
+	granted := grantedScopes(c, request.Scopes)
+	h.oidcService.GrantConsent(session.UserID, request.ClientID, granted)
+	request.Scopes = granted
+	h.completeAuthorization(c, request, session)
+}
+
+// consentSession returns the session a consent form was submitted with. A form without the
+// CSRF token of the session is rejected, so other sites cannot grant consent for the user.
+func (h *OIDCHandler) consentSession(c *gin.Context, request *AuthRequest) (*Session, bool) {
+	session, loggedIn := h.currentSession(c)
+	if !loggedIn {
+		h.showLoginForm(c, request)
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.PostForm("csrf_token")), []byte(session.CSRFToken)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":             "invalid_request",
+			"error_description": "Invalid CSRF token",
+		})
+		return nil, false
+	}
+	return session, true
+}
+
+// grantedScopes returns the scopes selected on the consent form. Required scopes cannot be deselected.
+func grantedScopes(c *gin.Context, scopes []string) []string {
+	selected := c.PostFormArray("granted_scopes")
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range consentScopes(scopes) {
+		if scope.Required || slices.Contains(selected, scope.Name) {
+			granted = append(granted, scope.Name)
+		}
+	}
+	return granted
+}
+
+// completeAuthorization returns the code and tokens of the response type to the client,
+// for the user of the session
+func (h *OIDCHandler) completeAuthorization(c *gin.Context, request *AuthRequest, session *Session) {
+	params := url.Values{}
+
+	var code string
+	if request.Returns(ResponseTypeCode) {
+		var err error
+		code, err = h.oidcService.GenerateAuthCode(request, session.UserID, session.CreatedAt)
+		if err != nil {
+			authorizationError(c, request, "server_error", "Failed to generate authorization code")
+			return
+		}
+		params.Set("code", code)
+	}
+
+	if request.ReturnsTokens() {
+		client, _ := h.oidcService.Client(request.ClientID)
+		user, exists := h.oidcService.userStore.GetByID(session.UserID)
+		if !exists {
+			authorizationError(c, request, "server_error", "User not found")
+			return
+		}
+
+		var accessToken string
+		if request.Returns(ResponseTypeToken) {
+			var err error
+			accessToken, err = h.oidcService.GenerateAccessToken(client, user, request.Scopes)
+			if err != nil {
+				authorizationError(c, request, "server_error", "Failed to generate access token")
+				return
+			}
+			params.Set("access_token", accessToken)
+			params.Set("token_type", "Bearer")
+			params.Set("expires_in", strconv.Itoa(int(client.AccessTokenLifetime().Seconds())))
+			params.Set("scope", strings.Join(request.Scopes, " "))
+		}
+
+		if request.Returns(ResponseTypeIDToken) {
+			idToken, err := h.oidcService.GenerateIDToken(client, user, request.Scopes, IDTokenParams{
+				AuthTime:    session.CreatedAt,
+				Nonce:       request.Nonce,
+				AccessToken: accessToken,
+				Code:        code,
+			})
+			if err != nil {
+				authorizationError(c, request, "server_error", "Failed to generate ID token")
+				return
+			}
+			params.Set("id_token", idToken)
+		}
+	}
+
+	writeAuthorizationResponse(c, request, params)
 }
 
 // showLoginForm displays the login form
-func (h *OIDCHandler) showLoginForm(c *gin.Context, clientID, redirectURI, scope, state string) {
+func (h *OIDCHandler) showLoginForm(c *gin.Context, request *AuthRequest) {
 	c.HTML(http.StatusOK, "login.html", gin.H{
-		"ClientID":    clientID,
-		"RedirectURI": redirectURI,
-		"Scope":       scope,
-		"State":       state,
+		"ClientID":    request.ClientID,
+		"RedirectURI": request.RedirectURI,
+		"Scope":       strings.Join(request.Scopes, " "),
+		"State":       request.State,
+	})
+}
+
+// showConsentForm displays the consent page for the scopes of the request
+func (h *OIDCHandler) showConsentForm(c *gin.Context, request *AuthRequest, session *Session) {
+	c.HTML(http.StatusOK, "consent.html", gin.H{
+		"ClientID":  request.ClientID,
+		"Scopes":    consentScopes(request.Scopes),
+		"CSRFToken": session.CSRFToken,
 	})
 }
 
@@ -184,31 +433,166 @@ func (h *OIDCHandler) handleRegisterPOST(c *gin.Context) {
 // Token handles the token endpoint
 func (h *OIDCHandler) Token(c *gin.Context) {
 	grantType := c.PostForm("grant_type")
-	code := c.PostForm("code")
-	redirectURI := c.PostForm("redirect_uri")
-	clientID := c.PostForm("client_id")
-	clientSecret := c.PostForm("client_secret")
 
 	// Validate grant type
-	if grantType != "authorization_code" {
+	if !slices.Contains(supportedGrantTypes, grantType) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":             "unsupported_grant_type",
-			"error_description": "Only authorization_code grant type is supported",
+			"error_description": "Supported grant types are " + strings.Join(supportedGrantTypes, ", "),
 		})
 		return
 	}
 
-	// Validate client credentials
-	if clientID != h.oidcService.config.ClientID || clientSecret != h.oidcService.config.ClientSecret {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":             "invalid_client",
-			"error_description": "Invalid client credentials",
+	// Public clients have no credentials and prove possession of the authorization code
+	// with the PKCE code verifier instead
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrantType(grantType) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "unauthorized_client",
+			"error_description": "The client may not use this grant type",
 		})
 		return
 	}
 
+	switch grantType {
+	case GrantTypeAuthorizationCode:
+		h.authorizationCodeGrant(c, client)
+	case GrantTypeRefreshToken:
+		h.refreshTokenGrant(c, client)
+	case GrantTypeClientCredentials:
+		h.clientCredentialsGrant(c, client)
+	case GrantTypeDeviceCode:
+		h.deviceCodeGrant(c, client)
+	}
+}
+
+// authenticateClient checks the client credentials of a request to the token, introspection
+// or revocation endpoint. Clients authenticate with HTTP Basic, client_secret in the form,
+// or a private_key_jwt client assertion; public clients send their client_id alone. On
+// failure the error response has been written.
+func (h *OIDCHandler) authenticateClient(c *gin.Context) (*OIDCClient, bool) {
+	credentials, ok := h.clientCredentials(c)
+	if !ok {
+		return nil, false
+	}
+
+	endpoint := h.oidcService.config.Issuer + c.Request.URL.Path
+	client, err := h.oidcService.AuthenticateClient(credentials, endpoint)
+	if err != nil {
+		h.invalidClient(c, err.Error())
+		return nil, false
+	}
+	return client, true
+}
+
+// clientCredentials reads the client credentials of a request. A request may use only one
+// authentication method (RFC 6749 section 2.3). On failure the error response has been written.
+func (h *OIDCHandler) clientCredentials(c *gin.Context) (ClientCredentials, bool) {
+	clientID := c.PostForm("client_id")
+	secret := c.PostForm("client_secret")
+	assertion := c.PostForm("client_assertion")
+	assertionType := c.PostForm("client_assertion_type")
+	basicID, basicSecret, hasBasic := c.Request.BasicAuth()
+
+	if !hasBasic && strings.HasPrefix(strings.ToLower(c.GetHeader("Authorization")), "basic ") {
+		h.invalidClient(c, "Malformed Basic authorization header")
+		return ClientCredentials{}, false
+	}
+
+	methods := 0
+	for _, used := range []bool{hasBasic, secret != "", assertion != "" || assertionType != ""} {
+		if used {
+			methods++
+		}
+	}
+	if methods > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "Only one client authentication method may be used",
+		})
+		return ClientCredentials{}, false
+	}
+
+	switch {
+	case hasBasic:
+		// The client ID and secret are form-encoded before Basic encoding (RFC 6749 section 2.3.1)
+		id, idErr := url.QueryUnescape(basicID)
+		password, secretErr := url.QueryUnescape(basicSecret)
+		if idErr != nil || secretErr != nil {
+			h.invalidClient(c, "Malformed Basic authorization header")
+			return ClientCredentials{}, false
+		}
+		if clientID != "" && clientID != id {
+			h.invalidClient(c, "client_id does not match the authenticated client")
+			return ClientCredentials{}, false
+		}
+		return ClientCredentials{Method: ClientAuthMethodSecretBasic, ClientID: id, ClientSecret: password}, true
+	case secret != "":
+		return ClientCredentials{Method: ClientAuthMethodSecretPost, ClientID: clientID, ClientSecret: secret}, true
+	case assertion != "" || assertionType != "":
+		if assertionType != ClientAssertionTypeJWTBearer || assertion == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "client_assertion and a client_assertion_type of " + ClientAssertionTypeJWTBearer + " are required",
+			})
+			return ClientCredentials{}, false
+		}
+		return ClientCredentials{Method: ClientAuthMethodPrivateKeyJWT, ClientID: clientID, Assertion: assertion}, true
+	default:
+		return ClientCredentials{Method: ClientAuthMethodNone, ClientID: clientID}, true
+	}
+}
+
+// invalidClient writes an invalid_client error. RFC 6749 section 5.2 requires a 401 with a
+// WWW-Authenticate challenge when the client used HTTP Basic; the same response is used for
+// every method.
+func (h *OIDCHandler) invalidClient(c *gin.Context, description string) {
+	c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", h.oidcService.config.Issuer))
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":             "invalid_client",
+		"error_description": description,
+	})
+}
+
+// authorizationCodeGrant exchanges an authorization code for tokens
+func (h *OIDCHandler) authorizationCodeGrant(c *gin.Context, client *OIDCClient) {
+	code := c.PostForm("code")
+	redirectURI := c.PostForm("redirect_uri")
+	codeVerifier := c.PostForm("code_verifier")
+
 	// Validate and consume authorization code
-	authCode, err := h.oidcService.ValidateAuthCode(code, clientID, redirectURI)
+	authCode, err := h.oidcService.ValidateAuthCode(code, client.ClientID, redirectURI, codeVerifier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_grant",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	// Refresh tokens are only issued when offline access was granted
+	var refreshToken string
+	if h.oidcService.containsScope(authCode.Scopes, ScopeOfflineAccess) && client.AllowsGrantType(GrantTypeRefreshToken) {
+		refreshToken, err = h.oidcService.IssueRefreshToken(client, authCode.UserID, authCode.Scopes, authCode.AuthTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":             "server_error",
+				"error_description": "Failed to generate refresh token",
+			})
+			return
+		}
+	}
+
+	h.respondWithUserTokens(c, client, authCode.UserID, authCode.Scopes, authCode.AuthTime, authCode.Nonce, refreshToken)
+}
+
+// refreshTokenGrant rotates a refresh token and issues new tokens with the original scopes
+func (h *OIDCHandler) refreshTokenGrant(c *gin.Context, client *OIDCClient) {
+	rotated, err := h.oidcService.RotateRefreshToken(client, c.PostForm("refresh_token"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":             "invalid_grant",
@@ -217,8 +601,218 @@ func (h *OIDCHandler) Token(c *gin.Context) {
 		return
 	}
 
+	// The nonce belongs to the authorization request and is not repeated in refreshed ID tokens
+	h.respondWithUserTokens(c, client, rotated.UserID, rotated.Scopes, rotated.AuthTime, "", rotated.Token)
+}
+
+// clientCredentialsGrant issues an access token for the client itself, without a user
+func (h *OIDCHandler) clientCredentialsGrant(c *gin.Context, client *OIDCClient) {
+	scopes := h.oidcService.ParseScopes(c.PostForm("scope"))
+	if err := h.oidcService.ValidateScopes(client, scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_scope",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	accessToken, err := h.oidcService.GenerateClientAccessToken(client, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             "server_error",
+			"error_description": "Failed to generate access token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(client.AccessTokenLifetime().Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	})
+}
+
+// deviceCodeGrant issues tokens to a device once the user approved its device code. Until
+// then the device polls and gets authorization_pending, or slow_down when it polls too fast.
+func (h *OIDCHandler) deviceCodeGrant(c *gin.Context, client *OIDCClient) {
+	authorization, err := h.oidcService.PollDeviceAuthorization(c.PostForm("device_code"), client.ClientID)
+	if err != nil {
+		errorCode := "invalid_grant"
+		switch {
+		case errors.Is(err, ErrAuthorizationPending):
+			errorCode = "authorization_pending"
+		case errors.Is(err, ErrSlowDown):
+			errorCode = "slow_down"
+		case errors.Is(err, ErrExpiredToken):
+			errorCode = "expired_token"
+		case errors.Is(err, ErrAccessDenied):
+			errorCode = "access_denied"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             errorCode,
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	var refreshToken string
+	if h.oidcService.containsScope(authorization.Scopes, ScopeOfflineAccess) && client.AllowsGrantType(GrantTypeRefreshToken) {
+		refreshToken, err = h.oidcService.IssueRefreshToken(client, authorization.UserID, authorization.Scopes, authorization.AuthTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":             "server_error",
+				"error_description": "Failed to generate refresh token",
+			})
+			return
+		}
+	}
+
+	h.respondWithUserTokens(c, client, authorization.UserID, authorization.Scopes, authorization.AuthTime, "", refreshToken)
+}
+
+// DeviceAuthorization handles the device authorization endpoint (RFC 8628). A device that
+// cannot show a browser gets a device code to poll the token endpoint with, and a user code
+// the user enters at the verification page on another device.
+func (h *OIDCHandler) DeviceAuthorization(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	if !client.AllowsGrantType(GrantTypeDeviceCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "unauthorized_client",
+			"error_description": "The client may not use the device authorization grant",
+		})
+		return
+	}
+
+	scopes := h.oidcService.ParseScopes(c.PostForm("scope"))
+	if err := h.oidcService.ValidateScopes(client, scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_scope",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	authorization, err := h.oidcService.StartDeviceAuthorization(client, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             "server_error",
+			"error_description": "Failed to generate device code",
+		})
+		return
+	}
+
+	verificationURI := h.oidcService.config.Issuer + "/auth/device"
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               authorization.DeviceCode,
+		"user_code":                 authorization.UserCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(authorization.UserCode),
+		"expires_in":                int(time.Until(authorization.ExpiresAt).Round(time.Second).Seconds()),
+		"interval":                  int(authorization.Interval.Seconds()),
+	})
+}
+
+// DeviceVerification handles the verification page of the device authorization grant. The
+// user enters the user code shown by the device, then logs in with the login form to
+// approve the device. Clients that require consent show the consent page after the login,
+// as the authorization endpoint does.
+func (h *OIDCHandler) DeviceVerification(c *gin.Context) {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		h.showDeviceForm(c, "", "")
+		return
+	}
+
+	authorization, exists := h.oidcService.LookupUserCode(userCode)
+	if !exists {
+		h.showDeviceForm(c, "Invalid or expired code. Check the code shown on your device.", "")
+		return
+	}
+	request := &AuthRequest{ClientID: authorization.ClientID, Scopes: authorization.Scopes}
+
+	if c.Request.Method == "GET" {
+		h.showLoginForm(c, request)
+		return
+	}
+
+	if decision := c.PostForm("consent"); decision != "" {
+		h.handleDeviceConsent(c, userCode, request, decision)
+		return
+	}
+
+	username := c.PostForm("username")
+	password := c.PostForm("password")
+	if username == "" || password == "" {
+		h.showLoginForm(c, request)
+		return
+	}
+
+	user, _, err := h.authService.Login(username, password)
+	if err != nil {
+		h.showLoginForm(c, request)
+		return
+	}
+
+	session, ok := h.startSession(c, user)
+	if !ok {
+		return
+	}
+
+	client, _ := h.oidcService.Client(request.ClientID)
+	if client != nil && client.RequireConsent && !h.oidcService.HasConsent(session.UserID, client.ClientID, request.Scopes) {
+		h.showConsentForm(c, request, session)
+		return
+	}
+
+	h.approveDevice(c, userCode, session, request.Scopes)
+}
+
+// handleDeviceConsent processes the consent form of the device verification page
+func (h *OIDCHandler) handleDeviceConsent(c *gin.Context, userCode string, request *AuthRequest, decision string) {
+	session, ok := h.consentSession(c, request)
+	if !ok {
+		return
+	}
+
+	if decision != "approve" {
+		h.oidcService.DenyDeviceAuthorization(userCode)
+		h.showDeviceForm(c, "You denied access to the device.", "")
+		return
+	}
+
+	granted := grantedScopes(c, request.Scopes)
+	h.oidcService.GrantConsent(session.UserID, request.ClientID, granted)
+	h.approveDevice(c, userCode, session, granted)
+}
+
+// approveDevice grants the device of the user code the scopes on behalf of the user of the session
+func (h *OIDCHandler) approveDevice(c *gin.Context, userCode string, session *Session, scopes []string) {
+	if err := h.oidcService.ApproveDeviceAuthorization(userCode, session.UserID, scopes, session.CreatedAt); err != nil {
+		h.showDeviceForm(c, "Invalid or expired code. Check the code shown on your device.", "")
+		return
+	}
+
+	h.showDeviceForm(c, "", "Your device has been connected. You can return to it now.")
+}
+
+// showDeviceForm displays the form to enter a user code
+func (h *OIDCHandler) showDeviceForm(c *gin.Context, errorMsg, successMsg string) {
+	c.HTML(http.StatusOK, "device.html", gin.H{
+		"Error":   errorMsg,
+		"Success": successMsg,
+	})
+}
+
+// respondWithUserTokens writes the token response for a user: an access token, an ID token
+// if openid was requested, and the refresh token if any. authTime and nonce go into the ID token.
+func (h *OIDCHandler) respondWithUserTokens(c *gin.Context, client *OIDCClient, userID int, scopes []string, authTime time.Time, nonce, refreshToken string) {
 	// Get user
-	user, exists := h.oidcService.userStore.GetByID(authCode.UserID)
+	user, exists := h.oidcService.userStore.GetByID(userID)
 	if !exists {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":             "server_error",
@@ -228,7 +822,7 @@ func (h *OIDCHandler) Token(c *gin.Context) {
 	}
 
 	// Generate access token
-	accessToken, err := h.oidcService.GenerateAccessToken(user, authCode.Scopes)
+	accessToken, err := h.oidcService.GenerateAccessToken(client, user, scopes)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":             "server_error",
@@ -239,8 +833,8 @@ func (h *OIDCHandler) Token(c *gin.Context) {
 
 	// Generate ID token if openid scope is requested
 	var idToken string
-	if h.oidcService.containsScope(authCode.Scopes, "openid") {
-		idToken, err = h.oidcService.GenerateIDToken(user, authCode.Scopes)
+	if h.oidcService.containsScope(scopes, ScopeOpenID) {
+		idToken, err = h.oidcService.GenerateIDToken(client, user, scopes, IDTokenParams{AuthTime: authTime, Nonce: nonce, AccessToken: accessToken})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":             "server_error",
@@ -254,17 +848,248 @@ func (h *OIDCHandler) Token(c *gin.Context) {
 	response := gin.H{
 		"access_token": accessToken,
 		"token_type":   "Bearer",
-		"expires_in":   3600,
-		"scope":        strings.Join(authCode.Scopes, " "),
+		"expires_in":   int(client.AccessTokenLifetime().Seconds()),
+		"scope":        strings.Join(scopes, " "),
 	}
 
 	if idToken != "" {
 		response["id_token"] = idToken
 	}
+	if refreshToken != "" {
+		response["refresh_token"] = refreshToken
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// Introspect handles the token introspection endpoint (RFC 7662). Only confidential
+// clients, such as API gateways, may introspect tokens.
+func (h *OIDCHandler) Introspect(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if client.IsPublicClient() {
+		h.invalidClient(c, "Public clients may not introspect tokens")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "token is required",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.oidcService.IntrospectToken(token))
+}
+
+// Revoke handles the token revocation endpoint (RFC 7009). The response is the same
+// whether or not the token was valid.
+func (h *OIDCHandler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "token is required",
+		})
+		return
+	}
+
+	h.oidcService.RevokeToken(client, token)
+	c.Status(http.StatusOK)
+}
+
+// EndSession handles the end_session endpoint (OpenID Connect RP-Initiated Logout). It ends
+// the login session and redirects to the post_logout_redirect_uri if one is given, which must
+// be registered for the client named by id_token_hint or client_id.
+func (h *OIDCHandler) EndSession(c *gin.Context) {
+	clientID := c.Request.FormValue("client_id")
+	postLogoutRedirectURI := c.Request.FormValue("post_logout_redirect_uri")
+	state := c.Request.FormValue("state")
+
+	if idTokenHint := c.Request.FormValue("id_token_hint"); idTokenHint != "" {
+		claims, err := h.oidcService.ValidateIDTokenHint(idTokenHint)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "Invalid id_token_hint: " + err.Error(),
+			})
+			return
+		}
+		if clientID != "" && clientID != tokenClientID(claims) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "client_id does not match the id_token_hint",
+			})
+			return
+		}
+		clientID = tokenClientID(claims)
+	}
+
+	var redirectURL *url.URL
+	if postLogoutRedirectURI != "" {
+		client, exists := h.oidcService.Client(clientID)
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "post_logout_redirect_uri requires an id_token_hint or client_id",
+			})
+			return
+		}
+		parsed, err := url.Parse(postLogoutRedirectURI)
+		if err != nil || !client.ValidatePostLogoutRedirectURI(postLogoutRedirectURI) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "Invalid post_logout_redirect_uri",
+			})
+			return
+		}
+		redirectURL = parsed
+	}
+
+	if sessionID, err := c.Cookie(oidcSessionCookie); err == nil {
+		h.authService.DestroySession(sessionID)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcSessionCookie, "", -1, "/", "", false, true)
+
+	if redirectURL == nil {
+		c.HTML(http.StatusOK, "logout.html", gin.H{})
+		return
+	}
+
+	if state != "" {
+		query := redirectURL.Query()
+		query.Set("state", state)
+		redirectURL.RawQuery = query.Encode()
+	}
+	c.Redirect(http.StatusFound, redirectURL.String())
+}
+
+// RegisterClient handles the dynamic client registration endpoint (RFC 7591). Registration
+// is open, so every test can register its own client with its own redirect URIs.
+func (h *OIDCHandler) RegisterClient(c *gin.Context) {
+	var metadata ClientMetadata
+	if err := c.ShouldBindJSON(&metadata); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_client_metadata",
+			"error_description": "Invalid client metadata: " + err.Error(),
+		})
+		return
+	}
+
+	info, err := h.oidcService.RegisterClient(metadata)
+	if err != nil {
+		h.registrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+// GetClientRegistration returns the registration of a client to the holder of its
+// registration access token (RFC 7592)
+func (h *OIDCHandler) GetClientRegistration(c *gin.Context) {
+	info, err := h.oidcService.ReadClientRegistration(c.Param("client_id"), registrationToken(c))
+	if err != nil {
+		h.registrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// UpdateClientRegistration replaces the metadata of a client (RFC 7592). The request may
+// repeat client_id and client_secret, which must match the registration.
+func (h *OIDCHandler) UpdateClientRegistration(c *gin.Context) {
+	clientID := c.Param("client_id")
+	token := registrationToken(c)
+
+	var request struct {
+		ClientMetadata
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_client_metadata",
+			"error_description": "Invalid client metadata: " + err.Error(),
+		})
+		return
+	}
+
+	current, err := h.oidcService.ReadClientRegistration(clientID, token)
+	if err != nil {
+		h.registrationError(c, err)
+		return
+	}
+	if request.ClientID != "" && request.ClientID != clientID || request.ClientSecret != "" && request.ClientSecret != current.ClientSecret {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_client_metadata",
+			"error_description": "client_id and client_secret cannot be changed",
+		})
+		return
+	}
+
+	info, err := h.oidcService.UpdateClientRegistration(clientID, token, request.ClientMetadata)
+	if err != nil {
+		h.registrationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// DeleteClientRegistration deletes a client (RFC 7592)
+func (h *OIDCHandler) DeleteClientRegistration(c *gin.Context) {
+	if err := h.oidcService.DeleteClientRegistration(c.Param("client_id"), registrationToken(c)); err != nil {
+		h.registrationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// registrationToken returns the registration access token of the Authorization header
+func registrationToken(c *gin.Context) string {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return token
+}
+
+// registrationError writes the error response of the registration endpoints
+func (h *OIDCHandler) registrationError(c *gin.Context, err error) {
+	var registrationErr *RegistrationError
+	switch {
+	case errors.Is(err, ErrInvalidRegistrationToken):
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":             "invalid_token",
+			"error_description": err.Error(),
+		})
+	case errors.As(err, &registrationErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             registrationErr.Code,
+			"error_description": registrationErr.Description,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+	}
+}
+
 // UserInfo handles the userinfo endpoint
 func (h *OIDCHandler) UserInfo(c *gin.Context) {
 	// Get access token from Authorization header
@@ -339,15 +1164,3 @@ func (h *OIDCHandler) GetOpenIDConfiguration(c *gin.Context) {
 	config := h.oidcService.GetOpenIDConfiguration()
 	c.JSON(http.StatusOK, config)
 }
-
-// redirectError redirects back to client with an error
-func redirectError(c *gin.Context, redirectURI, errorCode, errorDescription, state string) {
-	redirectURL := fmt.Sprintf("%s?error=%s&error_description=%s",
-		redirectURI, url.QueryEscape(errorCode), url.QueryEscape(errorDescription))
-
-	if state != "" {
-		redirectURL += fmt.Sprintf("&state=%s", url.QueryEscape(state))
-	}
-
-	c.Redirect(http.StatusFound, redirectURL)
-}
@@ -5,30 +5,55 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/KasumiMercury/mock-todo-server/server/domain"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthCode represents an authorization code
-type AuthCode struct {
-	Code        string
+// AuthRequest holds the parameters of a validated authorization request
+type AuthRequest struct {
 	ClientID    string
-	UserID      int
 	RedirectURI string
 	Scopes      []string
-	ExpiresAt   time.Time
+	State       string
+	Nonce       string
+	// ResponseTypes are the values of response_type, ResponseMode how the response is returned
+	ResponseTypes []string
+	ResponseMode  string
+	// CodeChallenge and CodeChallengeMethod are set when the client uses PKCE
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthCode represents an authorization code
+type AuthCode struct {
+	Code string
+	AuthRequest
+	UserID int
+	// AuthTime is when the user logged in
+	AuthTime  time.Time
+	ExpiresAt time.Time
 }
 
 // OIDCService handles OIDC provider functionality
 type OIDCService struct {
-	config      *OIDCConfig
-	authCodes   map[string]*AuthCode // In-memory storage for auth codes
-	userStore   UserStore
-	keyMode     JWTKeyMode
-	secretKey   []byte
-	authService *AuthService
+	config    *OIDCConfig
+	authCodes map[string]*AuthCode // In-memory storage for auth codes
+	// deviceAuthorizations holds the pending device codes, userCodes maps user codes to them
+	deviceAuthorizations map[string]*DeviceAuthorization
+	userCodes            map[string]string
+	// consents holds the scopes each user granted to each client
+	consents map[consentKey][]string
+	mu       sync.Mutex
+	// usedAssertions holds the client assertions that have been used, to prevent replay
+	usedAssertions *RevocationList
+	userStore      UserStore
+	clientStore    ClientStore
+	keyMode        JWTKeyMode
+	secretKey      []byte
+	authService    *AuthService
 }
 
 type UserStore interface {
@@ -37,17 +62,23 @@ type UserStore interface {
 }
 
 // NewOIDCService creates a new OIDC service
-func NewOIDCService(config *OIDCConfig, userStore UserStore, authService *AuthService) *OIDCService {
+func NewOIDCService(config *OIDCConfig, userStore UserStore, clientStore ClientStore, authService *AuthService) *OIDCService {
 	return &OIDCService{
-		config:      config,
-		authCodes:   make(map[string]*AuthCode),
-		userStore:   userStore,
-		authService: authService,
+		config:               config,
+		authCodes:            make(map[string]*AuthCode),
+		deviceAuthorizations: make(map[string]*DeviceAuthorization),
+		userCodes:            make(map[string]string),
+		consents:             make(map[consentKey][]string),
+		usedAssertions:       NewRevocationList(),
+		userStore:            userStore,
+		clientStore:          clientStore,
+		authService:          authService,
 	}
 }
 
-// GenerateAuthCode generates a new authorization code
-func (s *OIDCService) GenerateAuthCode(clientID string, userID int, redirectURI string, scopes []string) (string, error) {
+// GenerateAuthCode generates a new authorization code for the request, bound to its PKCE
+// code challenge if any
+func (s *OIDCService) GenerateAuthCode(request *AuthRequest, userID int, authTime time.Time) (string, error) {
 	// Generate random code
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -57,20 +88,26 @@ func (s *OIDCService) GenerateAuthCode(clientID string, userID int, redirectURI
 	code := base64.URLEncoding.EncodeToString(bytes)
 
 	// Store auth code
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.authCodes[code] = &AuthCode{
 		Code:        code,
-		ClientID:    clientID,
+		AuthRequest: *request,
 		UserID:      userID,
-		RedirectURI: redirectURI,
-		Scopes:      scopes,
+		AuthTime:    authTime,
 		ExpiresAt:   time.Now().Add(10 * time.Minute), // 10 minutes expiry
 	}
 
 	return code, nil
 }
 
-// ValidateAuthCode validates and consumes an authorization code
-func (s *OIDCService) ValidateAuthCode(code, clientID, redirectURI string) (*AuthCode, error) {
+// ValidateAuthCode validates and consumes an authorization code. A code issued with a
+// PKCE code challenge requires the matching code verifier.
+func (s *OIDCService) ValidateAuthCode(code, clientID, redirectURI, codeVerifier string) (*AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	authCode, exists := s.authCodes[code]
 	if !exists {
 		return nil, fmt.Errorf("invalid authorization code")
@@ -91,50 +128,230 @@ func (s *OIDCService) ValidateAuthCode(code, clientID, redirectURI string) (*Aut
 		return nil, fmt.Errorf("redirect URI mismatch")
 	}
 
+	if authCode.CodeChallenge == "" {
+		if codeVerifier != "" {
+			return nil, fmt.Errorf("code_verifier sent for a code issued without code_challenge")
+		}
+	} else {
+		if codeVerifier == "" {
+			return nil, fmt.Errorf("code_verifier is required")
+		}
+		if err := verifyCodeVerifier(codeVerifier, authCode.CodeChallenge, authCode.CodeChallengeMethod); err != nil {
+			return nil, err
+		}
+	}
+
 	// Consume the code (one-time use)
 	delete(s.authCodes, code)
 
 	return authCode, nil
 }
 
-// GenerateIDToken generates an OpenID Connect ID token
-func (s *OIDCService) GenerateIDToken(user *domain.User, scopes []string) (string, error) {
+// ClearAuthCodes invalidates all issued authorization codes and device codes
+func (s *OIDCService) ClearAuthCodes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authCodes = make(map[string]*AuthCode)
+	s.deviceAuthorizations = make(map[string]*DeviceAuthorization)
+	s.userCodes = make(map[string]string)
+}
+
+// IDTokenParams are the values of an authentication an ID token is bound to
+type IDTokenParams struct {
+	// AuthTime is when the user logged in
+	AuthTime time.Time
+	// Nonce is the value of the authorization request
+	Nonce string
+	// AccessToken and Code are issued along with the ID token, for the at_hash and c_hash claims
+	AccessToken string
+	Code        string
+}
+
+// GenerateIDToken generates an OpenID Connect ID token for the client
+func (s *OIDCService) GenerateIDToken(client *OIDCClient, user *domain.User, scopes []string, params IDTokenParams) (string, error) {
 	now := time.Now()
 
 	claims := jwt.MapClaims{
 		"iss": s.config.Issuer,
 		"sub": fmt.Sprintf("%d", user.ID),
-		"aud": s.config.ClientID,
+		"aud": client.ClientID,
+		"azp": client.ClientID,
 		"iat": now.Unix(),
-		"exp": now.Add(1 * time.Hour).Unix(),
+		"exp": now.Add(client.IDTokenLifetime()).Unix(),
+		"acr": ACRPassword,
+		"amr": []string{"pwd"},
 	}
 
-	// Add profile information based on requested scopes
-	if s.containsScope(scopes, "profile") {
-		claims["name"] = user.Username
-		claims["preferred_username"] = user.Username
+	if !params.AuthTime.IsZero() {
+		claims["auth_time"] = params.AuthTime.Unix()
+	}
+	if params.Nonce != "" {
+		claims["nonce"] = params.Nonce
+	}
+	if params.AccessToken != "" {
+		claims["at_hash"] = tokenHash(s.authService.Algorithm(), params.AccessToken)
+	}
+	if params.Code != "" {
+		claims["c_hash"] = tokenHash(s.authService.Algorithm(), params.Code)
 	}
 
+	// Add profile information based on requested scopes
+	s.addScopeClaims(claims, user, scopes)
+
 	// Use existing auth service to generate token
 	return s.authService.generateJWTWithClaims(claims)
 }
 
-// GenerateAccessToken generates an access token
-func (s *OIDCService) GenerateAccessToken(user *domain.User, scopes []string) (string, error) {
+// GenerateAccessToken generates an access token for the client
+func (s *OIDCService) GenerateAccessToken(client *OIDCClient, user *domain.User, scopes []string) (string, error) {
 	now := time.Now()
 
 	claims := jwt.MapClaims{
 		"sub":   fmt.Sprintf("%d", user.ID),
 		"iat":   now.Unix(),
-		"exp":   now.Add(1 * time.Hour).Unix(),
+		"exp":   now.Add(client.AccessTokenLifetime()).Unix(),
 		"scope": strings.Join(scopes, " "),
 		"iss":   s.config.Issuer,
-		"aud":   s.config.ClientID,
+		"aud":   client.ClientID,
+	}
+
+	return s.authService.generateJWTWithClaims(claims)
+}
+
+// GenerateClientAccessToken generates an access token for a client acting on its own behalf.
+// The token has no user subject.
+func (s *OIDCService) GenerateClientAccessToken(client *OIDCClient, scopes []string) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"client_id": client.ClientID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(client.AccessTokenLifetime()).Unix(),
+		"scope":     strings.Join(scopes, " "),
+		"iss":       s.config.Issuer,
+		"aud":       client.ClientID,
 	}
 
 	return s.authService.generateJWTWithClaims(claims)
 }
 
+// IssueRefreshToken starts a refresh token family for the user and client
+func (s *OIDCService) IssueRefreshToken(client *OIDCClient, userID int, scopes []string, authTime time.Time) (string, error) {
+	refreshToken, err := s.authService.refreshTokens.Issue(userID, client.ClientID, scopes, authTime, client.RefreshTokenLifetime())
+	if err != nil {
+		return "", err
+	}
+	return refreshToken.Token, nil
+}
+
+// RotateRefreshToken consumes a refresh token issued to the client and returns its successor
+func (s *OIDCService) RotateRefreshToken(client *OIDCClient, refreshToken string) (*RefreshToken, error) {
+	return s.authService.refreshTokens.Rotate(refreshToken, client.ClientID, client.RefreshTokenLifetime())
+}
+
+// IntrospectToken describes an access or refresh token as specified by RFC 7662.
+// Invalid, expired and revoked tokens are reported as inactive.
+func (s *OIDCService) IntrospectToken(token string) map[string]interface{} {
+	if refreshToken, ok := s.authService.refreshTokens.Lookup(token); ok && refreshToken.ClientID != "" {
+		response := map[string]interface{}{
+			"active":     true,
+			"token_type": "refresh_token",
+			"client_id":  refreshToken.ClientID,
+			"sub":        fmt.Sprintf("%d", refreshToken.UserID),
+			"scope":      strings.Join(refreshToken.Scopes, " "),
+			"exp":        refreshToken.ExpiresAt.Unix(),
+			"iss":        s.config.Issuer,
+		}
+		s.addUsername(response, refreshToken.UserID)
+		return response
+	}
+
+	parsed, err := s.authService.ValidateToken(token)
+	if err != nil || !parsed.Valid {
+		return map[string]interface{}{"active": false}
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return map[string]interface{}{"active": false}
+	}
+
+	response := map[string]interface{}{
+		"active":     true,
+		"token_type": "Bearer",
+		"client_id":  tokenClientID(claims),
+	}
+	for _, claim := range []string{"sub", "scope", "exp", "iat", "iss", "aud", "jti"} {
+		if value, exists := claims[claim]; exists {
+			response[claim] = value
+		}
+	}
+	if userID, err := s.authService.GetUserIDFromToken(parsed); err == nil {
+		s.addUsername(response, userID)
+	}
+	return response
+}
+
+// RevokeToken revokes an access or refresh token issued to the client as specified by
+// RFC 7009. Revoking a refresh token revokes every token rotated from the same login.
+// Invalid tokens and tokens of other clients are ignored.
+func (s *OIDCService) RevokeToken(client *OIDCClient, token string) {
+	if refreshToken, ok := s.authService.refreshTokens.Lookup(token); ok {
+		if refreshToken.ClientID == client.ClientID {
+			s.authService.refreshTokens.Revoke(token)
+		}
+		return
+	}
+
+	parsed, err := s.authService.ValidateToken(token)
+	if err != nil || !parsed.Valid {
+		return
+	}
+	if claims, ok := parsed.Claims.(jwt.MapClaims); ok && tokenClientID(claims) == client.ClientID {
+		s.authService.RevokeToken(parsed)
+	}
+}
+
+// ValidateIDTokenHint checks the id_token_hint of a logout request and returns its claims.
+// The hint must be an ID token of this provider but may have expired.
+func (s *OIDCService) ValidateIDTokenHint(hint string) (jwt.MapClaims, error) {
+	token, err := s.authService.parseToken(hint, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	if issuer, _ := claims.GetIssuer(); issuer != s.config.Issuer {
+		return nil, fmt.Errorf("the token was not issued by this provider")
+	}
+	if _, exists := s.Client(tokenClientID(claims)); !exists {
+		return nil, fmt.Errorf("the token was issued to an unknown client")
+	}
+	return claims, nil
+}
+
+// tokenClientID returns the client a token was issued to
+func tokenClientID(claims jwt.MapClaims) string {
+	if clientID, ok := claims["client_id"].(string); ok {
+		return clientID
+	}
+	audience, _ := claims.GetAudience()
+	if len(audience) > 0 {
+		return audience[0]
+	}
+	return ""
+}
+
+// addUsername adds the username of the user to an introspection response
+func (s *OIDCService) addUsername(response map[string]interface{}, userID int) {
+	if user, exists := s.userStore.GetByID(userID); exists {
+		response["username"] = user.Username
+	}
+}
+
 // ValidateAccessToken validates an access token
 func (s *OIDCService) ValidateAccessToken(tokenString string) (*jwt.Token, error) {
 	return s.authService.ValidateToken(tokenString)
@@ -151,28 +368,60 @@ func (s *OIDCService) GetUserInfo(userID int, scopes []string) (map[string]inter
 		"sub": fmt.Sprintf("%d", user.ID),
 	}
 
-	if s.containsScope(scopes, "profile") {
-		userInfo["name"] = user.Username
-		userInfo["preferred_username"] = user.Username
-	}
+	s.addScopeClaims(userInfo, user, scopes)
 
 	return userInfo, nil
 }
 
+// addScopeClaims adds the claims of the user that the scopes grant access to
+func (s *OIDCService) addScopeClaims(claims map[string]interface{}, user *domain.User, scopes []string) {
+	if s.containsScope(scopes, ScopeProfile) {
+		claims["name"] = user.Username
+		claims["preferred_username"] = user.Username
+	}
+	if s.containsScope(scopes, ScopeEmail) && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if s.containsScope(scopes, ScopePhone) && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = user.PhoneNumberVerified
+	}
+	if s.containsScope(scopes, ScopeAddress) && user.Address != nil {
+		claims["address"] = user.Address
+	}
+}
+
+// supportedClaims lists the claims ID tokens and the userinfo endpoint may contain
+var supportedClaims = []string{
+	"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "azp", "acr", "amr", "at_hash", "c_hash",
+	"name", "preferred_username", "email", "email_verified", "phone_number", "phone_number_verified", "address",
+}
+
 // GetOpenIDConfiguration returns the OpenID Connect discovery document
 func (s *OIDCService) GetOpenIDConfiguration() map[string]interface{} {
 	return map[string]interface{}{
-		"issuer":                                s.config.Issuer,
-		"authorization_endpoint":                fmt.Sprintf("%s/auth/authorize", s.config.Issuer),
-		"token_endpoint":                        fmt.Sprintf("%s/auth/token", s.config.Issuer),
-		"userinfo_endpoint":                     fmt.Sprintf("%s/auth/userinfo", s.config.Issuer),
-		"jwks_uri":                              fmt.Sprintf("%s/.well-known/jwks.json", s.config.Issuer),
-		"scopes_supported":                      s.config.Scopes,
-		"response_types_supported":              []string{"code"},
-		"subject_types_supported":               []string{"public"},
-		"id_token_signing_alg_values_supported": []string{"RS256", "HS256"},
-		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "client_secret_basic"},
-		"claims_supported":                      []string{"sub", "name", "preferred_username"},
+		"issuer":                                           s.config.Issuer,
+		"authorization_endpoint":                           fmt.Sprintf("%s/auth/authorize", s.config.Issuer),
+		"token_endpoint":                                   fmt.Sprintf("%s/auth/token", s.config.Issuer),
+		"userinfo_endpoint":                                fmt.Sprintf("%s/auth/userinfo", s.config.Issuer),
+		"introspection_endpoint":                           fmt.Sprintf("%s/auth/introspect", s.config.Issuer),
+		"revocation_endpoint":                              fmt.Sprintf("%s/auth/revoke", s.config.Issuer),
+		"end_session_endpoint":                             fmt.Sprintf("%s/auth/logout", s.config.Issuer),
+		"registration_endpoint":                            fmt.Sprintf("%s/auth/clients", s.config.Issuer),
+		"device_authorization_endpoint":                    fmt.Sprintf("%s/auth/device_authorization", s.config.Issuer),
+		"jwks_uri":                                         fmt.Sprintf("%s/.well-known/jwks.json", s.config.Issuer),
+		"scopes_supported":                                 s.config.Scopes,
+		"response_types_supported":                         supportedResponseTypes,
+		"response_modes_supported":                         responseModes,
+		"subject_types_supported":                          []string{"public"},
+		"id_token_signing_alg_values_supported":            []string{s.authService.Algorithm()},
+		"token_endpoint_auth_methods_supported":            clientAuthMethods,
+		"token_endpoint_auth_signing_alg_values_supported": clientAssertionAlgorithms,
+		"code_challenge_methods_supported":                 CodeChallengeMethods,
+		"grant_types_supported":                            clientGrantTypes,
+		"acr_values_supported":                             []string{ACRPassword},
+		"claims_supported":                                 supportedClaims,
 	}
 }
 
@@ -194,12 +443,24 @@ func (s *OIDCService) ParseScopes(scopeString string) []string {
 	return strings.Fields(scopeString)
 }
 
-// ValidateScopes validates that all requested scopes are supported
-func (s *OIDCService) ValidateScopes(scopes []string) error {
+// ValidateScopes validates that all requested scopes are supported and allowed for the client
+func (s *OIDCService) ValidateScopes(client *OIDCClient, scopes []string) error {
 	for _, scope := range scopes {
 		if !s.config.ValidateScope(scope) {
 			return fmt.Errorf("unsupported scope: %s", scope)
 		}
+		if !client.AllowsScope(scope) {
+			return fmt.Errorf("scope %s is not allowed for client %s", scope, client.ClientID)
+		}
 	}
 	return nil
 }
+
+// Client returns the client with the given ID, from the OIDC configuration or registered
+// through dynamic client registration
+func (s *OIDCService) Client(clientID string) (*OIDCClient, bool) {
+	if client, exists := s.config.Client(clientID); exists {
+		return client, true
+	}
+	return s.lookupRegisteredClient(clientID)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+)
+
+// PKCE code challenge methods (RFC 7636)
+const (
+	CodeChallengeMethodS256  = "S256"
+	CodeChallengeMethodPlain = "plain"
+)
+
+// CodeChallengeMethods lists the supported methods, advertised in the discovery document
+var CodeChallengeMethods = []string{CodeChallengeMethodS256, CodeChallengeMethodPlain}
+
+// pkceValuePattern matches code verifiers and challenges: 43 to 128 unreserved characters
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// ValidateCodeChallenge checks the PKCE parameters of an authorization request and returns
+// the method to use. Without a challenge there is nothing to check; a challenge without a
+// method uses plain, as RFC 7636 specifies.
+func ValidateCodeChallenge(challenge, method string) (string, error) {
+	if challenge == "" {
+		if method != "" {
+			return "", fmt.Errorf("code_challenge_method requires a code_challenge")
+		}
+		return "", nil
+	}
+
+	if method == "" {
+		method = CodeChallengeMethodPlain
+	}
+	if method != CodeChallengeMethodS256 && method != CodeChallengeMethodPlain {
+		return "", fmt.Errorf("unsupported code_challenge_method: %s", method)
+	}
+	if !pkceValuePattern.MatchString(challenge) {
+		return "", fmt.Errorf("code_challenge must be 43 to 128 characters of [A-Za-z0-9-._~]")
+	}
+
+	return method, nil
+}
+
+// verifyCodeVerifier checks a code verifier against the challenge of an authorization code
+func verifyCodeVerifier(verifier, challenge, method string) error {
+	if !pkceValuePattern.MatchString(verifier) {
+		return fmt.Errorf("code_verifier must be 43 to 128 characters of [A-Za-z0-9-._~]")
+	}
+
+	computed := verifier
+	if method == CodeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) != 1 {
+		return fmt.Errorf("code_verifier does not match the code_challenge")
+	}
+	return nil
+}
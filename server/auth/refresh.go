@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired and revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole token family is revoked, since the token has probably been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is an opaque token that can be exchanged once for a new token pair.
+// Tokens issued by rotating each other share a family.
+type RefreshToken struct {
+	Token    string
+	FamilyID string
+	UserID   int
+	// ClientID and Scopes are set for tokens issued to OIDC clients
+	ClientID string
+	Scopes   []string
+	// AuthTime is when the user logged in, which the whole family keeps
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
+
+type RefreshTokenStore struct {
+	tokens map[string]*RefreshToken
+	// revoked holds revoked families until their last token expires
+	revoked map[string]time.Time
+	mu      sync.Mutex
+}
+
+func NewRefreshTokenStore() *RefreshTokenStore {
+	return &RefreshTokenStore{
+		tokens:  make(map[string]*RefreshToken),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Issue creates a refresh token starting a new family. Its successors keep the client, scopes
+// and login time.
+func (s *RefreshTokenStore) Issue(userID int, clientID string, scopes []string, authTime time.Time, duration time.Duration) (*RefreshToken, error) {
+	familyID, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanupExpired()
+	return s.issue(&RefreshToken{UserID: userID, ClientID: clientID, Scopes: scopes, AuthTime: authTime, FamilyID: familyID}, duration)
+}
+
+// Rotate consumes a refresh token issued to clientID and returns its successor in the
+// same family. Presenting a consumed token again revokes the family.
+func (s *RefreshTokenStore) Rotate(token, clientID string, duration time.Duration) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refreshToken, exists := s.tokens[token]
+	if !exists || refreshToken.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if _, revoked := s.revoked[refreshToken.FamilyID]; revoked || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if refreshToken.Used {
+		s.revokeFamily(refreshToken.FamilyID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	refreshToken.Used = true
+	return s.issue(refreshToken, duration)
+}
+
+// Lookup returns a refresh token that can still be exchanged
+func (s *RefreshTokenStore) Lookup(token string) (*RefreshToken, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refreshToken, exists := s.tokens[token]
+	if !exists || refreshToken.Used || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, false
+	}
+	if _, revoked := s.revoked[refreshToken.FamilyID]; revoked {
+		return nil, false
+	}
+	return refreshToken, true
+}
+
+// Revoke invalidates the family of the given token. Unknown tokens are ignored.
+func (s *RefreshTokenStore) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if refreshToken, exists := s.tokens[token]; exists {
+		s.revokeFamily(refreshToken.FamilyID)
+	}
+}
+
+// Clear deletes all refresh tokens
+func (s *RefreshTokenStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = make(map[string]*RefreshToken)
+	s.revoked = make(map[string]time.Time)
+}
+
+// issue stores a new token for the user, client, scopes, login time and family of from
+func (s *RefreshTokenStore) issue(from *RefreshToken, duration time.Duration) (*RefreshToken, error) {
+	token, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshToken := &RefreshToken{
+		Token:     token,
+		FamilyID:  from.FamilyID,
+		UserID:    from.UserID,
+		ClientID:  from.ClientID,
+		Scopes:    from.Scopes,
+		AuthTime:  from.AuthTime,
+		ExpiresAt: time.Now().Add(duration),
+	}
+	s.tokens[token] = refreshToken
+
+	return refreshToken, nil
+}
+
+func (s *RefreshTokenStore) revokeFamily(familyID string) {
+	var expiresAt time.Time
+	for _, refreshToken := range s.tokens {
+		if refreshToken.FamilyID == familyID && refreshToken.ExpiresAt.After(expiresAt) {
+			expiresAt = refreshToken.ExpiresAt
+		}
+	}
+	s.revoked[familyID] = expiresAt
+}
+
+// cleanupExpired drops expired tokens and families. The caller must hold the lock.
+func (s *RefreshTokenStore) cleanupExpired() {
+	now := time.Now()
+	for token, refreshToken := range s.tokens {
+		if now.After(refreshToken.ExpiresAt) {
+			delete(s.tokens, token)
+		}
+	}
+	for familyID, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, familyID)
+		}
+	}
+}
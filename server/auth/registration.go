@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+// ClientStore holds the clients registered through dynamic client registration
+type ClientStore interface {
+	GetByID(clientID string) (*domain.Client, bool)
+	Save(client *domain.Client) error
+	Delete(clientID string) bool
+}
+
+// ErrInvalidRegistrationToken is returned when the registration access token does not match
+// the client, or the client does not exist
+var ErrInvalidRegistrationToken = errors.New("invalid registration access token")
+
+// RegistrationError rejects client metadata, with an error code of RFC 7591 section 3.2.2
+type RegistrationError struct {
+	Code        string
+	Description string
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Description
+}
+
+func invalidClientMetadata(format string, args ...any) error {
+	return &RegistrationError{Code: "invalid_client_metadata", Description: fmt.Sprintf(format, args...)}
+}
+
+// ClientMetadata is the client metadata of dynamic client registration (RFC 7591 section 2)
+type ClientMetadata struct {
+	RedirectURIs           []string `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	GrantTypes             []string `json:"grant_types,omitempty"`
+	ResponseTypes          []string `json:"response_types,omitempty"`
+	// TokenEndpointAuthMethod is one of the ClientAuthMethod constants, defaults to client_secret_basic
+	TokenEndpointAuthMethod string  `json:"token_endpoint_auth_method,omitempty"`
+	ClientName              string  `json:"client_name,omitempty"`
+	Scope                   string  `json:"scope,omitempty"`
+	JWKS                    *JWKSet `json:"jwks,omitempty"`
+}
+
+// ClientInformation is the response of the registration endpoints (RFC 7591 section 3.2.1)
+type ClientInformation struct {
+	ClientID         string `json:"client_id"`
+	ClientSecret     string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt int64  `json:"client_id_issued_at"`
+	// ClientSecretExpiresAt is zero, as secrets do not expire, and omitted without a secret
+	ClientSecretExpiresAt *int64 `json:"client_secret_expires_at,omitempty"`
+	// RegistrationAccessToken is only returned by the registration itself, since only its
+	// hash is stored
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	ClientMetadata
+}
+
+// applyDefaults fills in the defaults of RFC 7591 section 2, so that the registered
+// metadata is returned with them
+func (m *ClientMetadata) applyDefaults(providerScopes []string) {
+	if len(m.GrantTypes) == 0 {
+		m.GrantTypes = []string{GrantTypeAuthorizationCode}
+	}
+	if len(m.ResponseTypes) == 0 && slices.Contains(m.GrantTypes, GrantTypeAuthorizationCode) {
+		m.ResponseTypes = []string{ResponseTypeCode}
+	}
+	if m.TokenEndpointAuthMethod == "" {
+		m.TokenEndpointAuthMethod = ClientAuthMethodSecretBasic
+	}
+	if m.Scope == "" {
+		m.Scope = strings.Join(providerScopes, " ")
+	}
+}
+
+// usesSecret reports whether the client authenticates with a client secret
+func (m *ClientMetadata) usesSecret() bool {
+	return m.TokenEndpointAuthMethod == ClientAuthMethodSecretBasic || m.TokenEndpointAuthMethod == ClientAuthMethodSecretPost
+}
+
+// client validates the metadata and returns the client it describes
+func (m *ClientMetadata) client(clientID, clientSecret string, providerScopes []string) (*OIDCClient, error) {
+	for _, uri := range slices.Concat(m.RedirectURIs, m.PostLogoutRedirectURIs) {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" || parsed.Fragment != "" {
+			return nil, &RegistrationError{Code: "invalid_redirect_uri", Description: "Redirect URIs must be absolute URIs without a fragment: " + uri}
+		}
+	}
+
+	if !slices.Contains(clientAuthMethods, m.TokenEndpointAuthMethod) {
+		return nil, invalidClientMetadata("unsupported token_endpoint_auth_method: %s", m.TokenEndpointAuthMethod)
+	}
+	if (m.TokenEndpointAuthMethod == ClientAuthMethodPrivateKeyJWT) != (m.JWKS != nil) {
+		return nil, invalidClientMetadata("jwks is required for private_key_jwt and only allowed with it")
+	}
+	// Anyone may register, so the grant would hand service tokens for the task API to anyone
+	if slices.Contains(m.GrantTypes, GrantTypeClientCredentials) {
+		return nil, invalidClientMetadata("the client_credentials grant is only available to configured clients")
+	}
+
+	// Every response type needs the grant type of the flow that returns it
+	for _, responseType := range m.ResponseTypes {
+		values, ok := ParseResponseType(responseType)
+		if !ok {
+			return nil, invalidClientMetadata("unsupported response type: %s", responseType)
+		}
+		request := AuthRequest{ResponseTypes: values}
+		if request.Returns(ResponseTypeCode) && !slices.Contains(m.GrantTypes, GrantTypeAuthorizationCode) ||
+			request.ReturnsTokens() && !slices.Contains(m.GrantTypes, GrantTypeImplicit) {
+			return nil, invalidClientMetadata("response type %s does not match the grant types", responseType)
+		}
+	}
+
+	client := &OIDCClient{
+		ClientID:                clientID,
+		ClientSecret:            clientSecret,
+		RedirectURIs:            m.RedirectURIs,
+		PostLogoutRedirectURIs:  m.PostLogoutRedirectURIs,
+		JWKS:                    m.JWKS,
+		Scopes:                  strings.Fields(m.Scope),
+		GrantTypes:              m.GrantTypes,
+		TokenEndpointAuthMethod: m.TokenEndpointAuthMethod,
+	}
+	if err := client.validate(providerScopes); err != nil {
+		return nil, invalidClientMetadata("%s", err.Error())
+	}
+	return client, nil
+}
+
+// RegisterClient registers a client with the metadata. The returned information includes
+// the client secret, if the client uses one, and the registration access token.
+func (s *OIDCService) RegisterClient(metadata ClientMetadata) (*ClientInformation, error) {
+	metadata.applyDefaults(s.config.Scopes)
+
+	clientID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client ID: %w", err)
+	}
+	var clientSecret string
+	if metadata.usesSecret() {
+		if clientSecret, err = randomToken(32); err != nil {
+			return nil, fmt.Errorf("failed to generate client secret: %w", err)
+		}
+	}
+	if _, err := metadata.client(clientID, clientSecret, s.config.Scopes); err != nil {
+		return nil, err
+	}
+
+	registrationToken, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate registration access token: %w", err)
+	}
+
+	record := &domain.Client{
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		RegistrationTokenHash: hashRegistrationToken(registrationToken),
+		CreatedAt:             time.Now(),
+	}
+	if err := s.saveClient(record, metadata); err != nil {
+		return nil, err
+	}
+
+	info := s.clientInformation(record, metadata)
+	info.RegistrationAccessToken = registrationToken
+	return info, nil
+}
+
+// ReadClientRegistration returns the registration of the client (RFC 7592 section 2.1)
+func (s *OIDCService) ReadClientRegistration(clientID, registrationToken string) (*ClientInformation, error) {
+	record, err := s.registeredClient(clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata ClientMetadata
+	if err := json.Unmarshal(record.Metadata, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata of client %s: %w", clientID, err)
+	}
+	return s.clientInformation(record, metadata), nil
+}
+
+// UpdateClientRegistration replaces the metadata of the client (RFC 7592 section 2.2). The
+// client keeps its ID and secret, unless it no longer authenticates with a secret or now
+// needs one.
+func (s *OIDCService) UpdateClientRegistration(clientID, registrationToken string, metadata ClientMetadata) (*ClientInformation, error) {
+	record, err := s.registeredClient(clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.applyDefaults(s.config.Scopes)
+	updated := *record
+	switch {
+	case !metadata.usesSecret():
+		updated.ClientSecret = ""
+	case updated.ClientSecret == "":
+		if updated.ClientSecret, err = randomToken(32); err != nil {
+			return nil, fmt.Errorf("failed to generate client secret: %w", err)
+		}
+	}
+	if _, err := metadata.client(clientID, updated.ClientSecret, s.config.Scopes); err != nil {
+		return nil, err
+	}
+
+	if err := s.saveClient(&updated, metadata); err != nil {
+		return nil, err
+	}
+	return s.clientInformation(&updated, metadata), nil
+}
+
+// DeleteClientRegistration deletes the client (RFC 7592 section 2.3)
+func (s *OIDCService) DeleteClientRegistration(clientID, registrationToken string) error {
+	if _, err := s.registeredClient(clientID, registrationToken); err != nil {
+		return err
+	}
+	if !s.clientStore.Delete(clientID) {
+		return fmt.Errorf("failed to delete client %s", clientID)
+	}
+	return nil
+}
+
+// registeredClient returns the stored client if the registration access token matches
+func (s *OIDCService) registeredClient(clientID, registrationToken string) (*domain.Client, error) {
+	record, exists := s.clientStore.GetByID(clientID)
+	if !exists || subtle.ConstantTimeCompare([]byte(hashRegistrationToken(registrationToken)), []byte(record.RegistrationTokenHash)) != 1 {
+		return nil, ErrInvalidRegistrationToken
+	}
+	return record, nil
+}
+
+// lookupRegisteredClient returns a client registered at runtime
+func (s *OIDCService) lookupRegisteredClient(clientID string) (*OIDCClient, bool) {
+	record, exists := s.clientStore.GetByID(clientID)
+	if !exists {
+		return nil, false
+	}
+
+	var metadata ClientMetadata
+	if err := json.Unmarshal(record.Metadata, &metadata); err != nil {
+		log.Printf("Ignoring registered client %s with invalid metadata: %v", clientID, err)
+		return nil, false
+	}
+	// The provider scopes may have changed since the client was registered
+	client, err := metadata.client(record.ClientID, record.ClientSecret, s.config.Scopes)
+	if err != nil {
+		log.Printf("Ignoring registered client %s: %v", clientID, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// saveClient stores the client with the metadata
+func (s *OIDCService) saveClient(record *domain.Client, metadata ClientMetadata) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode client metadata: %w", err)
+	}
+	record.Metadata = encoded
+
+	if err := s.clientStore.Save(record); err != nil {
+		return fmt.Errorf("failed to save client: %w", err)
+	}
+	return nil
+}
+
+// clientInformation returns the registration response of the client
+func (s *OIDCService) clientInformation(record *domain.Client, metadata ClientMetadata) *ClientInformation {
+	info := &ClientInformation{
+		ClientID:              record.ClientID,
+		ClientSecret:          record.ClientSecret,
+		ClientIDIssuedAt:      record.CreatedAt.Unix(),
+		RegistrationClientURI: fmt.Sprintf("%s/auth/clients/%s", s.config.Issuer, record.ClientID),
+		ClientMetadata:        metadata,
+	}
+	if record.ClientSecret != "" {
+		var neverExpires int64
+		info.ClientSecretExpiresAt = &neverExpires
+	}
+	return info
+}
+
+// hashRegistrationToken returns the SHA-256 hash the registration access token is stored as
+func hashRegistrationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomToken returns n random bytes, base64url encoded
+func randomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
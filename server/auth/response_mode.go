@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the response_type parameter
+const (
+	ResponseTypeCode    = "code"
+	ResponseTypeIDToken = "id_token"
+	ResponseTypeToken   = "token"
+)
+
+// supportedResponseTypes lists the supported response types, advertised in the discovery
+// document. Combinations may be sent in any order.
+var supportedResponseTypes = []string{"code", "id_token", "id_token token", "code id_token"}
+
+// Values of the response_mode parameter (OAuth 2.0 Multiple Response Types and Form Post Response Mode)
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+)
+
+// responseModes lists the supported response modes, advertised in the discovery document
+var responseModes = []string{ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost}
+
+// ParseResponseType splits a response_type into its values and reports whether the
+// combination is supported
+func ParseResponseType(responseType string) ([]string, bool) {
+	values := strings.Fields(responseType)
+	sorted := slices.Sorted(slices.Values(values))
+	for _, supported := range supportedResponseTypes {
+		if slices.Equal(sorted, slices.Sorted(slices.Values(strings.Fields(supported)))) {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// Returns reports whether the response type of the request includes value
+func (r *AuthRequest) Returns(value string) bool {
+	return slices.Contains(r.ResponseTypes, value)
+}
+
+// ReturnsTokens reports whether the authorization endpoint itself returns tokens, as in the
+// implicit and hybrid flows
+func (r *AuthRequest) ReturnsTokens() bool {
+	return r.Returns(ResponseTypeIDToken) || r.Returns(ResponseTypeToken)
+}
+
+// defaultResponseMode returns the response mode of a response type without a response_mode:
+// query for the code flow, and fragment whenever tokens are returned, which must not end up
+// in server logs and Referer headers
+func defaultResponseMode(responseTypes []string) string {
+	if slices.Equal(responseTypes, []string{ResponseTypeCode}) {
+		return ResponseModeQuery
+	}
+	return ResponseModeFragment
+}
+
+// writeAuthorizationResponse returns the parameters of an authorization response, or error,
+// to the redirect URI of the request in its response mode
+func writeAuthorizationResponse(c *gin.Context, request *AuthRequest, params url.Values) {
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+
+	switch request.ResponseMode {
+	case ResponseModeFormPost:
+		fields := make(map[string]string, len(params))
+		for name := range params {
+			fields[name] = params.Get(name)
+		}
+		c.HTML(http.StatusOK, "form_post.html", gin.H{
+			"RedirectURI": request.RedirectURI,
+			"Params":      fields,
+		})
+	case ResponseModeFragment:
+		c.Redirect(http.StatusFound, request.RedirectURI+"#"+params.Encode())
+	default:
+		redirectURL, err := url.Parse(request.RedirectURI)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request",
+				"error_description": "Invalid redirect_uri",
+			})
+			return
+		}
+		query := redirectURL.Query()
+		for name := range params {
+			query.Set(name, params.Get(name))
+		}
+		redirectURL.RawQuery = query.Encode()
+		c.Redirect(http.StatusFound, redirectURL.String())
+	}
+}
+
+// authorizationError returns an error to the client in the response mode of the request
+func authorizationError(c *gin.Context, request *AuthRequest, errorCode, errorDescription string) {
+	writeAuthorizationResponse(c, request, url.Values{
+		"error":             {errorCode},
+		"error_description": {errorDescription},
+	})
+}
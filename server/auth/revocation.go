@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrTokenRevoked is returned when validating a token that has been revoked
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationList holds the IDs (jti) of revoked tokens until the tokens expire
+type RevocationList struct {
+	revoked map[string]time.Time
+	mu      sync.Mutex
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke adds the token to the list. Tokens without an ID cannot be revoked.
+func (l *RevocationList) Revoke(token *jwt.Token) {
+	jti, expiresAt, ok := revocationKey(token)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanupExpired()
+	l.revoked[jti] = expiresAt
+}
+
+// IsRevoked reports whether the token has been revoked
+func (l *RevocationList) IsRevoked(token *jwt.Token) bool {
+	jti, _, ok := revocationKey(token)
+	if !ok {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, revoked := l.revoked[jti]
+	return revoked
+}
+
+// Use adds the token to the list and reports whether it was not on the list yet, which
+// makes one-time tokens such as client assertions unusable after their first use
+func (l *RevocationList) Use(token *jwt.Token) bool {
+	jti, expiresAt, ok := revocationKey(token)
+	if !ok {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, used := l.revoked[jti]; used {
+		return false
+	}
+	l.cleanupExpired()
+	l.revoked[jti] = expiresAt
+	return true
+}
+
+// revocationKey returns the ID of the token and when it expires
+func revocationKey(token *jwt.Token) (string, time.Time, bool) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}, false
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return "", time.Time{}, false
+	}
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		// Without an expiry the token has to stay revoked for good
+		return jti, time.Time{}, true
+	}
+	return jti, expiresAt.Time, true
+}
+
+// cleanupExpired drops tokens that expired anyway. The caller must hold the lock.
+func (l *RevocationList) cleanupExpired() {
+	now := time.Now()
+	for jti, expiresAt := range l.revoked {
+		if !expiresAt.IsZero() && now.After(expiresAt) {
+			delete(l.revoked, jti)
+		}
+	}
+}
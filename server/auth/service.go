@@ -1,11 +1,8 @@
 package auth
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"encoding/base64"
 	"fmt"
-	"math/big"
+	"strconv"
 	"time"
 
 	"github.com/KasumiMercury/mock-todo-server/server/domain"
@@ -17,24 +14,39 @@ import (
 type JWTKeyMode string
 
 const (
-	JWTKeyModeSecret JWTKeyMode = "secret"
-	JWTKeyModeRSA    JWTKeyMode = "rsa"
+	JWTKeyModeSecret  JWTKeyMode = "secret"
+	JWTKeyModeRSA     JWTKeyMode = "rsa"
+	JWTKeyModeECDSA   JWTKeyMode = "ecdsa"
+	JWTKeyModeEd25519 JWTKeyMode = "ed25519"
+)
+
+const (
+	DefaultAccessTokenTTL  = 24 * time.Hour
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
 )
 
 type AuthService struct {
-	userStore    store.UserStore
-	keyMode      JWTKeyMode
-	secretKey    []byte
-	rsaPrivate   *rsa.PrivateKey
-	rsaPublic    *rsa.PublicKey
-	sessionStore *SessionStore
+	userStore       store.UserStore
+	keyMode         JWTKeyMode
+	signingMethod   jwt.SigningMethod
+	secretKey       []byte
+	keys            *KeyRing
+	sessionStore    *SessionStore
+	refreshTokens   *RefreshTokenStore
+	revokedTokens   *RevocationList
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
 }
 
 type JWK struct {
 	Kty string `json:"kty"`
 	Use string `json:"use"`
-	N   string `json:"n"`
-	E   string `json:"e"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
 	Kid string `json:"kid"`
 }
 
@@ -42,30 +54,60 @@ type JWKSet struct {
 	Keys []JWK `json:"keys"`
 }
 
-func NewAuthService(userStore store.UserStore, keyMode JWTKeyMode, secretKey string) (*AuthService, error) {
+// NewAuthService creates the authentication service signing tokens with algorithm, or the
+// default algorithm of keyMode when empty. With asymmetric key modes the signing keys are
+// loaded from keyDir, or generated in memory when keyDir is empty.
+func NewAuthService(userStore store.UserStore, keyMode JWTKeyMode, algorithm, secretKey, keyDir string) (*AuthService, error) {
+	algorithm, err := ResolveAlgorithm(keyMode, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
 	service := &AuthService{
-		userStore:    userStore,
-		keyMode:      keyMode,
-		sessionStore: NewSessionStore(),
+		userStore:       userStore,
+		keyMode:         keyMode,
+		signingMethod:   jwt.GetSigningMethod(algorithm),
+		sessionStore:    NewSessionStore(),
+		refreshTokens:   NewRefreshTokenStore(),
+		revokedTokens:   NewRevocationList(),
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
 	}
 
-	switch keyMode {
-	case JWTKeyModeSecret:
-		service.secretKey = []byte(secretKey)
-	case JWTKeyModeRSA:
-		private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if keyMode.IsAsymmetric() {
+		keys, err := NewKeyRing(keyDir, algorithm)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+			return nil, fmt.Errorf("failed to load signing keys: %w", err)
 		}
-		service.rsaPrivate = private
-		service.rsaPublic = &private.PublicKey
-	default:
-		return nil, fmt.Errorf("unsupported key mode: %s", keyMode)
+		service.keys = keys
+	} else {
+		service.secretKey = []byte(secretKey)
 	}
 
 	return service, nil
 }
 
+// SetTokenLifetimes changes the lifetime of access and refresh tokens issued from now on.
+// A zero duration keeps the current lifetime.
+func (s *AuthService) SetTokenLifetimes(accessTokenTTL, refreshTokenTTL time.Duration) {
+	if accessTokenTTL > 0 {
+		s.accessTokenTTL = accessTokenTTL
+	}
+	if refreshTokenTTL > 0 {
+		s.refreshTokenTTL = refreshTokenTTL
+	}
+}
+
+// Algorithm returns the JWS algorithm tokens are signed with
+func (s *AuthService) Algorithm() string {
+	return s.signingMethod.Alg()
+}
+
+// AccessTokenTTL returns the lifetime of access tokens
+func (s *AuthService) AccessTokenTTL() time.Duration {
+	return s.accessTokenTTL
+}
+
 func (s *AuthService) HashPassword(password string) (string, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -85,46 +127,67 @@ func (s *AuthService) GenerateToken(user *domain.User) (string, error) {
 		"sub":  user.ID,
 		"name": user.Username,
 		"iat":  now.Unix(),
-		"exp":  now.Add(24 * time.Hour).Unix(),
+		"exp":  now.Add(s.accessTokenTTL).Unix(),
 	}
 
 	return s.generateJWTWithClaims(claims)
 }
 
-// generateJWTWithClaims generates a JWT token with custom claims
+// generateJWTWithClaims generates a JWT token with custom claims. Every token gets a
+// unique ID (jti), so it can be revoked.
 func (s *AuthService) generateJWTWithClaims(claims jwt.MapClaims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if _, exists := claims["jti"]; !exists {
+		jti, err := generateSessionID()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate token ID: %w", err)
+		}
+		claims["jti"] = jti
+	}
 
-	switch s.keyMode {
-	case JWTKeyModeSecret:
+	token := jwt.NewWithClaims(s.signingMethod, claims)
+	if s.keys == nil {
 		return token.SignedString(s.secretKey)
-	case JWTKeyModeRSA:
-		token.Method = jwt.SigningMethodRS256
-		return token.SignedString(s.rsaPrivate)
-	default:
-		return "", fmt.Errorf("unsupported key mode: %s", s.keyMode)
 	}
+
+	key := s.keys.Active()
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.Private)
 }
 
+// ValidateToken verifies the signature and expiry of a token and that it has not been revoked
 func (s *AuthService) ValidateToken(tokenString string) (*jwt.Token, error) {
-	switch s.keyMode {
-	case JWTKeyModeSecret:
-		return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return s.secretKey, nil
-		})
-	case JWTKeyModeRSA:
-		return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return s.rsaPublic, nil
-		})
-	default:
-		return nil, fmt.Errorf("unsupported key mode: %s", s.keyMode)
+	token, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
 	}
+
+	if s.revokedTokens.IsRevoked(token) {
+		return nil, ErrTokenRevoked
+	}
+	return token, nil
+}
+
+// parseToken verifies the signature of a token issued by this server and its claims,
+// as far as the options do not change the validation
+func (s *AuthService) parseToken(tokenString string, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append(options, jwt.WithValidMethods([]string{s.signingMethod.Alg()}))
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if s.keys == nil {
+			return s.secretKey, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown or expired signing key: %s", kid)
+		}
+		return key.Private.Public(), nil
+	}, options...)
+}
+
+// RevokeToken makes a valid token fail validation from now on
+func (s *AuthService) RevokeToken(token *jwt.Token) {
+	s.revokedTokens.Revoke(token)
 }
 
 func (s *AuthService) GetUserIDFromToken(token *jwt.Token) (int, error) {
@@ -133,12 +196,19 @@ func (s *AuthService) GetUserIDFromToken(token *jwt.Token) (int, error) {
 		return 0, fmt.Errorf("invalid token claims")
 	}
 
-	userID, ok := claims["sub"].(float64)
-	if !ok {
+	// Password login tokens carry a numeric subject, OIDC tokens a string one
+	switch sub := claims["sub"].(type) {
+	case float64:
+		return int(sub), nil
+	case string:
+		userID, err := strconv.Atoi(sub)
+		if err != nil {
+			return 0, fmt.Errorf("invalid user ID in token")
+		}
+		return userID, nil
+	default:
 		return 0, fmt.Errorf("invalid user ID in token")
 	}
-
-	return int(userID), nil
 }
 
 func (s *AuthService) Login(username, password string) (*domain.User, string, error) {
@@ -191,24 +261,75 @@ func (s *AuthService) Register(username, password string) (*domain.User, string,
 	return createdUser, token, nil
 }
 
+// IssueRefreshToken starts a new refresh token family for user
+func (s *AuthService) IssueRefreshToken(user *domain.User) (string, error) {
+	refreshToken, err := s.refreshTokens.Issue(user.ID, "", nil, time.Now(), s.refreshTokenTTL)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken.Token, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated refresh token
+func (s *AuthService) Refresh(refreshToken string) (*domain.User, string, string, error) {
+	rotated, err := s.refreshTokens.Rotate(refreshToken, "", s.refreshTokenTTL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	user, exists := s.userStore.GetByID(rotated.UserID)
+	if !exists {
+		s.refreshTokens.Revoke(rotated.Token)
+		return nil, "", "", ErrInvalidRefreshToken
+	}
+
+	token, err := s.GenerateToken(user)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return user, token, rotated.Token, nil
+}
+
+// RevokeRefreshToken invalidates the refresh token and every token rotated from the same login
+func (s *AuthService) RevokeRefreshToken(refreshToken string) {
+	s.refreshTokens.Revoke(refreshToken)
+}
+
+// ClearRefreshTokens revokes all refresh tokens
+func (s *AuthService) ClearRefreshTokens() {
+	s.refreshTokens.Clear()
+}
+
 func (s *AuthService) GetJWKSet() (*JWKSet, error) {
-	if s.keyMode != JWTKeyModeRSA {
-		return nil, fmt.Errorf("JWKs only available in RSA mode")
+	if s.keys == nil {
+		return nil, fmt.Errorf("JWKs only available with asymmetric key modes")
+	}
+
+	// Publish every key that still verifies tokens, so tokens signed before a rotation stay verifiable
+	keys := s.keys.VerificationKeys()
+	jwks := make([]JWK, 0, len(keys))
+	for _, key := range keys {
+		jwks = append(jwks, publicJWK(key, s.Algorithm()))
 	}
 
-	// Convert RSA public key to JWK format
-	n := base64.RawURLEncoding.EncodeToString(s.rsaPublic.N.Bytes())
-	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.rsaPublic.E)).Bytes())
+	return &JWKSet{Keys: jwks}, nil
+}
 
-	jwk := JWK{
-		Kty: "RSA",
-		Use: "sig",
-		N:   n,
-		E:   e,
-		Kid: "rsa-key-1",
+// SetKeyGracePeriod changes how long rotated out signing keys keep verifying tokens
+func (s *AuthService) SetKeyGracePeriod(gracePeriod time.Duration) {
+	if s.keys != nil {
+		s.keys.SetGracePeriod(gracePeriod)
 	}
+}
 
-	return &JWKSet{Keys: []JWK{jwk}}, nil
+// RotateSigningKey makes a new key the active signing key. Tokens signed with the
+// previous key stay valid for the grace period.
+func (s *AuthService) RotateSigningKey() (*SigningKey, error) {
+	if s.keys == nil {
+		return nil, fmt.Errorf("key rotation is only available with asymmetric key modes")
+	}
+	return s.keys.Rotate()
 }
 
 func (s *AuthService) CreateSession(user *domain.User) (*Session, error) {
@@ -223,6 +344,11 @@ func (s *AuthService) DestroySession(sessionID string) {
 	s.sessionStore.DeleteSession(sessionID)
 }
 
+// ClearSessions logs out every session-based client
+func (s *AuthService) ClearSessions() {
+	s.sessionStore.Clear()
+}
+
 func (s *AuthService) LoginWithSession(username, password string) (*domain.User, *Session, error) {
 	user, exists := s.userStore.GetByUsername(username)
 	if !exists {
@@ -16,6 +16,8 @@ type Session struct {
 	Username  string
 	CreatedAt time.Time
 	ExpiresAt time.Time
+	// CSRFToken is embedded in forms of the session, which are rejected without it
+	CSRFToken string
 }
 
 type SessionStore struct {
@@ -34,6 +36,10 @@ func (s *SessionStore) CreateSession(user *domain.User, duration time.Duration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate session ID: %w", err)
 	}
+	csrfToken, err := generateSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
 
 	now := time.Now()
 	session := &Session{
@@ -42,6 +48,7 @@ func (s *SessionStore) CreateSession(user *domain.User, duration time.Duration)
 		Username:  user.Username,
 		CreatedAt: now,
 		ExpiresAt: now.Add(duration),
+		CSRFToken: csrfToken,
 	}
 
 	s.mu.Lock()
@@ -75,6 +82,14 @@ func (s *SessionStore) DeleteSession(sessionID string) {
 	delete(s.sessions, sessionID)
 }
 
+// Clear deletes all sessions
+func (s *SessionStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]*Session)
+}
+
 func (s *SessionStore) CleanupExpiredSessions() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
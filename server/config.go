@@ -2,29 +2,48 @@ package server
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/fault"
 )
 
 // Config holds all configuration options for the server
 type Config struct {
 	Port           int
 	JsonFilePath   string
+	SQLitePath     string
+	WatchFile      bool
 	JWTKeyMode     auth.JWTKeyMode
+	JWTAlgorithm   string
 	JWTSecretKey   string
+	JWTKeyDir      string
 	AuthRequired   bool
 	AuthMode       auth.AuthMode
 	OIDCConfigPath string
+	Faults         fault.Config
+
+	// JWTKeyGracePeriod is how long a rotated out signing key keeps verifying tokens
+	JWTKeyGracePeriod time.Duration
+
+	// AccessTokenTTL and RefreshTokenTTL set the token lifetimes of the password login flow
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 }
 
 // NewServerConfig creates a new ServerConfig with default values
 func NewServerConfig() *Config {
 	return &Config{
 		Port:         8080,
+		WatchFile:    true,
 		JWTKeyMode:   auth.JWTKeyModeSecret,
 		JWTSecretKey: "test-secret-key",
 		AuthRequired: true,
 		AuthMode:     auth.AuthModeJWT,
+
+		JWTKeyGracePeriod: auth.DefaultKeyGracePeriod,
+		AccessTokenTTL:    auth.DefaultAccessTokenTTL,
+		RefreshTokenTTL:   auth.DefaultRefreshTokenTTL,
 	}
 }
 
@@ -36,8 +55,12 @@ func (c *Config) ValidateAndConvert(keyModeStr, authModeStr string) error {
 		c.JWTKeyMode = auth.JWTKeyModeSecret
 	case "rsa":
 		c.JWTKeyMode = auth.JWTKeyModeRSA
+	case "ecdsa":
+		c.JWTKeyMode = auth.JWTKeyModeECDSA
+	case "ed25519":
+		c.JWTKeyMode = auth.JWTKeyModeEd25519
 	default:
-		return fmt.Errorf("invalid jwt-key-mode: %s (must be 'secret' or 'rsa')", keyModeStr)
+		return fmt.Errorf("invalid jwt-key-mode: %s (must be 'secret', 'rsa', 'ecdsa' or 'ed25519')", keyModeStr)
 	}
 
 	// Validate and convert auth mode
@@ -67,11 +90,31 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("port must be between 1 and 65535")
 	}
 
+	if c.JsonFilePath != "" && c.SQLitePath != "" {
+		return fmt.Errorf("json-file-path and sqlite-path cannot be combined")
+	}
+
 	// Additional validation for OIDC mode
 	if c.AuthMode == auth.AuthModeOIDC && c.OIDCConfigPath == "" {
 		return fmt.Errorf("OIDC config file path is required when using OIDC auth mode")
 	}
 
+	if _, err := auth.ResolveAlgorithm(c.JWTKeyMode, c.JWTAlgorithm); err != nil {
+		return err
+	}
+
+	if c.JWTKeyDir != "" && !c.JWTKeyMode.IsAsymmetric() {
+		return fmt.Errorf("jwt-key-dir requires jwt-key-mode rsa, ecdsa or ed25519")
+	}
+
+	if c.JWTKeyGracePeriod < 0 || c.AccessTokenTTL < 0 || c.RefreshTokenTTL < 0 {
+		return fmt.Errorf("token lifetimes and the key grace period must not be negative")
+	}
+
+	if err := c.Faults.Validate(); err != nil {
+		return fmt.Errorf("invalid fault config: %w", err)
+	}
+
 	return nil
 }
 
@@ -83,8 +126,12 @@ func (c *Config) ValidateEnumFields(jwtKeyModeStr, authModeStr string) error {
 		c.JWTKeyMode = auth.JWTKeyModeSecret
 	case "rsa":
 		c.JWTKeyMode = auth.JWTKeyModeRSA
+	case "ecdsa":
+		c.JWTKeyMode = auth.JWTKeyModeECDSA
+	case "ed25519":
+		c.JWTKeyMode = auth.JWTKeyModeEd25519
 	default:
-		return fmt.Errorf("invalid jwt-key-mode: %s (must be 'secret' or 'rsa')", jwtKeyModeStr)
+		return fmt.Errorf("invalid jwt-key-mode: %s (must be 'secret', 'rsa', 'ecdsa' or 'ed25519')", jwtKeyModeStr)
 	}
 
 	// Validate and convert auth mode
@@ -118,6 +165,10 @@ func (c *Config) ToFlagsString() map[string]string {
 		result["jwt-key-mode"] = "secret"
 	case auth.JWTKeyModeRSA:
 		result["jwt-key-mode"] = "rsa"
+	case auth.JWTKeyModeECDSA:
+		result["jwt-key-mode"] = "ecdsa"
+	case auth.JWTKeyModeEd25519:
+		result["jwt-key-mode"] = "ed25519"
 	}
 
 	// Convert AuthMode to string
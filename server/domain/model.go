@@ -1,12 +1,49 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+)
+
+// DefaultPriority is used for tasks created without an explicit priority
+const DefaultPriority = PriorityMedium
 
 type Task struct {
-	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	UserID    int    `json:"user_id"`
-	CreatedAt string `json:"created_at"`
+	ID          int      `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Completed   bool     `json:"completed"`
+	DueDate     *string  `json:"due_date"`
+	Priority    Priority `json:"priority"`
+	Tags        []string `json:"tags"`
+	UserID      int      `json:"user_id"`
+	Version     int      `json:"version"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// ApplyDefaults fills fields missing from tasks stored by older versions
+func (t *Task) ApplyDefaults() {
+	if t.Priority == "" {
+		t.Priority = DefaultPriority
+	}
+	if t.Tags == nil {
+		t.Tags = []string{}
+	}
+	if t.UpdatedAt == "" {
+		t.UpdatedAt = t.CreatedAt
+	}
+	if t.Version == 0 {
+		t.Version = 1
+	}
 }
 
 type User struct {
@@ -14,6 +51,39 @@ type User struct {
 	Username       string    `json:"username"`
 	HashedPassword string    `json:"-"`
 	CreatedAt      time.Time `json:"created_at"`
+	Profile
+}
+
+// Profile holds the standard claims a user shares through the OIDC email, phone and
+// address scopes. All fields are optional.
+type Profile struct {
+	Email               string   `json:"email,omitempty"`
+	EmailVerified       bool     `json:"email_verified,omitempty"`
+	PhoneNumber         string   `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool     `json:"phone_number_verified,omitempty"`
+	Address             *Address `json:"address,omitempty"`
+}
+
+// Address is the address claim of OpenID Connect Core section 5.1.1
+type Address struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"street_address,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postal_code,omitempty"`
+	Country       string `json:"country,omitempty"`
+}
+
+// Client is an OIDC client registered through dynamic client registration
+type Client struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	// Metadata is the client metadata of the registration request (RFC 7591)
+	Metadata json.RawMessage `json:"metadata"`
+	// RegistrationTokenHash is the SHA-256 hash of the registration access token that
+	// reads, updates and deletes the registration
+	RegistrationTokenHash string    `json:"registration_token_hash"`
+	CreatedAt             time.Time `json:"created_at"`
 }
 
 type LoginRequest struct {
@@ -26,7 +96,17 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	User         User   `json:"user"`
 }
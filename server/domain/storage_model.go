@@ -9,6 +9,7 @@ type UserStorage struct {
 	Username       string    `json:"username"`
 	HashedPassword string    `json:"hashed_password"`
 	CreatedAt      time.Time `json:"created_at"`
+	Profile
 }
 
 // ToUser converts UserStorage to User (for API responses)
@@ -18,6 +19,7 @@ func (us *UserStorage) ToUser() *User {
 		Username:       us.Username,
 		HashedPassword: us.HashedPassword,
 		CreatedAt:      us.CreatedAt,
+		Profile:        us.Profile,
 	}
 }
 
@@ -28,6 +30,7 @@ func (u *User) ToStorage(hashedPassword string) *UserStorage {
 		Username:       u.Username,
 		HashedPassword: hashedPassword,
 		CreatedAt:      u.CreatedAt,
+		Profile:        u.Profile,
 	}
 }
 
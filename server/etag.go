@@ -0,0 +1,103 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedVersion never equals a stored task version, so conditional writes using it always fail
+const unmatchedVersion = -1
+
+// taskETag returns the strong entity tag of a task, derived from its ID and version
+func taskETag(task *domain.Task) string {
+	return fmt.Sprintf(`"%d-%d"`, task.ID, task.Version)
+}
+
+// tasksETag returns a weak entity tag for a list of tasks
+func tasksETag(tasks []*domain.Task, total int) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d", total)
+	for _, task := range tasks {
+		fmt.Fprintf(hash, ";%d-%d", task.ID, task.Version)
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+}
+
+// splitETags splits an If-Match or If-None-Match header value into entity tags
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ifMatchVersion evaluates the If-Match header against the current task.
+// It returns the version a conditional write must expect: AnyVersion when no
+// precondition applies, and false when the precondition already fails.
+func ifMatchVersion(c *gin.Context, task *domain.Task) (int, bool) {
+	return matchVersion(c.GetHeader("If-Match"), task)
+}
+
+// matchVersion evaluates an If-Match value against the current task
+func matchVersion(header string, task *domain.Task) (int, bool) {
+	if header == "" {
+		return store.AnyVersion, true
+	}
+
+	current := taskETag(task)
+	for _, tag := range splitETags(header) {
+		// If-Match uses the strong comparison, so weak tags never match
+		if tag == "*" || tag == current {
+			return task.Version, true
+		}
+	}
+	return unmatchedVersion, false
+}
+
+// notModified reports whether the If-None-Match header matches etag
+func notModified(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	// If-None-Match uses the weak comparison
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, tag := range splitETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// respondPreconditionFailed aborts a write whose If-Match precondition did not hold
+func respondPreconditionFailed(c *gin.Context, task *domain.Task) {
+	if task != nil {
+		c.Header("ETag", taskETag(task))
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Task has been modified"})
+}
+
+// respondTaskStoreError maps errors from conditional store writes to responses
+func respondTaskStoreError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	case errors.Is(err, store.ErrVersionMismatch):
+		respondPreconditionFailed(c, nil)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save task"})
+	}
+}
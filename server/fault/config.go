@@ -0,0 +1,126 @@
+package fault
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Config describes which requests are disturbed and how
+type Config struct {
+	// Seed makes the injected faults reproducible. 0 seeds from the current time.
+	Seed  int64  `json:"seed"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule applies faults to the requests it matches.
+// For each request the first matching rule is used.
+type Rule struct {
+	// Methods limits the rule to these HTTP methods. Empty matches every method.
+	Methods []string `json:"methods,omitempty"`
+	// Routes limits the rule to these routes. Each entry is a gin route pattern
+	// such as "/tasks/:id" or a glob such as "/tasks/*", optionally prefixed by
+	// a method ("POST /tasks"). Empty matches every route.
+	Routes []string `json:"routes,omitempty"`
+
+	LatencyMs int `json:"latency_ms,omitempty"`
+	// JitterMs adds a random delay of up to this many milliseconds to LatencyMs
+	JitterMs int `json:"jitter_ms,omitempty"`
+
+	// Rates are percentages between 0 and 100
+	ErrorRate    float64 `json:"error_rate,omitempty"`
+	ResetRate    float64 `json:"reset_rate,omitempty"`
+	TruncateRate float64 `json:"truncate_rate,omitempty"`
+
+	// ErrorStatuses are the status codes injected errors pick from (5xx or 429).
+	// Defaults to 500.
+	ErrorStatuses []int `json:"error_statuses,omitempty"`
+}
+
+// Enabled reports whether the config injects any fault
+func (c *Config) Enabled() bool {
+	return len(c.Rules) > 0
+}
+
+// Validate checks that every rule of the config is usable
+func (c *Config) Validate() error {
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	for _, method := range r.Methods {
+		if !isHTTPMethod(method) {
+			return fmt.Errorf("invalid method: %s", method)
+		}
+	}
+
+	for _, route := range r.Routes {
+		if _, err := parseRoute(route); err != nil {
+			return err
+		}
+	}
+
+	if r.LatencyMs < 0 || r.JitterMs < 0 {
+		return fmt.Errorf("latency_ms and jitter_ms must not be negative")
+	}
+
+	for name, rate := range map[string]float64{
+		"error_rate":    r.ErrorRate,
+		"reset_rate":    r.ResetRate,
+		"truncate_rate": r.TruncateRate,
+	} {
+		if rate < 0 || rate > 100 {
+			return fmt.Errorf("%s must be between 0 and 100", name)
+		}
+	}
+
+	for _, status := range r.ErrorStatuses {
+		if status != http.StatusTooManyRequests && (status < 500 || status > 599) {
+			return fmt.Errorf("invalid error status: %d (must be 429 or 5xx)", status)
+		}
+	}
+
+	return nil
+}
+
+// route is a parsed entry of Rule.Routes
+type route struct {
+	method  string
+	pattern string
+}
+
+func parseRoute(value string) (route, error) {
+	value = strings.TrimSpace(value)
+
+	var r route
+	if method, pattern, found := strings.Cut(value, " "); found {
+		r.method = strings.ToUpper(method)
+		r.pattern = strings.TrimSpace(pattern)
+		if !isHTTPMethod(r.method) {
+			return route{}, fmt.Errorf("invalid method in route %q", value)
+		}
+	} else {
+		r.pattern = value
+	}
+
+	if !strings.HasPrefix(r.pattern, "/") {
+		return route{}, fmt.Errorf("invalid route %q (must start with '/')", value)
+	}
+
+	return r, nil
+}
+
+func isHTTPMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,42 @@
+package fault
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes the injector configuration for changes at runtime
+type Handler struct {
+	injector *Injector
+}
+
+func NewHandler(injector *Injector) *Handler {
+	return &Handler{
+		injector: injector,
+	}
+}
+
+func (h *Handler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.injector.Config())
+}
+
+func (h *Handler) UpdateConfig(c *gin.Context) {
+	var config Config
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if err := h.injector.SetConfig(config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.injector.Config())
+}
+
+func (h *Handler) ResetConfig(c *gin.Context) {
+	h.injector.Reset()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,276 @@
+package fault
+
+import (
+	"bytes"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InjectedHeader names the kind of fault on responses produced by the injector
+const InjectedHeader = "X-Fault-Injected"
+
+type faultKind int
+
+const (
+	faultNone faultKind = iota
+	faultReset
+	faultError
+	faultTruncate
+)
+
+// plan is the outcome of the dice rolls for a single request
+type plan struct {
+	delay  time.Duration
+	fault  faultKind
+	status int
+}
+
+// compiledRule is a validated rule with its routes parsed
+type compiledRule struct {
+	Rule
+	routes []route
+}
+
+// Injector disturbs requests according to its current Config
+type Injector struct {
+	mu     sync.Mutex
+	config Config
+	rules  []compiledRule
+	rng    *rand.Rand
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Config returns the current configuration
+func (i *Injector) Config() Config {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.config
+}
+
+// SetConfig replaces the configuration and reseeds the random source,
+// so the same config always produces the same sequence of faults
+func (i *Injector) SetConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	rules := make([]compiledRule, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		compiled := compiledRule{Rule: rule}
+		for _, value := range rule.Routes {
+			r, _ := parseRoute(value)
+			compiled.routes = append(compiled.routes, r)
+		}
+		rules = append(rules, compiled)
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.config = config
+	i.rules = rules
+	i.rng = rand.New(rand.NewSource(seed))
+	return nil
+}
+
+// Reset disables all faults
+func (i *Injector) Reset() {
+	_ = i.SetConfig(Config{})
+}
+
+// Middleware returns a gin middleware applying the configured faults.
+// Requests to /internal are never disturbed so faults can always be turned off again.
+func (i *Injector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/internal/") {
+			c.Next()
+			return
+		}
+
+		p, ok := i.plan(c.Request.Method, c.FullPath(), c.Request.URL.Path)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if p.delay > 0 {
+			timer := time.NewTimer(p.delay)
+			select {
+			case <-timer.C:
+			case <-c.Request.Context().Done():
+				timer.Stop()
+				c.Abort()
+				return
+			}
+		}
+
+		switch p.fault {
+		case faultReset:
+			resetConnection(c)
+		case faultError:
+			injectError(c, p.status)
+		case faultTruncate:
+			truncateResponse(c)
+		default:
+			c.Next()
+		}
+	}
+}
+
+// plan rolls the dice for a request. The same number of random values is drawn
+// for every matched request, so a seed yields the same faults for the same
+// sequence of requests regardless of which faults are enabled.
+func (i *Injector) plan(method, fullPath, requestPath string) (plan, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	rule := i.match(method, fullPath, requestPath)
+	if rule == nil {
+		return plan{}, false
+	}
+
+	jitter := i.rng.Float64()
+	resetRoll := i.rng.Float64() * 100
+	errorRoll := i.rng.Float64() * 100
+	statusRoll := i.rng.Intn(1 << 30)
+	truncateRoll := i.rng.Float64() * 100
+
+	p := plan{
+		delay: time.Duration(rule.LatencyMs)*time.Millisecond +
+			time.Duration(jitter*float64(rule.JitterMs))*time.Millisecond,
+	}
+
+	switch {
+	case resetRoll < rule.ResetRate:
+		p.fault = faultReset
+	case errorRoll < rule.ErrorRate:
+		p.fault = faultError
+		p.status = http.StatusInternalServerError
+		if len(rule.ErrorStatuses) > 0 {
+			p.status = rule.ErrorStatuses[statusRoll%len(rule.ErrorStatuses)]
+		}
+	case truncateRoll < rule.TruncateRate:
+		p.fault = faultTruncate
+	}
+
+	return p, true
+}
+
+func (i *Injector) match(method, fullPath, requestPath string) *compiledRule {
+	for idx := range i.rules {
+		rule := &i.rules[idx]
+
+		if len(rule.Methods) > 0 && !containsFold(rule.Methods, method) {
+			continue
+		}
+
+		if len(rule.routes) == 0 {
+			return rule
+		}
+		for _, r := range rule.routes {
+			if r.method != "" && r.method != method {
+				continue
+			}
+			if r.pattern == fullPath || r.pattern == requestPath {
+				return rule
+			}
+			if matched, _ := path.Match(r.pattern, requestPath); matched {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func injectError(c *gin.Context, status int) {
+	c.Header(InjectedHeader, "error")
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": "Injected fault"})
+}
+
+// resetConnection closes the client connection without sending a response
+func resetConnection(c *gin.Context) {
+	c.Abort()
+
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		// The connection cannot be taken over (e.g. HTTP/2), fall back to an error
+		injectError(c, http.StatusBadGateway)
+		return
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		// Discard unsent data and send RST instead of FIN
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// truncatingWriter holds back the response body so only part of it is sent
+type truncatingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *truncatingWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *truncatingWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// truncateResponse runs the handler, then sends the full Content-Length but
+// only half of the body before closing the connection
+func truncateResponse(c *gin.Context) {
+	writer := &truncatingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	body := writer.body.Bytes()
+	if len(body) == 0 {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	c.Header(InjectedHeader, "truncate")
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	c.Writer.WriteHeaderNow()
+	_, _ = c.Writer.Write(body[:len(body)/2])
+	c.Writer.Flush()
+
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		_ = conn.Close()
+	}
+}
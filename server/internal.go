@@ -0,0 +1,292 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/KasumiMercury/mock-todo-server/export"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidSnapshot is returned by LoadState for a snapshot with missing or duplicate IDs
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// SeedRequest is the request body of POST /internal/seed
+type SeedRequest struct {
+	// Append keeps the current data instead of resetting it first
+	Append bool       `json:"append"`
+	Users  []SeedUser `json:"users"`
+	Tasks  []SeedTask `json:"tasks"`
+}
+
+// SeedUser is a fixture user with a plain text password and optional profile claims
+type SeedUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	domain.Profile
+}
+
+// SeedTask is a fixture task. Its owner is given either by user_id or by username.
+type SeedTask struct {
+	domain.Task
+	Username string `json:"username,omitempty"`
+}
+
+// ResetState removes all tasks, users, registered clients, sessions and authorization
+// codes and restarts the ID counters at 1
+func (s *Server) ResetState() error {
+	return s.LoadState(&export.FileData{})
+}
+
+// LoadState replaces all data with the given snapshot, as returned by GetMemoryState.
+// ID counters continue after the highest IDs of the snapshot, and sessions and
+// authorization codes are discarded.
+// Users, tasks and registered clients are replaced together, so a failure leaves the
+// previous data in place.
+// A snapshot that fails validation is reported with ErrInvalidSnapshot.
+func (s *Server) LoadState(data *export.FileData) error {
+	if err := validateSnapshot(data); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	users := make([]*domain.User, 0, len(data.Users))
+	for _, userStorage := range data.Users {
+		users = append(users, userStorage.ToUser())
+	}
+
+	if err := s.stateStore.ReplaceAll(users, data.Tasks, data.Clients); err != nil {
+		return fmt.Errorf("failed to replace state: %w", err)
+	}
+
+	s.clearAuthState()
+	return nil
+}
+
+// clearAuthState invalidates everything that refers to the previous users
+func (s *Server) clearAuthState() {
+	s.authService.ClearSessions()
+	s.authService.ClearRefreshTokens()
+	if s.oidcService != nil {
+		s.oidcService.ClearAuthCodes()
+		s.oidcService.ClearConsents()
+	}
+}
+
+// validateSnapshot checks that IDs, usernames and client IDs in a snapshot are unique
+func validateSnapshot(data *export.FileData) error {
+	taskIDs := make(map[int]bool, len(data.Tasks))
+	for _, task := range data.Tasks {
+		if task == nil || task.ID < 1 {
+			return fmt.Errorf("every task needs a positive id")
+		}
+		if taskIDs[task.ID] {
+			return fmt.Errorf("duplicate task id: %d", task.ID)
+		}
+		taskIDs[task.ID] = true
+	}
+
+	userIDs := make(map[int]bool, len(data.Users))
+	usernames := make(map[string]bool, len(data.Users))
+	for _, user := range data.Users {
+		if user == nil || user.ID < 1 {
+			return fmt.Errorf("every user needs a positive id")
+		}
+		if userIDs[user.ID] {
+			return fmt.Errorf("duplicate user id: %d", user.ID)
+		}
+		if user.Username == "" {
+			return fmt.Errorf("user %d has no username", user.ID)
+		}
+		if usernames[user.Username] {
+			return fmt.Errorf("duplicate username: %s", user.Username)
+		}
+		userIDs[user.ID] = true
+		usernames[user.Username] = true
+	}
+
+	clientIDs := make(map[string]bool, len(data.Clients))
+	for _, client := range data.Clients {
+		if client == nil || client.ClientID == "" {
+			return fmt.Errorf("every client needs a client_id")
+		}
+		if clientIDs[client.ClientID] {
+			return fmt.Errorf("duplicate client id: %s", client.ClientID)
+		}
+		clientIDs[client.ClientID] = true
+	}
+
+	return nil
+}
+
+// RotateKeyResponse is the response body of POST /internal/keys/rotate
+type RotateKeyResponse struct {
+	Kid  string       `json:"kid"`
+	Keys *auth.JWKSet `json:"keys"`
+}
+
+func (s *Server) rotateKeyHandler(c *gin.Context) {
+	key, err := s.authService.RotateSigningKey()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jwkSet, err := s.authService.GetJWKSet()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, RotateKeyResponse{Kid: key.Kid, Keys: jwkSet})
+}
+
+func (s *Server) resetHandler(c *gin.Context) {
+	if err := s.ResetState(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) putMemoryStateHandler(c *gin.Context) {
+	var data export.FileData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if err := s.LoadState(&data); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidSnapshot) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.getMemoryStateHandler(c)
+}
+
+// seedHandler loads fixtures. Without a body the sample data of the store template is loaded.
+func (s *Server) seedHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		sampleData, err := export.SampleData()
+		if err == nil {
+			err = s.LoadState(sampleData)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"users": s.userStore.GetAll(), "tasks": s.taskStore.GetAll()})
+		return
+	}
+
+	var req SeedRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if err := s.validateSeed(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.Append {
+		if err := s.ResetState(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userIDs := make(map[string]int, len(req.Users))
+	users := make([]*domain.User, 0, len(req.Users))
+	for _, seedUser := range req.Users {
+		hashedPassword, err := s.authService.HashPassword(seedUser.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		user := s.userStore.Create(&domain.User{Username: seedUser.Username, HashedPassword: hashedPassword, Profile: seedUser.Profile})
+		if user == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+			return
+		}
+		userIDs[user.Username] = user.ID
+		users = append(users, user)
+	}
+
+	tasks := make([]*domain.Task, 0, len(req.Tasks))
+	for _, seedTask := range req.Tasks {
+		task := seedTask.Task
+		if seedTask.Username != "" {
+			if id, ok := userIDs[seedTask.Username]; ok {
+				task.UserID = id
+			} else if user, ok := s.userStore.GetByUsername(seedTask.Username); ok {
+				task.UserID = user.ID
+			}
+		}
+
+		createdTask := s.taskStore.Create(&task)
+		if createdTask == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save task"})
+			return
+		}
+		tasks = append(tasks, createdTask)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"users": users, "tasks": tasks})
+}
+
+// validateSeed checks the fixtures before anything is changed, so a bad
+// request leaves the current data untouched
+func (s *Server) validateSeed(req *SeedRequest) error {
+	usernames := make(map[string]bool, len(req.Users))
+	for i, user := range req.Users {
+		user.Username = strings.TrimSpace(user.Username)
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("user %d: username and password are required", i)
+		}
+		if usernames[user.Username] {
+			return fmt.Errorf("duplicate username: %s", user.Username)
+		}
+		if _, exists := s.userStore.GetByUsername(user.Username); exists && req.Append {
+			return fmt.Errorf("username already exists: %s", user.Username)
+		}
+		usernames[user.Username] = true
+		req.Users[i] = user
+	}
+
+	for i := range req.Tasks {
+		task := &req.Tasks[i]
+		if err := validateTask(&task.Task); err != nil {
+			return fmt.Errorf("task %d: %w", i, err)
+		}
+
+		if task.Username == "" || usernames[task.Username] {
+			continue
+		}
+		if _, exists := s.userStore.GetByUsername(task.Username); !exists || !req.Append {
+			return fmt.Errorf("task %d: unknown username: %s", i, task.Username)
+		}
+	}
+
+	return nil
+}
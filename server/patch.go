@@ -0,0 +1,361 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// jsonPatchOperation is a single RFC 6902 operation
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// decodeJSONDocument decodes JSON into generic values, keeping numbers exact
+func decodeJSONDocument(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON document")
+	}
+	return doc, nil
+}
+
+// applyMergePatch applies an RFC 7386 JSON Merge Patch to target
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = applyMergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies RFC 6902 JSON Patch operations to doc in order.
+// The first failing operation aborts the whole patch.
+func applyJSONPatch(doc interface{}, operations []jsonPatchOperation) (interface{}, error) {
+	for i, op := range operations {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyJSONPatchOperation(doc interface{}, op jsonPatchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("missing path")
+	}
+	path, err := parseJSONPointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		value, err := decodeJSONDocument(*op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+
+		switch op.Op {
+		case "add":
+			return addValue(doc, path, value)
+		case "replace":
+			// Replacing the root replaces the whole document (RFC 6902 section 4.3)
+			if len(path) == 0 {
+				return value, nil
+			}
+			if _, err := getValue(doc, path); err != nil {
+				return nil, err
+			}
+			doc, _, err = removeValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			return addValue(doc, path, value)
+		default:
+			current, err := getValue(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !jsonEqual(current, value) {
+				return nil, fmt.Errorf("test failed for path %s", *op.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		doc, _, err = removeValue(doc, path)
+		return doc, err
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("missing from")
+		}
+		from, err := parseJSONPointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("cannot move a value into one of its children")
+			}
+			doc, value, err = removeValue(doc, from)
+		} else {
+			value, err = getValue(doc, from)
+			if err == nil {
+				value, err = deepCopy(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	default:
+		return nil, fmt.Errorf("unsupported operation")
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+	for _, token := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found: /%s", strings.Join(path, "/"))
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path not found: /%s", strings.Join(path, "/"))
+		}
+	}
+	return current, nil
+}
+
+// addValue adds value at path and returns the (possibly replaced) document
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			index, err = arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		updated := make([]interface{}, 0, len(node)+1)
+		updated = append(updated, node[:index]...)
+		updated = append(updated, value)
+		updated = append(updated, node[index:]...)
+		return setValue(doc, path[:len(path)-1], updated)
+	default:
+		return nil, fmt.Errorf("cannot add to a non-container value")
+	}
+}
+
+// removeValue removes the value at path and returns the document and the removed value
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path not found: /%s", strings.Join(path, "/"))
+		}
+		delete(node, token)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[index]
+		updated := make([]interface{}, 0, len(node)-1)
+		updated = append(updated, node[:index]...)
+		updated = append(updated, node[index+1:]...)
+		doc, err = setValue(doc, path[:len(path)-1], updated)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("path not found: /%s", strings.Join(path, "/"))
+	}
+}
+
+// setValue replaces the value at an existing path, which is needed for arrays
+// because resizing them creates a new slice
+func setValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+	case []interface{}:
+		index, err := arrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = value
+	}
+	return doc, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (index == length && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of bounds", index)
+	}
+	return index, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONDocument(data)
+}
+
+// jsonEqual compares two decoded JSON values, treating equal numbers as equal
+// regardless of their textual representation
+func jsonEqual(a, b interface{}) bool {
+	an, aIsNumber := a.(json.Number)
+	bn, bIsNumber := b.(json.Number)
+	if aIsNumber && bIsNumber {
+		af, errA := an.Float64()
+		bf, errB := bn.Float64()
+		return errA == nil && errB == nil && af == bf
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			other, exists := bv[key]
+			if !exists || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -12,31 +15,66 @@ import (
 
 type TaskHandler struct {
 	store        store.TaskStore
+	userStore    store.UserStore
 	authRequired bool
 }
 
-func NewTaskHandler(store store.TaskStore, authRequired bool) *TaskHandler {
+func NewTaskHandler(store store.TaskStore, userStore store.UserStore, authRequired bool) *TaskHandler {
 	return &TaskHandler{
 		store:        store,
+		userStore:    userStore,
 		authRequired: authRequired,
 	}
 }
 
+// scopedToUser reports whether the request only reaches the tasks of the authenticated user.
+// Service clients authenticated with client credentials reach all tasks, like requests
+// to a server without authentication.
+func (h *TaskHandler) scopedToUser(c *gin.Context) bool {
+	return h.authRequired && !auth.IsServiceClient(c)
+}
+
+// checkOwner validates the user_id a service client gives for a new task.
+// Service clients act for no user, so they must name the owner explicitly.
+func (h *TaskHandler) checkOwner(userID int) error {
+	if userID < 1 {
+		return fmt.Errorf("user_id is required when creating tasks with client credentials")
+	}
+	if _, exists := h.userStore.GetByID(userID); !exists {
+		return fmt.Errorf("user_id %d does not refer to an existing user", userID)
+	}
+	return nil
+}
+
 func (h *TaskHandler) GetTasks(c *gin.Context) {
-	if h.authRequired {
+	query, err := parseTaskQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.scopedToUser(c) {
 		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
-		tasks := h.store.GetAllByUserID(userID)
-		c.JSON(http.StatusOK, tasks)
-	} else {
-		// No authentication required, return all tasks
-		tasks := h.store.GetAll()
-		c.JSON(http.StatusOK, tasks)
+		query.UserID = &userID
+	}
+	// Without authentication the query spans all tasks
+
+	page := h.store.Query(query)
+	setPaginationHeaders(c, query, page)
+
+	etag := tasksETag(page.Tasks, page.Total)
+	c.Header("ETag", etag)
+	if notModified(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
 	}
+
+	c.JSON(http.StatusOK, page.Tasks)
 }
 
 func (h *TaskHandler) CreateTask(c *gin.Context) {
@@ -46,7 +84,13 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
-	if h.authRequired {
+	if err := validateTask(&task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case h.scopedToUser(c):
 		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -54,12 +98,24 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		}
 		// Set the user ID for the task
 		task.UserID = userID
-	} else {
+	case h.authRequired:
+		// Service clients keep the user_id of the request body
+		if err := h.checkOwner(task.UserID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	default:
 		// No authentication required, set UserID to 0 (anonymous)
 		task.UserID = 0
 	}
 
 	createdTask := h.store.Create(&task)
+	if createdTask == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save task"})
+		return
+	}
+
+	c.Header("ETag", taskETag(createdTask))
 	c.JSON(http.StatusCreated, createdTask)
 }
 
@@ -77,7 +133,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		return
 	}
 
-	if h.authRequired {
+	if h.scopedToUser(c) {
 		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -90,6 +146,13 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		}
 	}
 
+	etag := taskETag(task)
+	c.Header("ETag", etag)
+	if notModified(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, task)
 }
 
@@ -108,7 +171,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
-	if h.authRequired {
+	if h.scopedToUser(c) {
 		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
@@ -121,13 +184,24 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		}
 	}
 
+	version, ok := ifMatchVersion(c, existingTask)
+	if !ok {
+		respondPreconditionFailed(c, existingTask)
+		return
+	}
+
 	var updatedTask domain.Task
 	if err := c.ShouldBindJSON(&updatedTask); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
 		return
 	}
 
-	if h.authRequired {
+	if err := validateTask(&updatedTask); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.scopedToUser(c) {
 		userID, _ := auth.GetUserIDFromContext(c)
 		// Ensure the task still belongs to the same user
 		updatedTask.UserID = userID
@@ -136,16 +210,18 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		updatedTask.UserID = existingTask.UserID
 	}
 
-	task, exists := h.store.Update(id, &updatedTask)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	task, err := h.store.UpdateIfVersion(id, version, &updatedTask)
+	if err != nil {
+		respondTaskStoreError(c, err)
 		return
 	}
 
+	c.Header("ETag", taskETag(task))
 	c.JSON(http.StatusOK, task)
 }
 
-func (h *TaskHandler) DeleteTask(c *gin.Context) {
+// PatchTask partially updates a task with a JSON Merge Patch (RFC 7386) or a JSON Patch (RFC 6902)
+func (h *TaskHandler) PatchTask(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -153,17 +229,131 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
-	if h.authRequired {
+	// Check if the task exists
+	existingTask, exists := h.store.GetByID(id)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	if h.scopedToUser(c) {
 		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
+		// Check if the task belongs to the authenticated user
+		if existingTask.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+	}
+
+	version, ok := ifMatchVersion(c, existingTask)
+	if !ok {
+		respondPreconditionFailed(c, existingTask)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || (contentType != mergePatchContentType && contentType != jsonPatchContentType) {
+		c.Header("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "Content-Type must be " + mergePatchContentType + " or " + jsonPatchContentType,
+		})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	existingJSON, err := json.Marshal(existingTask)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode task"})
+		return
+	}
+	document, err := decodeJSONDocument(existingJSON)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode task"})
+		return
+	}
+
+	if contentType == mergePatchContentType {
+		patch, err := decodeJSONDocument(body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		if _, ok := patch.(map[string]interface{}); !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Merge patch must be a JSON object"})
+			return
+		}
+		document = applyMergePatch(document, patch)
+	} else {
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
+		document, err = applyJSONPatch(document, operations)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	patchedJSON, err := json.Marshal(document)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode task"})
+		return
+	}
+
+	var patchedTask domain.Task
+	if err := json.Unmarshal(patchedJSON, &patchedTask); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patched task is invalid: " + err.Error()})
+		return
+	}
+
+	if err := validateTask(&patchedTask); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Check if the task exists and belongs to the user
-		existingTask, exists := h.store.GetByID(id)
+	// Server-managed fields cannot be patched
+	patchedTask.UserID = existingTask.UserID
+
+	task, err := h.store.UpdateIfVersion(id, version, &patchedTask)
+	if err != nil {
+		respondTaskStoreError(c, err)
+		return
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, task)
+}
+
+func (h *TaskHandler) DeleteTask(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+
+	// Check if the task exists
+	existingTask, exists := h.store.GetByID(id)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	if h.scopedToUser(c) {
+		userID, exists := auth.GetUserIDFromContext(c)
 		if !exists {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			return
 		}
 
@@ -173,8 +363,14 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 		}
 	}
 
-	if !h.store.Delete(id) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	version, ok := ifMatchVersion(c, existingTask)
+	if !ok {
+		respondPreconditionFailed(c, existingTask)
+		return
+	}
+
+	if err := h.store.DeleteIfVersion(id, version); err != nil {
+		respondTaskStoreError(c, err)
 		return
 	}
 
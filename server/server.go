@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
@@ -16,6 +18,7 @@ import (
 	"github.com/KasumiMercury/mock-todo-server/pid"
 	"github.com/KasumiMercury/mock-todo-server/server/auth"
 	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/fault"
 	"github.com/KasumiMercury/mock-todo-server/server/store"
 	"github.com/gin-gonic/gin"
 )
@@ -28,10 +31,17 @@ type Server struct {
 	server       *http.Server
 	taskStore    store.TaskStore
 	userStore    store.UserStore
+	clientStore  store.ClientStore
+	stateStore   store.StateStore
+	db           *sql.DB
+	dataFile     *store.DataFile
 	authService  *auth.AuthService
 	taskHandler  *TaskHandler
 	authHandler  *auth.AuthHandler
 	oidcHandler  *auth.OIDCHandler
+	oidcService  *auth.OIDCService
+	faultHandler *fault.Handler
+	injector     *fault.Injector
 	authRequired bool
 	authMode     auth.AuthMode
 	ctx          context.Context
@@ -40,44 +50,80 @@ type Server struct {
 
 var serverInstance *Server
 
-func NewServer(filePath string, keyMode auth.JWTKeyMode, secretKey string, authRequired bool, authMode auth.AuthMode, oidcConfigPath string) (*Server, error) {
+func NewServer(filePath, sqlitePath string, keyMode auth.JWTKeyMode, algorithm, secretKey, keyDir string, authRequired bool, authMode auth.AuthMode, oidcConfigPath string) (*Server, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
-	engine.Use(gin.Logger(), gin.Recovery())
+	injector := fault.NewInjector()
+	engine.Use(gin.Logger(), gin.Recovery(), injector.Middleware())
 
 	var taskStore store.TaskStore
 	var userStore store.UserStore
-
-	if filePath == "" {
-		taskStore = store.NewTaskMemoryStore()
-		userStore = store.NewUserMemoryStore()
-	} else {
-		taskStore = store.NewTaskFileStore(filePath)
-		userStore = store.NewUserFileStore(filePath)
+	var clientStore store.ClientStore
+	var stateStore store.StateStore
+	var db *sql.DB
+	var dataFile *store.DataFile
+
+	switch {
+	case sqlitePath != "":
+		var err error
+		db, err = store.OpenSQLite(sqlitePath)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		taskStore = store.NewTaskSQLiteStore(db)
+		userStore = store.NewUserSQLiteStore(db)
+		clientStore = store.NewClientSQLiteStore(db)
+		stateStore = store.NewStateSQLiteStore(db)
+		log.Printf("Using SQLite store at %s", sqlitePath)
+	case filePath != "":
+		var err error
+		dataFile, err = store.OpenDataFile(filePath)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to open data file: %w", err)
+		}
+		taskFileStore := store.NewTaskFileStore(dataFile)
+		userFileStore := store.NewUserFileStore(dataFile)
+		taskStore = taskFileStore
+		userStore = userFileStore
+		clientStore = store.NewClientFileStore(dataFile)
+		stateStore = store.NewStateFileStore(dataFile, taskFileStore, userFileStore)
 		log.Printf("Using file store at %s", filePath)
+	default:
+		taskMemoryStore := store.NewTaskMemoryStore()
+		userMemoryStore := store.NewUserMemoryStore()
+		clientMemoryStore := store.NewClientMemoryStore()
+		taskStore = taskMemoryStore
+		userStore = userMemoryStore
+		clientStore = clientMemoryStore
+		stateStore = store.NewStateMemoryStore(taskMemoryStore, userMemoryStore, clientMemoryStore)
 	}
 
-	authService, err := auth.NewAuthService(userStore, keyMode, secretKey)
+	authService, err := auth.NewAuthService(userStore, keyMode, algorithm, secretKey, keyDir)
 	if err != nil {
 		cancel()
+		closeDB(db)
 		return nil, fmt.Errorf("failed to create auth service: %w", err)
 	}
 
-	taskHandler := NewTaskHandler(taskStore, authRequired)
+	taskHandler := NewTaskHandler(taskStore, userStore, authRequired)
 	authHandler := auth.NewAuthHandler(authService, authMode)
 
 	// Create OIDC handler if OIDC mode is enabled
 	var oidcHandler *auth.OIDCHandler
+	var oidcService *auth.OIDCService
 	if authMode == auth.AuthModeOIDC {
 		oidcConfig, err := auth.LoadOIDCConfig(oidcConfigPath)
 		if err != nil {
 			cancel()
+			closeDB(db)
 			return nil, fmt.Errorf("failed to load OIDC config: %w", err)
 		}
 
-		oidcService := auth.NewOIDCService(oidcConfig, userStore, authService)
+		oidcService = auth.NewOIDCService(oidcConfig, userStore, clientStore, authService)
 		oidcHandler = auth.NewOIDCHandler(oidcService, authService)
 
 		// Load HTML templates for OIDC
@@ -89,10 +135,17 @@ func NewServer(filePath string, keyMode auth.JWTKeyMode, secretKey string, authR
 		engine:       engine,
 		taskStore:    taskStore,
 		userStore:    userStore,
+		clientStore:  clientStore,
+		stateStore:   stateStore,
+		db:           db,
+		dataFile:     dataFile,
 		authService:  authService,
 		taskHandler:  taskHandler,
 		authHandler:  authHandler,
 		oidcHandler:  oidcHandler,
+		oidcService:  oidcService,
+		faultHandler: fault.NewHandler(injector),
+		injector:     injector,
 		authRequired: authRequired,
 		authMode:     authMode,
 		ctx:          ctx,
@@ -100,6 +153,73 @@ func NewServer(filePath string, keyMode auth.JWTKeyMode, secretKey string, authR
 	}, nil
 }
 
+// NewServerFromConfig creates a server with its routes registered from the given config.
+// Unlike Run it does not listen, write PID files or install signal handlers, so it can
+// be used to embed the mock server in another process.
+func NewServerFromConfig(config *Config) (*Server, error) {
+	s, err := NewServer(config.JsonFilePath, config.SQLitePath, config.JWTKeyMode, config.JWTAlgorithm, config.JWTSecretKey, config.JWTKeyDir, config.AuthRequired, config.AuthMode, config.OIDCConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s.authService.SetTokenLifetimes(config.AccessTokenTTL, config.RefreshTokenTTL)
+	s.authService.SetKeyGracePeriod(config.JWTKeyGracePeriod)
+
+	if err := s.injector.SetConfig(config.Faults); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("invalid fault config: %w", err)
+	}
+
+	if config.WatchFile && s.dataFile != nil {
+		if err := s.dataFile.Watch(s.ctx); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	s.setupRoutes()
+
+	return s, nil
+}
+
+// Close releases the resources held by the server, such as the SQLite connection
+func (s *Server) Close() error {
+	s.cancel()
+	return closeDB(s.db)
+}
+
+func closeDB(db *sql.DB) error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
+// Handler returns the HTTP handler serving all registered routes
+func (s *Server) Handler() http.Handler {
+	return s.engine
+}
+
+// FaultInjector returns the injector used to simulate latency and failures
+func (s *Server) FaultInjector() *fault.Injector {
+	return s.injector
+}
+
+// TaskStore returns the task store used by the server
+func (s *Server) TaskStore() store.TaskStore {
+	return s.taskStore
+}
+
+// UserStore returns the user store used by the server
+func (s *Server) UserStore() store.UserStore {
+	return s.userStore
+}
+
+// AuthService returns the authentication service used by the server
+func (s *Server) AuthService() *auth.AuthService {
+	return s.authService
+}
+
 func (s *Server) GetMemoryState() (*export.FileData, error) {
 	tasks := s.taskStore.GetAll()
 	users := s.userStore.GetAll()
@@ -112,8 +232,9 @@ func (s *Server) GetMemoryState() (*export.FileData, error) {
 	}
 
 	return &export.FileData{
-		Tasks: tasks,
-		Users: userStorages,
+		Tasks:   tasks,
+		Users:   userStorages,
+		Clients: s.clientStore.GetAll(),
 	}, nil
 }
 
@@ -136,6 +257,17 @@ func (s *Server) setupRoutes() {
 			authGroup.GET("/authorize", s.oidcHandler.Authorize)
 			authGroup.POST("/authorize", s.oidcHandler.Authorize)
 			authGroup.POST("/token", s.oidcHandler.Token)
+			authGroup.POST("/introspect", s.oidcHandler.Introspect)
+			authGroup.POST("/revoke", s.oidcHandler.Revoke)
+			authGroup.POST("/device_authorization", s.oidcHandler.DeviceAuthorization)
+			authGroup.GET("/device", s.oidcHandler.DeviceVerification)
+			authGroup.POST("/device", s.oidcHandler.DeviceVerification)
+			authGroup.POST("/clients", s.oidcHandler.RegisterClient)
+			authGroup.GET("/clients/:client_id", s.oidcHandler.GetClientRegistration)
+			authGroup.PUT("/clients/:client_id", s.oidcHandler.UpdateClientRegistration)
+			authGroup.DELETE("/clients/:client_id", s.oidcHandler.DeleteClientRegistration)
+			authGroup.GET("/logout", s.oidcHandler.EndSession)
+			authGroup.POST("/logout", s.oidcHandler.EndSession)
 			authGroup.GET("/userinfo", s.oidcHandler.UserInfo)
 			authGroup.GET("/jwks", s.authHandler.GetJWKs)
 			authGroup.GET("/register", s.oidcHandler.Register)
@@ -144,6 +276,7 @@ func (s *Server) setupRoutes() {
 			// Standard auth routes
 			authGroup.POST("/login", s.authHandler.Login)
 			authGroup.POST("/register", s.authHandler.Register)
+			authGroup.POST("/refresh", s.authHandler.Refresh)
 			authGroup.POST("/logout", s.authHandler.Logout)
 			authGroup.GET("/jwks", s.authHandler.GetJWKs)
 		}
@@ -153,6 +286,13 @@ func (s *Server) setupRoutes() {
 	internalGroup := s.engine.Group("/internal")
 	{
 		internalGroup.GET("/memory-state", s.getMemoryStateHandler)
+		internalGroup.PUT("/memory-state", s.putMemoryStateHandler)
+		internalGroup.POST("/reset", s.resetHandler)
+		internalGroup.POST("/seed", s.seedHandler)
+		internalGroup.POST("/keys/rotate", s.rotateKeyHandler)
+		internalGroup.GET("/faults", s.faultHandler.GetConfig)
+		internalGroup.PUT("/faults", s.faultHandler.UpdateConfig)
+		internalGroup.DELETE("/faults", s.faultHandler.ResetConfig)
 	}
 
 	// Standard well-known endpoints (no auth required)
@@ -174,8 +314,10 @@ func (s *Server) setupRoutes() {
 			api.GET("/auth/me", s.authHandler.Me)
 			api.GET("/tasks", s.taskHandler.GetTasks)
 			api.POST("/tasks", s.taskHandler.CreateTask)
+			api.POST("/tasks/batch", s.taskHandler.BatchTasks)
 			api.GET("/tasks/:id", s.taskHandler.GetTask)
 			api.PUT("/tasks/:id", s.taskHandler.UpdateTask)
+			api.PATCH("/tasks/:id", s.taskHandler.PatchTask)
 			api.DELETE("/tasks/:id", s.taskHandler.DeleteTask)
 		}
 	} else {
@@ -192,8 +334,10 @@ func (s *Server) setupRoutes() {
 			// Task routes without auth middleware
 			api.GET("/tasks", s.taskHandler.GetTasks)
 			api.POST("/tasks", s.taskHandler.CreateTask)
+			api.POST("/tasks/batch", s.taskHandler.BatchTasks)
 			api.GET("/tasks/:id", s.taskHandler.GetTask)
 			api.PUT("/tasks/:id", s.taskHandler.UpdateTask)
+			api.PATCH("/tasks/:id", s.taskHandler.PatchTask)
 			api.DELETE("/tasks/:id", s.taskHandler.DeleteTask)
 		}
 	}
@@ -209,7 +353,7 @@ func Run(config *Config) error {
 	}
 
 	var err error
-	serverInstance, err = NewServer(config.JsonFilePath, config.JWTKeyMode, config.JWTSecretKey, config.AuthRequired, config.AuthMode, config.OIDCConfigPath)
+	serverInstance, err = NewServerFromConfig(config)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
@@ -217,8 +361,6 @@ func Run(config *Config) error {
 	// Set server instance as export provider
 	export.SetServerProvider(serverInstance)
 
-	serverInstance.setupRoutes()
-
 	addr := fmt.Sprintf(":%d", config.Port)
 	serverInstance.server = &http.Server{
 		Addr:    addr,
@@ -258,6 +400,10 @@ func Run(config *Config) error {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	if err := serverInstance.Close(); err != nil {
+		log.Printf("Failed to close server: %v", err)
+	}
+
 	if err := os.Remove(pid.PidFile); err != nil {
 		log.Printf("Failed to remove PID file: %v", err)
 	}
@@ -283,6 +429,50 @@ func Stop() error {
 	return pid.StopByPid()
 }
 
+// RotateKey rotates the signing key of the running server and returns the new key ID
+func RotateKey() (string, error) {
+	if !pid.CheckRunning() {
+		return "", fmt.Errorf("server is not running")
+	}
+
+	if serverInstance != nil {
+		key, err := serverInstance.authService.RotateSigningKey()
+		if err != nil {
+			return "", err
+		}
+		return key.Kid, nil
+	}
+
+	serverInfo, err := pid.GetServerInfo()
+	if err != nil {
+		return "", fmt.Errorf("failed to get server info: %w", err)
+	}
+
+	url := fmt.Sprintf("http://localhost:%d/internal/keys/rotate", serverInfo.Port)
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to internal API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error != "" {
+			return "", fmt.Errorf("internal API returned %s: %s", resp.Status, errResp.Error)
+		}
+		return "", fmt.Errorf("internal API returned status: %s", resp.Status)
+	}
+
+	var rotated RotateKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotated); err != nil {
+		return "", fmt.Errorf("failed to parse internal API response: %w", err)
+	}
+
+	return rotated.Kid, nil
+}
+
 func GetServerInstance() *Server {
 	return serverInstance
 }
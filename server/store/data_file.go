@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/goccy/go-json"
+)
+
+// DataFile is the JSON data file shared by TaskFileStore and UserFileStore.
+// Both stores lock the same mutex, so a write through one store never
+// interleaves with a read-modify-write of the other.
+type DataFile struct {
+	path string
+	mu   sync.RWMutex
+
+	// content is the last content read or written by this process, used to
+	// tell changes made by other processes apart from our own writes
+	content  []byte
+	onReload []func(data *FileData)
+}
+
+// OpenDataFile prepares the data file at path, creating an empty one if it does not exist.
+// It fails if the existing file cannot be parsed, rather than starting with empty data
+// and overwriting the file on the next write.
+func OpenDataFile(path string) (*DataFile, error) {
+	file := &DataFile{path: path}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := file.save(emptyFileData()); err != nil {
+			return nil, fmt.Errorf("failed to create data file: %w", err)
+		}
+		return file, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+	if _, err := parseFileData(path, content); err != nil {
+		return nil, err
+	}
+	file.content = content
+
+	return file, nil
+}
+
+// Path returns the path of the data file
+func (f *DataFile) Path() string {
+	return f.path
+}
+
+// load reads and parses the data file. The caller must hold the lock.
+func (f *DataFile) load() (*FileData, error) {
+	content, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return emptyFileData(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	return parseFileData(f.path, content)
+}
+
+// loadLatest reads the data file for a read-modify-write. If another process has
+// changed the file since it was last read or written, the reload hooks run first so
+// that ID counters never collide with the new content. The caller must hold the write lock.
+func (f *DataFile) loadLatest() (*FileData, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	data, err := parseFileData(f.path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(content, f.content) {
+		previous, _ := parseFileData(f.path, f.content)
+		f.content = content
+		for _, fn := range f.onReload {
+			fn(data)
+		}
+		log.Printf("Reloaded data file %s: %s", f.path, summarizeChanges(previous, data))
+	}
+
+	return data, nil
+}
+
+// loadForRead reads the data file for a read-only operation, logging failures.
+// The caller must hold the lock.
+func (f *DataFile) loadForRead() (*FileData, bool) {
+	data, err := f.load()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return nil, false
+	}
+	return data, true
+}
+
+// save writes data to the data file atomically. The caller must hold the write lock.
+func (f *DataFile) save(data *FileData) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	if err := writeFileAtomic(f.path, jsonData); err != nil {
+		return err
+	}
+
+	f.content = jsonData
+	return nil
+}
+
+// addReloadHook registers fn to be called with the new content after the file
+// was changed by another process. It runs with the write lock held.
+func (f *DataFile) addReloadHook(fn func(data *FileData)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.onReload = append(f.onReload, fn)
+}
+
+func emptyFileData() *FileData {
+	return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
+}
+
+// parseFileData parses the content of a data file, reporting the line and
+// column of syntax and type errors
+func parseFileData(path string, content []byte) (*FileData, error) {
+	// Handle empty file
+	if len(bytes.TrimSpace(content)) == 0 {
+		return emptyFileData(), nil
+	}
+
+	var data FileData
+	if err := json.Unmarshal(content, &data); err != nil {
+		var offset int64 = -1
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+		}
+
+		if offset >= 0 {
+			line, column := lineAndColumn(content, offset)
+			return nil, fmt.Errorf("invalid data file %s at line %d, column %d: %w", path, line, column, err)
+		}
+		return nil, fmt.Errorf("invalid data file %s: %w", path, err)
+	}
+
+	// Initialize empty arrays if nil
+	if data.Tasks == nil {
+		data.Tasks = []*domain.Task{}
+	}
+	if data.Users == nil {
+		data.Users = []*domain.UserStorage{}
+	}
+
+	// Fill fields missing from data files written by older versions
+	for _, task := range data.Tasks {
+		task.ApplyDefaults()
+	}
+
+	return &data, nil
+}
+
+// lineAndColumn converts a byte offset into a 1-based line and column
+func lineAndColumn(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// writeFileAtomic replaces the file at path so that a crash leaves either the
+// old or the new content, never a partially written file
+func writeFileAtomic(path string, content []byte) (err error) {
+	perm := os.FileMode(0644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself
+	if d, dirErr := os.Open(dir); dirErr == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -2,56 +2,75 @@ package store
 
 import (
 	"github.com/KasumiMercury/mock-todo-server/server/domain"
-	"github.com/goccy/go-json"
 	"log"
-	"os"
-	"sync"
+	"slices"
 	"time"
 )
 
 type FileData struct {
-	Tasks []*domain.Task        `json:"tasks"`
-	Users []*domain.UserStorage `json:"users"`
+	Tasks   []*domain.Task        `json:"tasks"`
+	Users   []*domain.UserStorage `json:"users"`
+	Clients []*domain.Client      `json:"clients,omitempty"`
 }
 
+// TaskFileStore, UserFileStore and ClientFileStore keep their data in a shared DataFile
 type TaskFileStore struct {
-	filePath   string
+	file       *DataFile
 	nextTaskID int
-	mu         sync.RWMutex
 }
 
 type UserFileStore struct {
-	filePath   string
+	file       *DataFile
 	nextUserID int
-	mu         sync.RWMutex
 }
 
-func NewTaskFileStore(filePath string) *TaskFileStore {
+type ClientFileStore struct {
+	file *DataFile
+}
+
+func NewTaskFileStore(file *DataFile) *TaskFileStore {
 	store := &TaskFileStore{
-		filePath:   filePath,
+		file:       file,
 		nextTaskID: 1,
 	}
 
-	// Initialize nextTaskID based on existing tasks
+	// Initialize nextTaskID based on existing tasks, and again whenever the file is edited
 	store.initializeNextTaskID()
+	file.addReloadHook(store.setNextTaskID)
 
 	return store
 }
 
-func NewUserFileStore(filePath string) *UserFileStore {
+func NewUserFileStore(file *DataFile) *UserFileStore {
 	store := &UserFileStore{
-		filePath:   filePath,
+		file:       file,
 		nextUserID: 1,
 	}
 
-	// Initialize nextUserID based on existing users
+	// Initialize nextUserID based on existing users, and again whenever the file is edited
 	store.initializeNextUserID()
+	file.addReloadHook(store.setNextUserID)
 
 	return store
 }
 
+func NewClientFileStore(file *DataFile) *ClientFileStore {
+	return &ClientFileStore{file: file}
+}
+
 func (ts *TaskFileStore) initializeNextTaskID() {
-	data := ts.loadDataFromFile()
+	ts.file.mu.RLock()
+	defer ts.file.mu.RUnlock()
+
+	data, ok := ts.file.loadForRead()
+	if !ok {
+		return
+	}
+	ts.setNextTaskID(data)
+}
+
+// setNextTaskID continues the task IDs after the highest ID in data
+func (ts *TaskFileStore) setNextTaskID(data *FileData) {
 	maxID := 0
 	for _, task := range data.Tasks {
 		if task.ID > maxID {
@@ -62,7 +81,18 @@ func (ts *TaskFileStore) initializeNextTaskID() {
 }
 
 func (us *UserFileStore) initializeNextUserID() {
-	data := us.loadDataFromFile()
+	us.file.mu.RLock()
+	defer us.file.mu.RUnlock()
+
+	data, ok := us.file.loadForRead()
+	if !ok {
+		return
+	}
+	us.setNextUserID(data)
+}
+
+// setNextUserID continues the user IDs after the highest ID in data
+func (us *UserFileStore) setNextUserID(data *FileData) {
 	maxID := 0
 	for _, user := range data.Users {
 		if user.ID > maxID {
@@ -73,18 +103,24 @@ func (us *UserFileStore) initializeNextUserID() {
 }
 
 func (ts *TaskFileStore) GetAll() []*domain.Task {
-	ts.mu.RLock()
-	defer ts.mu.RUnlock()
+	ts.file.mu.RLock()
+	defer ts.file.mu.RUnlock()
 
-	data := ts.loadDataFromFile()
+	data, ok := ts.file.loadForRead()
+	if !ok {
+		return []*domain.Task{}
+	}
 	return data.Tasks
 }
 
 func (ts *TaskFileStore) GetAllByUserID(userID int) []*domain.Task {
-	ts.mu.RLock()
-	defer ts.mu.RUnlock()
+	ts.file.mu.RLock()
+	defer ts.file.mu.RUnlock()
 
-	data := ts.loadDataFromFile()
+	data, ok := ts.file.loadForRead()
+	if !ok {
+		return make([]*domain.Task, 0)
+	}
 	tasks := make([]*domain.Task, 0)
 	for _, task := range data.Tasks {
 		if task.UserID == userID {
@@ -94,138 +130,53 @@ func (ts *TaskFileStore) GetAllByUserID(userID int) []*domain.Task {
 	return tasks
 }
 
-func (ts *TaskFileStore) loadDataFromFile() *FileData {
-	// Create empty file if it doesn't exist
-	if _, err := os.Stat(ts.filePath); os.IsNotExist(err) {
-		if err := ts.createEmptyFile(); err != nil {
-			log.Println("Error creating empty data file:", err)
-			return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-		}
-	}
-
-	// Read json file and unmarshal into data
-	file, err := os.ReadFile(ts.filePath)
-	if err != nil {
-		log.Println("Error reading data file:", err)
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
-
-	// Handle empty file
-	if len(file) == 0 {
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
-
-	var data FileData
-	if err := json.Unmarshal(file, &data); err != nil {
-		log.Println("Error unmarshalling data:", err)
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
+func (ts *TaskFileStore) GetByID(id int) (*domain.Task, bool) {
+	ts.file.mu.RLock()
+	defer ts.file.mu.RUnlock()
 
-	// Initialize empty arrays if nil
-	if data.Tasks == nil {
-		data.Tasks = []*domain.Task{}
-	}
-	if data.Users == nil {
-		data.Users = []*domain.UserStorage{}
+	data, ok := ts.file.loadForRead()
+	if !ok {
+		return nil, false
 	}
-
-	return &data
-}
-
-func (us *UserFileStore) loadDataFromFile() *FileData {
-	// Create empty file if it doesn't exist
-	if _, err := os.Stat(us.filePath); os.IsNotExist(err) {
-		if err := us.createEmptyFile(); err != nil {
-			log.Println("Error creating empty data file:", err)
-			return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
+	for _, task := range data.Tasks {
+		if task.ID == id {
+			return task, true
 		}
 	}
-
-	// Read json file and unmarshal into data
-	file, err := os.ReadFile(us.filePath)
-	if err != nil {
-		log.Println("Error reading data file:", err)
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
-
-	// Handle empty file
-	if len(file) == 0 {
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
-
-	var data FileData
-	if err := json.Unmarshal(file, &data); err != nil {
-		log.Println("Error unmarshalling data:", err)
-		return &FileData{Tasks: []*domain.Task{}, Users: []*domain.UserStorage{}}
-	}
-
-	// Initialize empty arrays if nil
-	if data.Tasks == nil {
-		data.Tasks = []*domain.Task{}
-	}
-	if data.Users == nil {
-		data.Users = []*domain.UserStorage{}
-	}
-
-	return &data
+	return nil, false
 }
 
-func (ts *TaskFileStore) createEmptyFile() error {
-	emptyData := FileData{
-		Tasks: []*domain.Task{},
-		Users: []*domain.UserStorage{},
-	}
-	data, err := json.Marshal(emptyData)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(ts.filePath, data, 0644)
-}
+func (ts *TaskFileStore) Query(query *TaskQuery) *TaskPage {
+	ts.file.mu.RLock()
+	defer ts.file.mu.RUnlock()
 
-func (us *UserFileStore) createEmptyFile() error {
-	emptyData := FileData{
-		Tasks: []*domain.Task{},
-		Users: []*domain.UserStorage{},
-	}
-	data, err := json.Marshal(emptyData)
-	if err != nil {
-		return err
+	data, ok := ts.file.loadForRead()
+	if !ok {
+		return QueryTasks(nil, query)
 	}
-	return os.WriteFile(us.filePath, data, 0644)
+	return QueryTasks(data.Tasks, query)
 }
 
-func (ts *TaskFileStore) GetByID(id int) (*domain.Task, bool) {
-	ts.mu.RLock()
-	defer ts.mu.RUnlock()
+func (ts *TaskFileStore) Create(task *domain.Task) *domain.Task {
+	ts.file.mu.Lock()
+	defer ts.file.mu.Unlock()
 
-	data := ts.loadDataFromFile()
-	for _, task := range data.Tasks {
-		if task.ID == id {
-			return task, true
-		}
+	data, err := ts.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return nil
 	}
-	return nil, false
-}
-
-func (ts *TaskFileStore) Create(task *domain.Task) *domain.Task {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
 
 	task.ID = ts.nextTaskID
 	ts.nextTaskID++
 	task.CreatedAt = time.Now().Format(time.RFC3339)
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.ApplyDefaults()
 
-	data := ts.loadDataFromFile()
 	data.Tasks = append(data.Tasks, task)
 
-	// Marshal data to json and write to file
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Println("Error marshalling data:", err)
-		return nil
-	}
-
-	if err := os.WriteFile(ts.filePath, jsonData, 0644); err != nil {
+	if err := ts.file.save(data); err != nil {
 		log.Println("Error writing data file:", err)
 		return nil
 	}
@@ -234,66 +185,149 @@ func (ts *TaskFileStore) Create(task *domain.Task) *domain.Task {
 }
 
 func (ts *TaskFileStore) Update(id int, updatedTask *domain.Task) (*domain.Task, bool) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
+	task, err := ts.UpdateIfVersion(id, AnyVersion, updatedTask)
+	return task, err == nil
+}
+
+func (ts *TaskFileStore) UpdateIfVersion(id, version int, updatedTask *domain.Task) (*domain.Task, error) {
+	ts.file.mu.Lock()
+	defer ts.file.mu.Unlock()
 
-	data := ts.loadDataFromFile()
+	data, err := ts.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return nil, err
+	}
 	for i, task := range data.Tasks {
 		if task.ID == id {
+			if version != AnyVersion && task.Version != version {
+				return nil, ErrVersionMismatch
+			}
+
 			updatedTask.ID = id
 			updatedTask.CreatedAt = task.CreatedAt // Preserve the original creation time
+			updatedTask.UpdatedAt = time.Now().Format(time.RFC3339)
+			updatedTask.Version = task.Version + 1
+			updatedTask.ApplyDefaults()
 			data.Tasks[i] = updatedTask
 
-			// Marshal data to json and write to file
-			jsonData, err := json.Marshal(data)
-			if err != nil {
-				log.Println("Error marshalling data:", err)
-				return nil, false
-			}
-
-			if err := os.WriteFile(ts.filePath, jsonData, 0644); err != nil {
+			if err := ts.file.save(data); err != nil {
 				log.Println("Error writing data file:", err)
-				return nil, false
+				return nil, err
 			}
 
-			return updatedTask, true
+			return updatedTask, nil
 		}
 	}
-	return nil, false
+	return nil, ErrTaskNotFound
 }
 
 func (ts *TaskFileStore) Delete(id int) bool {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
+	return ts.DeleteIfVersion(id, AnyVersion) == nil
+}
 
-	data := ts.loadDataFromFile()
+func (ts *TaskFileStore) DeleteIfVersion(id, version int) error {
+	ts.file.mu.Lock()
+	defer ts.file.mu.Unlock()
+
+	data, err := ts.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
 	for i, task := range data.Tasks {
 		if task.ID == id {
-			data.Tasks = append(data.Tasks[:i], data.Tasks[i+1:]...) // Remove the task
-			// Marshal data to json and write to file
-			jsonData, err := json.Marshal(data)
-			if err != nil {
-				log.Println("Error marshalling data:", err)
-				return false
+			if version != AnyVersion && task.Version != version {
+				return ErrVersionMismatch
 			}
 
-			if err := os.WriteFile(ts.filePath, jsonData, 0644); err != nil {
+			data.Tasks = append(data.Tasks[:i], data.Tasks[i+1:]...) // Remove the task
+			if err := ts.file.save(data); err != nil {
 				log.Println("Error writing data file:", err)
-				return false
+				return err
 			}
 
-			return true
+			return nil
 		}
 	}
-	return false
+	return ErrTaskNotFound
+}
+
+func (ts *TaskFileStore) Transaction(fn func(tx TaskStore) error) error {
+	ts.file.mu.Lock()
+	defer ts.file.mu.Unlock()
+
+	data, err := ts.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
+	tasks := make(map[int]*domain.Task, len(data.Tasks))
+	for _, task := range data.Tasks {
+		tasks[task.ID] = task
+	}
+
+	// Run the operations in memory and write the result back in one go
+	tx := newTaskMemoryStoreFrom(tasks, ts.nextTaskID)
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	data.Tasks = tx.GetAll()
+	slices.SortFunc(data.Tasks, func(a, b *domain.Task) int {
+		return a.ID - b.ID
+	})
+
+	if err := ts.file.save(data); err != nil {
+		log.Println("Error writing data file:", err)
+		return err
+	}
+
+	ts.nextTaskID = tx.nextID
+	return nil
+}
+
+func (ts *TaskFileStore) Replace(tasks []*domain.Task) error {
+	ts.file.mu.Lock()
+	defer ts.file.mu.Unlock()
+
+	data, err := ts.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
+	nextID := replaceFileTasks(data, tasks)
+
+	if err := ts.file.save(data); err != nil {
+		log.Println("Error writing data file:", err)
+		return err
+	}
+
+	ts.nextTaskID = nextID
+	return nil
+}
+
+// replaceFileTasks replaces the tasks of data and returns the next task ID
+func replaceFileTasks(data *FileData, tasks []*domain.Task) int {
+	data.Tasks = make([]*domain.Task, 0, len(tasks))
+	nextID := 1
+	for _, task := range tasks {
+		task.ApplyDefaults()
+		data.Tasks = append(data.Tasks, task)
+		nextID = max(nextID, task.ID+1)
+	}
+	return nextID
 }
 
 // UserFileStore methods
 func (us *UserFileStore) GetAll() []*domain.User {
-	us.mu.RLock()
-	defer us.mu.RUnlock()
+	us.file.mu.RLock()
+	defer us.file.mu.RUnlock()
 
-	data := us.loadDataFromFile()
+	data, ok := us.file.loadForRead()
+	if !ok {
+		return []*domain.User{}
+	}
 	users := make([]*domain.User, 0, len(data.Users))
 	for _, userStorage := range data.Users {
 		users = append(users, userStorage.ToUser())
@@ -302,10 +336,13 @@ func (us *UserFileStore) GetAll() []*domain.User {
 }
 
 func (us *UserFileStore) GetByID(id int) (*domain.User, bool) {
-	us.mu.RLock()
-	defer us.mu.RUnlock()
+	us.file.mu.RLock()
+	defer us.file.mu.RUnlock()
 
-	data := us.loadDataFromFile()
+	data, ok := us.file.loadForRead()
+	if !ok {
+		return nil, false
+	}
 	for _, userStorage := range data.Users {
 		if userStorage.ID == id {
 			return userStorage.ToUser(), true
@@ -315,10 +352,13 @@ func (us *UserFileStore) GetByID(id int) (*domain.User, bool) {
 }
 
 func (us *UserFileStore) GetByUsername(username string) (*domain.User, bool) {
-	us.mu.RLock()
-	defer us.mu.RUnlock()
+	us.file.mu.RLock()
+	defer us.file.mu.RUnlock()
 
-	data := us.loadDataFromFile()
+	data, ok := us.file.loadForRead()
+	if !ok {
+		return nil, false
+	}
 	for _, userStorage := range data.Users {
 		if userStorage.Username == username {
 			return userStorage.ToUser(), true
@@ -328,26 +368,24 @@ func (us *UserFileStore) GetByUsername(username string) (*domain.User, bool) {
 }
 
 func (us *UserFileStore) Create(user *domain.User) *domain.User {
-	us.mu.Lock()
-	defer us.mu.Unlock()
+	us.file.mu.Lock()
+	defer us.file.mu.Unlock()
+
+	data, err := us.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return nil
+	}
 
 	user.ID = us.nextUserID
 	us.nextUserID++
 	user.CreatedAt = time.Now()
 
-	data := us.loadDataFromFile()
 	// Convert User to UserStorage for JSON persistence
 	userStorage := user.ToStorage(user.HashedPassword)
 	data.Users = append(data.Users, userStorage)
 
-	// Marshal data to json and write to file
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Println("Error marshalling data:", err)
-		return nil
-	}
-
-	if err := os.WriteFile(us.filePath, jsonData, 0644); err != nil {
+	if err := us.file.save(data); err != nil {
 		log.Println("Error writing data file:", err)
 		return nil
 	}
@@ -356,10 +394,14 @@ func (us *UserFileStore) Create(user *domain.User) *domain.User {
 }
 
 func (us *UserFileStore) Update(id int, updatedUser *domain.User) (*domain.User, bool) {
-	us.mu.Lock()
-	defer us.mu.Unlock()
+	us.file.mu.Lock()
+	defer us.file.mu.Unlock()
 
-	data := us.loadDataFromFile()
+	data, err := us.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return nil, false
+	}
 	for i, userStorage := range data.Users {
 		if userStorage.ID == id {
 			updatedUser.ID = id
@@ -368,14 +410,7 @@ func (us *UserFileStore) Update(id int, updatedUser *domain.User) (*domain.User,
 			newUserStorage := updatedUser.ToStorage(updatedUser.HashedPassword)
 			data.Users[i] = newUserStorage
 
-			// Marshal data to json and write to file
-			jsonData, err := json.Marshal(data)
-			if err != nil {
-				log.Println("Error marshalling data:", err)
-				return nil, false
-			}
-
-			if err := os.WriteFile(us.filePath, jsonData, 0644); err != nil {
+			if err := us.file.save(data); err != nil {
 				log.Println("Error writing data file:", err)
 				return nil, false
 			}
@@ -387,21 +422,161 @@ func (us *UserFileStore) Update(id int, updatedUser *domain.User) (*domain.User,
 }
 
 func (us *UserFileStore) Delete(id int) bool {
-	us.mu.Lock()
-	defer us.mu.Unlock()
+	us.file.mu.Lock()
+	defer us.file.mu.Unlock()
 
-	data := us.loadDataFromFile()
+	data, err := us.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return false
+	}
 	for i, userStorage := range data.Users {
 		if userStorage.ID == id {
 			data.Users = append(data.Users[:i], data.Users[i+1:]...) // Remove the user
-			// Marshal data to json and write to file
-			jsonData, err := json.Marshal(data)
-			if err != nil {
-				log.Println("Error marshalling data:", err)
+			if err := us.file.save(data); err != nil {
+				log.Println("Error writing data file:", err)
 				return false
 			}
 
-			if err := os.WriteFile(us.filePath, jsonData, 0644); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (us *UserFileStore) Replace(users []*domain.User) error {
+	us.file.mu.Lock()
+	defer us.file.mu.Unlock()
+
+	data, err := us.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
+	nextID := replaceFileUsers(data, users)
+
+	if err := us.file.save(data); err != nil {
+		log.Println("Error writing data file:", err)
+		return err
+	}
+
+	us.nextUserID = nextID
+	return nil
+}
+
+// replaceFileUsers replaces the users of data and returns the next user ID
+func replaceFileUsers(data *FileData, users []*domain.User) int {
+	data.Users = make([]*domain.UserStorage, 0, len(users))
+	nextID := 1
+	for _, user := range users {
+		data.Users = append(data.Users, user.ToStorage(user.HashedPassword))
+		nextID = max(nextID, user.ID+1)
+	}
+	return nextID
+}
+
+// StateFileStore replaces the users, tasks and clients of a DataFile with a single write
+type StateFileStore struct {
+	file  *DataFile
+	tasks *TaskFileStore
+	users *UserFileStore
+}
+
+func NewStateFileStore(file *DataFile, tasks *TaskFileStore, users *UserFileStore) *StateFileStore {
+	return &StateFileStore{file: file, tasks: tasks, users: users}
+}
+
+func (ss *StateFileStore) ReplaceAll(users []*domain.User, tasks []*domain.Task, clients []*domain.Client) error {
+	ss.file.mu.Lock()
+	defer ss.file.mu.Unlock()
+
+	data, err := ss.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
+	nextUserID := replaceFileUsers(data, users)
+	nextTaskID := replaceFileTasks(data, tasks)
+	data.Clients = slices.Clone(clients)
+
+	if err := ss.file.save(data); err != nil {
+		log.Println("Error writing data file:", err)
+		return err
+	}
+
+	ss.users.nextUserID = nextUserID
+	ss.tasks.nextTaskID = nextTaskID
+	return nil
+}
+
+// ClientFileStore methods
+func (cs *ClientFileStore) GetAll() []*domain.Client {
+	cs.file.mu.RLock()
+	defer cs.file.mu.RUnlock()
+
+	data, ok := cs.file.loadForRead()
+	if !ok {
+		return []*domain.Client{}
+	}
+	return data.Clients
+}
+
+func (cs *ClientFileStore) GetByID(clientID string) (*domain.Client, bool) {
+	cs.file.mu.RLock()
+	defer cs.file.mu.RUnlock()
+
+	data, ok := cs.file.loadForRead()
+	if !ok {
+		return nil, false
+	}
+	for _, client := range data.Clients {
+		if client.ClientID == clientID {
+			return client, true
+		}
+	}
+	return nil, false
+}
+
+func (cs *ClientFileStore) Save(client *domain.Client) error {
+	cs.file.mu.Lock()
+	defer cs.file.mu.Unlock()
+
+	data, err := cs.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return err
+	}
+
+	index := slices.IndexFunc(data.Clients, func(existing *domain.Client) bool {
+		return existing.ClientID == client.ClientID
+	})
+	if index >= 0 {
+		data.Clients[index] = client
+	} else {
+		data.Clients = append(data.Clients, client)
+	}
+
+	if err := cs.file.save(data); err != nil {
+		log.Println("Error writing data file:", err)
+		return err
+	}
+
+	return nil
+}
+
+func (cs *ClientFileStore) Delete(clientID string) bool {
+	cs.file.mu.Lock()
+	defer cs.file.mu.Unlock()
+
+	data, err := cs.file.loadLatest()
+	if err != nil {
+		log.Println("Error reading data file:", err)
+		return false
+	}
+	for i, client := range data.Clients {
+		if client.ClientID == clientID {
+			data.Clients = append(data.Clients[:i], data.Clients[i+1:]...) // Remove the client
+			if err := cs.file.save(data); err != nil {
 				log.Println("Error writing data file:", err)
 				return false
 			}
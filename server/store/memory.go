@@ -45,6 +45,18 @@ func (ts *TaskMemoryStore) GetAllByUserID(userID int) []*domain.Task {
 	return tasks
 }
 
+func (ts *TaskMemoryStore) Query(query *TaskQuery) *TaskPage {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]*domain.Task, 0, len(ts.tasks))
+	for _, task := range ts.tasks {
+		tasks = append(tasks, task)
+	}
+
+	return QueryTasks(tasks, query)
+}
+
 func (ts *TaskMemoryStore) GetByID(id int) (*domain.Task, bool) {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
@@ -60,37 +72,106 @@ func (ts *TaskMemoryStore) Create(task *domain.Task) *domain.Task {
 	task.ID = ts.nextID
 	ts.nextID++
 	task.CreatedAt = time.Now().Format(time.RFC3339)
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.ApplyDefaults()
 	ts.tasks[task.ID] = task
 
 	return task
 }
 
 func (ts *TaskMemoryStore) Update(id int, updatedTask *domain.Task) (*domain.Task, bool) {
+	task, err := ts.UpdateIfVersion(id, AnyVersion, updatedTask)
+	return task, err == nil
+}
+
+func (ts *TaskMemoryStore) UpdateIfVersion(id, version int, updatedTask *domain.Task) (*domain.Task, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
 	existingTask, exists := ts.tasks[id]
 	if !exists {
-		return nil, false
+		return nil, ErrTaskNotFound
+	}
+	if version != AnyVersion && existingTask.Version != version {
+		return nil, ErrVersionMismatch
 	}
 
 	updatedTask.ID = id
 	updatedTask.CreatedAt = existingTask.CreatedAt
+	updatedTask.UpdatedAt = time.Now().Format(time.RFC3339)
+	updatedTask.Version = existingTask.Version + 1
+	updatedTask.ApplyDefaults()
 	ts.tasks[id] = updatedTask
 
-	return updatedTask, true
+	return updatedTask, nil
 }
 
 func (ts *TaskMemoryStore) Delete(id int) bool {
+	return ts.DeleteIfVersion(id, AnyVersion) == nil
+}
+
+func (ts *TaskMemoryStore) DeleteIfVersion(id, version int) error {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
-	if _, exists := ts.tasks[id]; !exists {
-		return false
+	existingTask, exists := ts.tasks[id]
+	if !exists {
+		return ErrTaskNotFound
+	}
+	if version != AnyVersion && existingTask.Version != version {
+		return ErrVersionMismatch
 	}
 
 	delete(ts.tasks, id)
-	return true
+	return nil
+}
+
+func (ts *TaskMemoryStore) Transaction(fn func(tx TaskStore) error) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	tx := newTaskMemoryStoreFrom(ts.tasks, ts.nextID)
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	ts.tasks = tx.tasks
+	ts.nextID = tx.nextID
+	return nil
+}
+
+func (ts *TaskMemoryStore) Replace(tasks []*domain.Task) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.replaceLocked(tasks)
+	return nil
+}
+
+// replaceLocked replaces all tasks. The caller must hold the write lock.
+func (ts *TaskMemoryStore) replaceLocked(tasks []*domain.Task) {
+	ts.tasks = make(map[int]*domain.Task, len(tasks))
+	ts.nextID = 1
+	for _, task := range tasks {
+		task.ApplyDefaults()
+		ts.tasks[task.ID] = task
+		ts.nextID = max(ts.nextID, task.ID+1)
+	}
+}
+
+// newTaskMemoryStoreFrom creates a store holding a copy of the given tasks.
+// Tasks are replaced rather than modified on update, so copying the map is enough.
+func newTaskMemoryStoreFrom(tasks map[int]*domain.Task, nextID int) *TaskMemoryStore {
+	copied := make(map[int]*domain.Task, len(tasks))
+	for id, task := range tasks {
+		copied[id] = task
+	}
+
+	return &TaskMemoryStore{
+		tasks:  copied,
+		nextID: nextID,
+	}
 }
 
 type UserMemoryStore struct {
@@ -177,3 +258,107 @@ func (us *UserMemoryStore) Delete(id int) bool {
 	delete(us.users, id)
 	return true
 }
+
+func (us *UserMemoryStore) Replace(users []*domain.User) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.replaceLocked(users)
+	return nil
+}
+
+// replaceLocked replaces all users. The caller must hold the write lock.
+func (us *UserMemoryStore) replaceLocked(users []*domain.User) {
+	us.users = make(map[int]*domain.User, len(users))
+	us.nextID = 1
+	for _, user := range users {
+		us.users[user.ID] = user
+		us.nextID = max(us.nextID, user.ID+1)
+	}
+}
+
+// StateMemoryStore replaces the data of a TaskMemoryStore, a UserMemoryStore and a
+// ClientMemoryStore together
+type StateMemoryStore struct {
+	tasks   *TaskMemoryStore
+	users   *UserMemoryStore
+	clients *ClientMemoryStore
+}
+
+func NewStateMemoryStore(tasks *TaskMemoryStore, users *UserMemoryStore, clients *ClientMemoryStore) *StateMemoryStore {
+	return &StateMemoryStore{tasks: tasks, users: users, clients: clients}
+}
+
+func (ss *StateMemoryStore) ReplaceAll(users []*domain.User, tasks []*domain.Task, clients []*domain.Client) error {
+	// Hold all locks so readers never see the new users with the old tasks
+	ss.users.mu.Lock()
+	defer ss.users.mu.Unlock()
+	ss.tasks.mu.Lock()
+	defer ss.tasks.mu.Unlock()
+	ss.clients.mu.Lock()
+	defer ss.clients.mu.Unlock()
+
+	ss.users.replaceLocked(users)
+	ss.tasks.replaceLocked(tasks)
+	ss.clients.replaceLocked(clients)
+	return nil
+}
+
+type ClientMemoryStore struct {
+	clients map[string]*domain.Client
+	mu      sync.RWMutex
+}
+
+func NewClientMemoryStore() *ClientMemoryStore {
+	return &ClientMemoryStore{
+		clients: make(map[string]*domain.Client),
+	}
+}
+
+func (cs *ClientMemoryStore) GetAll() []*domain.Client {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	clients := make([]*domain.Client, 0, len(cs.clients))
+	for _, client := range cs.clients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+func (cs *ClientMemoryStore) GetByID(clientID string) (*domain.Client, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	client, exists := cs.clients[clientID]
+	return client, exists
+}
+
+func (cs *ClientMemoryStore) Save(client *domain.Client) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.clients[client.ClientID] = client
+	return nil
+}
+
+func (cs *ClientMemoryStore) Delete(clientID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, exists := cs.clients[clientID]; !exists {
+		return false
+	}
+
+	delete(cs.clients, clientID)
+	return true
+}
+
+// replaceLocked replaces all clients. The caller must hold the write lock.
+func (cs *ClientMemoryStore) replaceLocked(clients []*domain.Client) {
+	cs.clients = make(map[string]*domain.Client, len(clients))
+	for _, client := range clients {
+		cs.clients[client.ClientID] = client
+	}
+}
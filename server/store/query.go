@@ -0,0 +1,271 @@
+package store
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+type TaskSortField string
+
+const (
+	TaskSortID        TaskSortField = "id"
+	TaskSortTitle     TaskSortField = "title"
+	TaskSortCompleted TaskSortField = "completed"
+	TaskSortDueDate   TaskSortField = "due_date"
+	TaskSortPriority  TaskSortField = "priority"
+	TaskSortCreatedAt TaskSortField = "created_at"
+	TaskSortUpdatedAt TaskSortField = "updated_at"
+)
+
+// TaskSortFields lists every field tasks can be sorted by
+var TaskSortFields = []TaskSortField{
+	TaskSortID,
+	TaskSortTitle,
+	TaskSortCompleted,
+	TaskSortDueDate,
+	TaskSortPriority,
+	TaskSortCreatedAt,
+	TaskSortUpdatedAt,
+}
+
+// TaskSort is a single sort key of a task query
+type TaskSort struct {
+	Field      TaskSortField
+	Descending bool
+}
+
+// TaskQuery describes filtering, sorting and pagination for TaskStore.Query.
+// Zero values disable the corresponding filter.
+type TaskQuery struct {
+	UserID        *int
+	Completed     *bool
+	Tags          []string   // tasks must have all of these tags
+	TitleContains string     // case-insensitive substring match
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // inclusive
+	DueAfter      *time.Time // inclusive, excludes tasks without a due date
+	DueBefore     *time.Time // inclusive, excludes tasks without a due date
+
+	// Sort keys in order of precedence. Ties are always broken by ascending ID.
+	Sort []TaskSort
+
+	// After restricts the result to tasks ordered after this task (keyset pagination)
+	After  *domain.Task
+	Offset int
+	Limit  int // 0 means no limit
+}
+
+// TaskPage is the result of a task query
+type TaskPage struct {
+	Tasks   []*domain.Task
+	Total   int  // number of tasks matching the filters, ignoring pagination
+	HasMore bool // whether more tasks follow this page
+}
+
+// Matches reports whether the task satisfies all filters of the query
+func (q *TaskQuery) Matches(task *domain.Task) bool {
+	if q.UserID != nil && task.UserID != *q.UserID {
+		return false
+	}
+	if q.Completed != nil && task.Completed != *q.Completed {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !containsTag(task.Tags, tag) {
+			return false
+		}
+	}
+	if q.TitleContains != "" && !strings.Contains(strings.ToLower(task.Title), strings.ToLower(q.TitleContains)) {
+		return false
+	}
+
+	if q.CreatedAfter != nil || q.CreatedBefore != nil {
+		createdAt, ok := parseTaskTime(task.CreatedAt)
+		if !ok || !inRange(createdAt, q.CreatedAfter, q.CreatedBefore) {
+			return false
+		}
+	}
+
+	if q.DueAfter != nil || q.DueBefore != nil {
+		if task.DueDate == nil {
+			return false
+		}
+		dueDate, ok := parseTaskTime(*task.DueDate)
+		if !ok || !inRange(dueDate, q.DueAfter, q.DueBefore) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// QueryTasks filters, sorts and paginates tasks in memory.
+// It is shared by the store implementations that hold all tasks in memory.
+func QueryTasks(tasks []*domain.Task, q *TaskQuery) *TaskPage {
+	matched := make([]*domain.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if q.Matches(task) {
+			matched = append(matched, task)
+		}
+	}
+
+	sortTasks(matched, q.Sort)
+	total := len(matched)
+
+	if q.After != nil {
+		start := len(matched)
+		for i, task := range matched {
+			if CompareTasks(q.After, task, q.Sort) < 0 {
+				start = i
+				break
+			}
+		}
+		matched = matched[start:]
+	}
+
+	if q.Offset > 0 {
+		if q.Offset >= len(matched) {
+			matched = matched[:0]
+		} else {
+			matched = matched[q.Offset:]
+		}
+	}
+
+	hasMore := false
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		hasMore = true
+	}
+
+	return &TaskPage{
+		Tasks:   matched,
+		Total:   total,
+		HasMore: hasMore,
+	}
+}
+
+// CompareTasks compares two tasks by the given sort keys, breaking ties by ID.
+// It returns a negative number when a sorts before b and a positive number when after.
+// Tasks without a due date sort after tasks with one regardless of direction.
+func CompareTasks(a, b *domain.Task, sorts []TaskSort) int {
+	for _, s := range sorts {
+		if s.Field == TaskSortDueDate && (a.DueDate == nil) != (b.DueDate == nil) {
+			if a.DueDate == nil {
+				return 1
+			}
+			return -1
+		}
+
+		c := compareTaskField(a, b, s.Field)
+		if s.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return compareInts(a.ID, b.ID)
+}
+
+func sortTasks(tasks []*domain.Task, sorts []TaskSort) {
+	slices.SortFunc(tasks, func(a, b *domain.Task) int {
+		return CompareTasks(a, b, sorts)
+	})
+}
+
+func compareTaskField(a, b *domain.Task, field TaskSortField) int {
+	switch field {
+	case TaskSortID:
+		return compareInts(a.ID, b.ID)
+	case TaskSortTitle:
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case TaskSortCompleted:
+		return compareBools(a.Completed, b.Completed)
+	case TaskSortDueDate:
+		if a.DueDate == nil || b.DueDate == nil {
+			return 0
+		}
+		return compareTimes(*a.DueDate, *b.DueDate)
+	case TaskSortPriority:
+		return compareInts(priorityRank(a.Priority), priorityRank(b.Priority))
+	case TaskSortCreatedAt:
+		return compareTimes(a.CreatedAt, b.CreatedAt)
+	case TaskSortUpdatedAt:
+		return compareTimes(a.UpdatedAt, b.UpdatedAt)
+	default:
+		return 0
+	}
+}
+
+func priorityRank(priority domain.Priority) int {
+	switch priority {
+	case domain.PriorityLow:
+		return 0
+	case domain.PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareTimes(a, b string) int {
+	ta, okA := parseTaskTime(a)
+	tb, okB := parseTaskTime(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	return ta.Compare(tb)
+}
+
+func parseTaskTime(value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func inRange(t time.Time, after, before *time.Time) bool {
+	if after != nil && t.Before(*after) {
+		return false
+	}
+	if before != nil && t.After(*before) {
+		return false
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
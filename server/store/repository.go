@@ -1,14 +1,38 @@
 package store
 
-import "github.com/KasumiMercury/mock-todo-server/server/domain"
+import (
+	"errors"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+// AnyVersion disables the version check of conditional task writes
+const AnyVersion = 0
+
+var (
+	ErrTaskNotFound    = errors.New("task not found")
+	ErrVersionMismatch = errors.New("task version mismatch")
+)
 
 type TaskStore interface {
 	GetAll() []*domain.Task
 	GetAllByUserID(userID int) []*domain.Task
 	GetByID(id int) (*domain.Task, bool)
+	Query(query *TaskQuery) *TaskPage
 	Create(task *domain.Task) *domain.Task
 	Update(id int, updatedTask *domain.Task) (*domain.Task, bool)
 	Delete(id int) bool
+	// UpdateIfVersion replaces the task only if its current version matches.
+	// It returns ErrTaskNotFound or ErrVersionMismatch when the write is rejected.
+	UpdateIfVersion(id, version int, updatedTask *domain.Task) (*domain.Task, error)
+	// DeleteIfVersion deletes the task only if its current version matches
+	DeleteIfVersion(id, version int) error
+	// Transaction runs fn with exclusive access to the tasks.
+	// Changes made through tx are discarded if fn returns an error.
+	Transaction(fn func(tx TaskStore) error) error
+	// Replace discards all tasks and stores the given ones as they are.
+	// New tasks get IDs after the highest replaced ID.
+	Replace(tasks []*domain.Task) error
 }
 
 type UserStore interface {
@@ -18,4 +42,23 @@ type UserStore interface {
 	Create(user *domain.User) *domain.User
 	Update(id int, updatedUser *domain.User) (*domain.User, bool)
 	Delete(id int) bool
+	// Replace discards all users and stores the given ones as they are.
+	// New users get IDs after the highest replaced ID.
+	Replace(users []*domain.User) error
+}
+
+// StateStore replaces the data of the task, user and client stores together
+type StateStore interface {
+	// ReplaceAll discards all users, tasks and clients and stores the given ones in a single write.
+	// If it fails, the previous data is kept.
+	ReplaceAll(users []*domain.User, tasks []*domain.Task, clients []*domain.Client) error
+}
+
+// ClientStore holds the OIDC clients registered at runtime
+type ClientStore interface {
+	GetAll() []*domain.Client
+	GetByID(clientID string) (*domain.Client, bool)
+	// Save creates the client or replaces the client with the same ID
+	Save(client *domain.Client) error
+	Delete(clientID string) bool
 }
@@ -0,0 +1,678 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/goccy/go-json"
+	_ "modernc.org/sqlite" // pure Go SQLite driver, no cgo required
+)
+
+// sqliteMigrations are applied in order. Never edit an existing entry, append a new one instead.
+var sqliteMigrations = []string{
+	`CREATE TABLE users (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		username        TEXT    NOT NULL UNIQUE,
+		hashed_password TEXT    NOT NULL,
+		created_at      TEXT    NOT NULL
+	);
+	CREATE TABLE tasks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		title       TEXT    NOT NULL,
+		description TEXT    NOT NULL DEFAULT '',
+		completed   INTEGER NOT NULL DEFAULT 0,
+		due_date    TEXT,
+		priority    TEXT    NOT NULL DEFAULT 'medium',
+		tags        TEXT    NOT NULL DEFAULT '[]',
+		user_id     INTEGER NOT NULL,
+		version     INTEGER NOT NULL DEFAULT 1,
+		created_at  TEXT    NOT NULL,
+		updated_at  TEXT    NOT NULL
+	);
+	CREATE INDEX idx_tasks_user_id ON tasks (user_id);`,
+	`ALTER TABLE users ADD COLUMN profile TEXT NOT NULL DEFAULT '{}';`,
+	`CREATE TABLE clients (
+		client_id               TEXT PRIMARY KEY,
+		client_secret           TEXT NOT NULL DEFAULT '',
+		metadata                TEXT NOT NULL,
+		registration_token_hash TEXT NOT NULL,
+		created_at              TEXT NOT NULL
+	);`,
+}
+
+// IsSQLitePath reports whether the file extension denotes a SQLite database
+func IsSQLitePath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	default:
+		return false
+	}
+}
+
+// OpenSQLite opens the SQLite database at path, creating it if needed,
+// and applies pending schema migrations
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// SQLite allows a single writer, so serialize access instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if current > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, len(sqliteMigrations))
+	}
+
+	for version := current + 1; version <= len(sqliteMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(sqliteMigrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// sqlExecutor is implemented by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const userColumns = `id, username, hashed_password, created_at, profile`
+
+const clientColumns = `client_id, client_secret, metadata, registration_token_hash, created_at`
+
+const taskColumns = `id, title, description, completed, due_date, priority, tags, user_id, version, created_at, updated_at`
+
+type TaskSQLiteStore struct {
+	db   *sql.DB
+	exec sqlExecutor
+}
+
+func NewTaskSQLiteStore(db *sql.DB) *TaskSQLiteStore {
+	return &TaskSQLiteStore{
+		db:   db,
+		exec: db,
+	}
+}
+
+func (ts *TaskSQLiteStore) GetAll() []*domain.Task {
+	tasks, err := ts.queryTasks(`SELECT ` + taskColumns + ` FROM tasks ORDER BY id`)
+	if err != nil {
+		log.Println("Error reading tasks:", err)
+		return []*domain.Task{}
+	}
+	return tasks
+}
+
+func (ts *TaskSQLiteStore) GetAllByUserID(userID int) []*domain.Task {
+	tasks, err := ts.queryTasks(`SELECT `+taskColumns+` FROM tasks WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		log.Println("Error reading tasks:", err)
+		return []*domain.Task{}
+	}
+	return tasks
+}
+
+func (ts *TaskSQLiteStore) GetByID(id int) (*domain.Task, bool) {
+	tasks, err := ts.queryTasks(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id)
+	if err != nil {
+		log.Println("Error reading task:", err)
+		return nil, false
+	}
+	if len(tasks) == 0 {
+		return nil, false
+	}
+	return tasks[0], true
+}
+
+// Query narrows the tasks down in SQL by the indexed columns and applies the
+// remaining filters, sorting and pagination with QueryTasks
+func (ts *TaskSQLiteStore) Query(query *TaskQuery) *TaskPage {
+	sqlQuery := `SELECT ` + taskColumns + ` FROM tasks WHERE 1 = 1`
+	var args []any
+	if query.UserID != nil {
+		sqlQuery += ` AND user_id = ?`
+		args = append(args, *query.UserID)
+	}
+	if query.Completed != nil {
+		sqlQuery += ` AND completed = ?`
+		args = append(args, *query.Completed)
+	}
+
+	tasks, err := ts.queryTasks(sqlQuery, args...)
+	if err != nil {
+		log.Println("Error reading tasks:", err)
+		tasks = []*domain.Task{}
+	}
+
+	return QueryTasks(tasks, query)
+}
+
+func (ts *TaskSQLiteStore) Create(task *domain.Task) *domain.Task {
+	task.CreatedAt = time.Now().Format(time.RFC3339)
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.ApplyDefaults()
+
+	tags, err := json.Marshal(task.Tags)
+	if err != nil {
+		log.Println("Error marshalling tags:", err)
+		return nil
+	}
+
+	err = ts.exec.QueryRowContext(context.Background(),
+		`INSERT INTO tasks (title, description, completed, due_date, priority, tags, user_id, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		task.Title, task.Description, task.Completed, task.DueDate, task.Priority, string(tags),
+		task.UserID, task.Version, task.CreatedAt, task.UpdatedAt,
+	).Scan(&task.ID)
+	if err != nil {
+		log.Println("Error inserting task:", err)
+		return nil
+	}
+
+	return task
+}
+
+func (ts *TaskSQLiteStore) Update(id int, updatedTask *domain.Task) (*domain.Task, bool) {
+	task, err := ts.UpdateIfVersion(id, AnyVersion, updatedTask)
+	return task, err == nil
+}
+
+func (ts *TaskSQLiteStore) UpdateIfVersion(id, version int, updatedTask *domain.Task) (*domain.Task, error) {
+	updatedTask.ID = id
+	updatedTask.UpdatedAt = time.Now().Format(time.RFC3339)
+	updatedTask.ApplyDefaults()
+
+	tags, err := json.Marshal(updatedTask.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// created_at is preserved and the version incremented by the statement itself
+	err = ts.exec.QueryRowContext(context.Background(),
+		`UPDATE tasks SET title = ?, description = ?, completed = ?, due_date = ?, priority = ?, tags = ?,
+			user_id = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND (? = 0 OR version = ?)
+		RETURNING version, created_at`,
+		updatedTask.Title, updatedTask.Description, updatedTask.Completed, updatedTask.DueDate,
+		updatedTask.Priority, string(tags), updatedTask.UserID, updatedTask.UpdatedAt,
+		id, version, version,
+	).Scan(&updatedTask.Version, &updatedTask.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ts.rejectionError(id)
+	}
+	if err != nil {
+		log.Println("Error updating task:", err)
+		return nil, err
+	}
+
+	return updatedTask, nil
+}
+
+func (ts *TaskSQLiteStore) Delete(id int) bool {
+	return ts.DeleteIfVersion(id, AnyVersion) == nil
+}
+
+func (ts *TaskSQLiteStore) DeleteIfVersion(id, version int) error {
+	result, err := ts.exec.ExecContext(context.Background(),
+		`DELETE FROM tasks WHERE id = ? AND (? = 0 OR version = ?)`, id, version, version)
+	if err != nil {
+		log.Println("Error deleting task:", err)
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ts.rejectionError(id)
+	}
+
+	return nil
+}
+
+// rejectionError tells apart why a conditional write did not affect any row
+func (ts *TaskSQLiteStore) rejectionError(id int) error {
+	if _, exists := ts.GetByID(id); exists {
+		return ErrVersionMismatch
+	}
+	return ErrTaskNotFound
+}
+
+func (ts *TaskSQLiteStore) Transaction(fn func(tx TaskStore) error) error {
+	if ts.db == nil {
+		// Already inside a transaction
+		return fn(ts)
+	}
+
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&TaskSQLiteStore{exec: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ts *TaskSQLiteStore) Replace(tasks []*domain.Task) error {
+	return ts.inTx(func(exec sqlExecutor) error {
+		return replaceSQLiteTasks(exec, tasks)
+	})
+}
+
+// replaceSQLiteTasks deletes all tasks and inserts the given ones
+func replaceSQLiteTasks(exec sqlExecutor, tasks []*domain.Task) error {
+	ctx := context.Background()
+	if _, err := exec.ExecContext(ctx, `DELETE FROM tasks`); err != nil {
+		return err
+	}
+	// Restart the ID counter, new IDs then continue after the highest inserted ID
+	if _, err := exec.ExecContext(ctx, `DELETE FROM sqlite_sequence WHERE name = 'tasks'`); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		task.ApplyDefaults()
+		tags, err := json.Marshal(task.Tags)
+		if err != nil {
+			return err
+		}
+
+		_, err = exec.ExecContext(ctx,
+			`INSERT INTO tasks (`+taskColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			task.ID, task.Title, task.Description, task.Completed, task.DueDate, task.Priority, string(tags),
+			task.UserID, task.Version, task.CreatedAt, task.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert task %d: %w", task.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction unless the store already is one
+func (ts *TaskSQLiteStore) inTx(fn func(exec sqlExecutor) error) error {
+	return ts.Transaction(func(tx TaskStore) error {
+		return fn(tx.(*TaskSQLiteStore).exec)
+	})
+}
+
+func (ts *TaskSQLiteStore) queryTasks(query string, args ...any) ([]*domain.Task, error) {
+	rows, err := ts.exec.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*domain.Task, 0)
+	for rows.Next() {
+		var task domain.Task
+		var tags string
+		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Completed, &task.DueDate,
+			&task.Priority, &tags, &task.UserID, &task.Version, &task.CreatedAt, &task.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(tags), &task.Tags); err != nil {
+			return nil, fmt.Errorf("invalid tags of task %d: %w", task.ID, err)
+		}
+		task.ApplyDefaults()
+		tasks = append(tasks, &task)
+	}
+
+	return tasks, rows.Err()
+}
+
+type UserSQLiteStore struct {
+	db *sql.DB
+}
+
+func NewUserSQLiteStore(db *sql.DB) *UserSQLiteStore {
+	return &UserSQLiteStore{
+		db: db,
+	}
+}
+
+func (us *UserSQLiteStore) GetAll() []*domain.User {
+	users, err := us.queryUsers(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		log.Println("Error reading users:", err)
+		return []*domain.User{}
+	}
+	return users
+}
+
+func (us *UserSQLiteStore) GetByID(id int) (*domain.User, bool) {
+	users, err := us.queryUsers(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	if err != nil {
+		log.Println("Error reading user:", err)
+		return nil, false
+	}
+	if len(users) == 0 {
+		return nil, false
+	}
+	return users[0], true
+}
+
+func (us *UserSQLiteStore) GetByUsername(username string) (*domain.User, bool) {
+	users, err := us.queryUsers(`SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+	if err != nil {
+		log.Println("Error reading user:", err)
+		return nil, false
+	}
+	if len(users) == 0 {
+		return nil, false
+	}
+	return users[0], true
+}
+
+func (us *UserSQLiteStore) Create(user *domain.User) *domain.User {
+	user.CreatedAt = time.Now()
+
+	profile, err := json.Marshal(user.Profile)
+	if err != nil {
+		log.Println("Error marshalling profile:", err)
+		return nil
+	}
+
+	err = us.db.QueryRow(
+		`INSERT INTO users (username, hashed_password, created_at, profile) VALUES (?, ?, ?, ?) RETURNING id`,
+		user.Username, user.HashedPassword, user.CreatedAt.Format(time.RFC3339Nano), string(profile),
+	).Scan(&user.ID)
+	if err != nil {
+		log.Println("Error inserting user:", err)
+		return nil
+	}
+
+	return user
+}
+
+func (us *UserSQLiteStore) Update(id int, updatedUser *domain.User) (*domain.User, bool) {
+	profile, err := json.Marshal(updatedUser.Profile)
+	if err != nil {
+		log.Println("Error marshalling profile:", err)
+		return nil, false
+	}
+
+	var createdAt string
+	err = us.db.QueryRow(
+		`UPDATE users SET username = ?, hashed_password = ?, profile = ? WHERE id = ? RETURNING created_at`,
+		updatedUser.Username, updatedUser.HashedPassword, string(profile), id,
+	).Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false
+	}
+	if err != nil {
+		log.Println("Error updating user:", err)
+		return nil, false
+	}
+
+	updatedUser.ID = id
+	updatedUser.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt) // Preserve the original creation time
+	return updatedUser, true
+}
+
+func (us *UserSQLiteStore) Delete(id int) bool {
+	result, err := us.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		log.Println("Error deleting user:", err)
+		return false
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected > 0
+}
+
+func (us *UserSQLiteStore) Replace(users []*domain.User) error {
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceSQLiteUsers(tx, users); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceSQLiteUsers deletes all users and inserts the given ones
+func replaceSQLiteUsers(exec sqlExecutor, users []*domain.User) error {
+	ctx := context.Background()
+	if _, err := exec.ExecContext(ctx, `DELETE FROM users`); err != nil {
+		return err
+	}
+	if _, err := exec.ExecContext(ctx, `DELETE FROM sqlite_sequence WHERE name = 'users'`); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		profile, err := json.Marshal(user.Profile)
+		if err != nil {
+			return fmt.Errorf("failed to marshal profile of user %d: %w", user.ID, err)
+		}
+
+		_, err = exec.ExecContext(ctx,
+			`INSERT INTO users (id, username, hashed_password, created_at, profile) VALUES (?, ?, ?, ?, ?)`,
+			user.ID, user.Username, user.HashedPassword, user.CreatedAt.Format(time.RFC3339Nano), string(profile),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert user %d: %w", user.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (us *UserSQLiteStore) queryUsers(query string, args ...any) ([]*domain.User, error) {
+	rows, err := us.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*domain.User, 0)
+	for rows.Next() {
+		var user domain.User
+		var createdAt, profile string
+		if err := rows.Scan(&user.ID, &user.Username, &user.HashedPassword, &createdAt, &profile); err != nil {
+			return nil, err
+		}
+		if user.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid created_at of user %d: %w", user.ID, err)
+		}
+		if err := json.Unmarshal([]byte(profile), &user.Profile); err != nil {
+			return nil, fmt.Errorf("invalid profile of user %d: %w", user.ID, err)
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// StateSQLiteStore replaces the users, tasks and clients of a SQLite database in one transaction
+type StateSQLiteStore struct {
+	db *sql.DB
+}
+
+func NewStateSQLiteStore(db *sql.DB) *StateSQLiteStore {
+	return &StateSQLiteStore{db: db}
+}
+
+func (ss *StateSQLiteStore) ReplaceAll(users []*domain.User, tasks []*domain.Task, clients []*domain.Client) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceSQLiteUsers(tx, users); err != nil {
+		return fmt.Errorf("failed to replace users: %w", err)
+	}
+	if err := replaceSQLiteTasks(tx, tasks); err != nil {
+		return fmt.Errorf("failed to replace tasks: %w", err)
+	}
+	if err := replaceSQLiteClients(tx, clients); err != nil {
+		return fmt.Errorf("failed to replace clients: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+type ClientSQLiteStore struct {
+	db *sql.DB
+}
+
+func NewClientSQLiteStore(db *sql.DB) *ClientSQLiteStore {
+	return &ClientSQLiteStore{db: db}
+}
+
+func (cs *ClientSQLiteStore) GetAll() []*domain.Client {
+	clients, err := cs.queryClients(`SELECT ` + clientColumns + ` FROM clients ORDER BY created_at`)
+	if err != nil {
+		log.Println("Error reading clients:", err)
+		return []*domain.Client{}
+	}
+	return clients
+}
+
+func (cs *ClientSQLiteStore) GetByID(clientID string) (*domain.Client, bool) {
+	clients, err := cs.queryClients(`SELECT `+clientColumns+` FROM clients WHERE client_id = ?`, clientID)
+	if err != nil {
+		log.Println("Error reading client:", err)
+		return nil, false
+	}
+	if len(clients) == 0 {
+		return nil, false
+	}
+	return clients[0], true
+}
+
+func (cs *ClientSQLiteStore) Save(client *domain.Client) error {
+	_, err := cs.db.Exec(
+		`INSERT INTO clients (`+clientColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (client_id) DO UPDATE SET client_secret = excluded.client_secret, metadata = excluded.metadata,
+			registration_token_hash = excluded.registration_token_hash, created_at = excluded.created_at`,
+		client.ClientID, client.ClientSecret, string(client.Metadata), client.RegistrationTokenHash, client.CreatedAt.Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		log.Println("Error saving client:", err)
+		return err
+	}
+	return nil
+}
+
+func (cs *ClientSQLiteStore) Delete(clientID string) bool {
+	result, err := cs.db.Exec(`DELETE FROM clients WHERE client_id = ?`, clientID)
+	if err != nil {
+		log.Println("Error deleting client:", err)
+		return false
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected > 0
+}
+
+// replaceSQLiteClients deletes all clients and inserts the given ones
+func replaceSQLiteClients(exec sqlExecutor, clients []*domain.Client) error {
+	ctx := context.Background()
+	if _, err := exec.ExecContext(ctx, `DELETE FROM clients`); err != nil {
+		return err
+	}
+
+	for _, client := range clients {
+		_, err := exec.ExecContext(ctx,
+			`INSERT INTO clients (`+clientColumns+`) VALUES (?, ?, ?, ?, ?)`,
+			client.ClientID, client.ClientSecret, string(client.Metadata), client.RegistrationTokenHash, client.CreatedAt.Format(time.RFC3339Nano),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert client %s: %w", client.ClientID, err)
+		}
+	}
+
+	return nil
+}
+
+func (cs *ClientSQLiteStore) queryClients(query string, args ...any) ([]*domain.Client, error) {
+	rows, err := cs.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := make([]*domain.Client, 0)
+	for rows.Next() {
+		var client domain.Client
+		var metadata, createdAt string
+		if err := rows.Scan(&client.ClientID, &client.ClientSecret, &metadata, &client.RegistrationTokenHash, &createdAt); err != nil {
+			return nil, err
+		}
+		if client.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid created_at of client %s: %w", client.ClientID, err)
+		}
+		client.Metadata = json.RawMessage(metadata)
+		clients = append(clients, &client)
+	}
+
+	return clients, rows.Err()
+}
+
+// WriteSQLite replaces the contents of the SQLite database at path with the given
+// tasks, users and clients, creating the database if needed
+func WriteSQLite(path string, tasks []*domain.Task, users []*domain.User, clients []*domain.Client) error {
+	db, err := OpenSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return NewStateSQLiteStore(db).ReplaceAll(users, tasks, clients)
+}
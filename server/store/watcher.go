@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/fsnotify/fsnotify"
+	"github.com/goccy/go-json"
+)
+
+// reloadDelay gives editors time to finish writing before the file is read
+const reloadDelay = 100 * time.Millisecond
+
+// Watch reloads the data file whenever another process changes it, until ctx is done.
+// Invalid content is reported and ignored; writes are rejected until the file is fixed.
+func (f *DataFile) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	// Watch the directory, since editors and atomic writes replace the file
+	// instead of modifying it, which ends a watch on the file itself
+	if err := watcher.Add(filepath.Dir(f.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch data file: %w", err)
+	}
+
+	go f.watch(ctx, watcher)
+	return nil
+}
+
+func (f *DataFile) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	name := filepath.Clean(f.path)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != name || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			timer.Reset(reloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("Error watching data file:", err)
+		case <-timer.C:
+			f.reload()
+		}
+	}
+}
+
+func (f *DataFile) reload() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.loadLatest(); err != nil {
+		log.Println("Ignoring invalid change to data file, writes fail until it is fixed:", err)
+	}
+}
+
+// summarizeChanges describes how many tasks and users were added, removed and changed
+func summarizeChanges(before, after *FileData) string {
+	if before == nil {
+		before = emptyFileData()
+	}
+
+	taskAdded, taskRemoved, taskChanged := diffByID(before.Tasks, after.Tasks, func(task *domain.Task) int { return task.ID })
+	userAdded, userRemoved, userChanged := diffByID(before.Users, after.Users, func(user *domain.UserStorage) int { return user.ID })
+
+	return fmt.Sprintf("tasks %d added, %d removed, %d changed; users %d added, %d removed, %d changed",
+		taskAdded, taskRemoved, taskChanged, userAdded, userRemoved, userChanged)
+}
+
+func diffByID[T any](before, after []T, id func(T) int) (added, removed, changed int) {
+	previous := make(map[int][]byte, len(before))
+	for _, item := range before {
+		encoded, _ := json.Marshal(item)
+		previous[id(item)] = encoded
+	}
+
+	for _, item := range after {
+		encoded, _ := json.Marshal(item)
+		old, exists := previous[id(item)]
+		switch {
+		case !exists:
+			added++
+		case string(old) != string(encoded):
+			changed++
+		}
+		delete(previous, id(item))
+	}
+
+	return added, len(previous), changed
+}
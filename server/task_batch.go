@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
+	"github.com/gin-gonic/gin"
+)
+
+const maxBatchOperations = 100
+
+// errBatchRollback aborts an atomic batch transaction after a failed operation
+var errBatchRollback = errors.New("batch rolled back")
+
+type BatchOperationMethod string
+
+const (
+	BatchCreate BatchOperationMethod = "create"
+	BatchUpdate BatchOperationMethod = "update"
+	BatchDelete BatchOperationMethod = "delete"
+)
+
+// BatchRequest is the request body of POST /tasks/batch
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+	// ContinueOnError applies every operation independently instead of all-or-nothing
+	ContinueOnError bool `json:"continue_on_error"`
+}
+
+// BatchOperation is a single create, update or delete in a batch
+type BatchOperation struct {
+	Method  BatchOperationMethod `json:"method"`
+	ID      int                  `json:"id,omitempty"`
+	IfMatch string               `json:"if_match,omitempty"`
+	Body    json.RawMessage      `json:"body,omitempty"`
+}
+
+// BatchResult is the outcome of a single batch operation
+type BatchResult struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+// BatchResponse is the response body of POST /tasks/batch
+type BatchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchTasks applies several task operations in a single request.
+// By default the batch is atomic: if any operation fails, none of them are applied.
+func (h *TaskHandler) BatchTasks(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operations must not be empty"})
+		return
+	}
+	if len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch can contain at most %d operations", maxBatchOperations)})
+		return
+	}
+
+	userID := 0
+	scoped := h.scopedToUser(c)
+	var owners map[int]error
+	if h.authRequired && auth.IsServiceClient(c) {
+		owners = h.batchOwners(req.Operations)
+	}
+	if scoped {
+		id, exists := auth.GetUserIDFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+		userID = id
+	}
+
+	results := make([]BatchResult, len(req.Operations))
+	failed := false
+
+	err := h.store.Transaction(func(tx store.TaskStore) error {
+		for i, op := range req.Operations {
+			results[i] = h.applyBatchOperation(tx, userID, scoped, owners, op)
+			if results[i].Status >= http.StatusBadRequest {
+				failed = true
+				if !req.ContinueOnError {
+					// Operations after the failing one are never attempted
+					for j := i + 1; j < len(results); j++ {
+						results[j] = BatchResult{Status: http.StatusFailedDependency}
+					}
+					return errBatchRollback
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errBatchRollback) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save tasks"})
+		return
+	}
+
+	if errors.Is(err, errBatchRollback) {
+		// Successful operations were rolled back together with the failing one
+		for i := range results {
+			if results[i].Status < http.StatusBadRequest {
+				results[i] = BatchResult{Status: http.StatusFailedDependency}
+			}
+		}
+		c.JSON(http.StatusUnprocessableEntity, BatchResponse{Committed: false, Results: results})
+		return
+	}
+
+	status := http.StatusOK
+	if failed {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, BatchResponse{Committed: true, Results: results})
+}
+
+// batchOwners checks the owners a service client names with user_id in create operations,
+// keyed by user ID. It runs before the task transaction, since the file and SQLite stores
+// share their lock or connection between tasks and users.
+func (h *TaskHandler) batchOwners(operations []BatchOperation) map[int]error {
+	owners := make(map[int]error)
+	for _, op := range operations {
+		var body struct {
+			UserID int `json:"user_id"`
+		}
+		if op.Method != BatchCreate || json.Unmarshal(op.Body, &body) != nil {
+			continue
+		}
+		if _, checked := owners[body.UserID]; !checked {
+			owners[body.UserID] = h.checkOwner(body.UserID)
+		}
+	}
+	return owners
+}
+
+// applyBatchOperation runs one operation against the transaction with the same
+// validation and ownership rules as the single-task endpoints. Unless scoped is set,
+// the operation may reach tasks of any user. owners is set for a service client, which
+// names the owner of created tasks with user_id; it holds the result of batchOwners.
+func (h *TaskHandler) applyBatchOperation(tx store.TaskStore, userID int, scoped bool, owners map[int]error, op BatchOperation) BatchResult {
+	switch op.Method {
+	case BatchCreate:
+		task, result, ok := decodeBatchTask(op)
+		if !ok {
+			return result
+		}
+		if owners != nil {
+			if err := owners[task.UserID]; err != nil {
+				return batchError(http.StatusBadRequest, err.Error())
+			}
+		} else {
+			task.UserID = userID
+		}
+
+		createdTask := tx.Create(task)
+		if createdTask == nil {
+			return batchError(http.StatusInternalServerError, "Failed to save task")
+		}
+		return BatchResult{Status: http.StatusCreated, Body: createdTask}
+
+	case BatchUpdate, BatchDelete:
+		existingTask, exists := tx.GetByID(op.ID)
+		if !exists {
+			return batchError(http.StatusNotFound, "Task not found")
+		}
+		if scoped && existingTask.UserID != userID {
+			return batchError(http.StatusForbidden, "Access denied")
+		}
+
+		version, ok := matchVersion(op.IfMatch, existingTask)
+		if !ok {
+			return batchError(http.StatusPreconditionFailed, "Task has been modified")
+		}
+
+		if op.Method == BatchDelete {
+			if err := tx.DeleteIfVersion(op.ID, version); err != nil {
+				return batchStoreError(err)
+			}
+			return BatchResult{Status: http.StatusNoContent}
+		}
+
+		task, result, ok := decodeBatchTask(op)
+		if !ok {
+			return result
+		}
+		task.UserID = existingTask.UserID
+
+		updatedTask, err := tx.UpdateIfVersion(op.ID, version, task)
+		if err != nil {
+			return batchStoreError(err)
+		}
+		return BatchResult{Status: http.StatusOK, Body: updatedTask}
+
+	default:
+		return batchError(http.StatusBadRequest, "method must be one of 'create', 'update' or 'delete'")
+	}
+}
+
+func decodeBatchTask(op BatchOperation) (*domain.Task, BatchResult, bool) {
+	if len(op.Body) == 0 {
+		return nil, batchError(http.StatusBadRequest, "body is required"), false
+	}
+
+	var task domain.Task
+	if err := json.Unmarshal(op.Body, &task); err != nil {
+		return nil, batchError(http.StatusBadRequest, "Invalid JSON"), false
+	}
+
+	if err := validateTask(&task); err != nil {
+		return nil, batchError(http.StatusBadRequest, err.Error()), false
+	}
+
+	return &task, BatchResult{}, true
+}
+
+func batchError(status int, message string) BatchResult {
+	return BatchResult{Status: status, Body: gin.H{"error": message}}
+}
+
+func batchStoreError(err error) BatchResult {
+	switch {
+	case errors.Is(err, store.ErrTaskNotFound):
+		return batchError(http.StatusNotFound, "Task not found")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return batchError(http.StatusPreconditionFailed, "Task has been modified")
+	default:
+		return batchError(http.StatusInternalServerError, "Failed to save task")
+	}
+}
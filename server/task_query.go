@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultCursorLimit is the page size used when a cursor is given without a limit
+	defaultCursorLimit = 20
+	maxPageLimit       = 100
+
+	totalCountHeader = "X-Total-Count"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// defaultTaskSort keeps GET /tasks deterministic when no sort is requested
+var defaultTaskSort = []store.TaskSort{{Field: store.TaskSortID}}
+
+// taskCursor is the opaque cursor handed out for keyset pagination.
+// It holds the sort key values of the last task on a page.
+type taskCursor struct {
+	Sort      string          `json:"s"`
+	ID        int             `json:"id"`
+	Title     string          `json:"t,omitempty"`
+	Completed bool            `json:"c,omitempty"`
+	DueDate   *string         `json:"d,omitempty"`
+	Priority  domain.Priority `json:"p,omitempty"`
+	CreatedAt string          `json:"ca,omitempty"`
+	UpdatedAt string          `json:"ua,omitempty"`
+}
+
+// parseTaskQuery builds a task query from the GET /tasks query parameters
+func parseTaskQuery(c *gin.Context) (*store.TaskQuery, error) {
+	query := &store.TaskQuery{}
+
+	if value := c.Query("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("completed must be 'true' or 'false'")
+		}
+		query.Completed = &completed
+	}
+
+	query.Tags = c.QueryArray("tag")
+	query.TitleContains = c.Query("title")
+
+	var err error
+	if query.CreatedAfter, err = parseTimeParam(c, "created_after", false); err != nil {
+		return nil, err
+	}
+	if query.CreatedBefore, err = parseTimeParam(c, "created_before", true); err != nil {
+		return nil, err
+	}
+	if query.DueAfter, err = parseTimeParam(c, "due_after", false); err != nil {
+		return nil, err
+	}
+	if query.DueBefore, err = parseTimeParam(c, "due_before", true); err != nil {
+		return nil, err
+	}
+
+	sortParam := c.Query("sort")
+	query.Sort, err = parseTaskSort(sortParam)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+		query.Offset = offset
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		if c.Query("offset") != "" {
+			return nil, fmt.Errorf("cursor and offset cannot be combined")
+		}
+		after, err := decodeTaskCursor(value, sortParam)
+		if err != nil {
+			return nil, err
+		}
+		query.After = after
+		if query.Limit == 0 {
+			query.Limit = defaultCursorLimit
+		}
+	}
+
+	return query, nil
+}
+
+// parseTimeParam parses an optional time query parameter in any accepted due date layout.
+// For an upper bound a date-only value covers the whole day, up to the start of the next day.
+func parseTimeParam(c *gin.Context, name string, upper bool) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range dueDateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if upper && layout == time.DateOnly {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &t, nil
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
+// parseTaskSort parses a sort parameter such as "created_at,-priority"
+func parseTaskSort(value string) ([]store.TaskSort, error) {
+	if value == "" {
+		return defaultTaskSort, nil
+	}
+
+	var sorts []store.TaskSort
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		descending := strings.HasPrefix(part, "-")
+		field := store.TaskSortField(strings.TrimPrefix(part, "-"))
+
+		valid := false
+		for _, f := range store.TaskSortFields {
+			if f == field {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("cannot sort by '%s'", field)
+		}
+
+		sorts = append(sorts, store.TaskSort{Field: field, Descending: descending})
+	}
+
+	return sorts, nil
+}
+
+func encodeTaskCursor(task *domain.Task, sort string) string {
+	cursor := taskCursor{
+		Sort:      sort,
+		ID:        task.ID,
+		Title:     task.Title,
+		Completed: task.Completed,
+		DueDate:   task.DueDate,
+		Priority:  task.Priority,
+		CreatedAt: task.CreatedAt,
+		UpdatedAt: task.UpdatedAt,
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTaskCursor returns the sort keys stored in the cursor as a task.
+// A cursor is only valid for the sort order it was issued for.
+func decodeTaskCursor(value, sort string) (*domain.Task, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("cursor was issued for a different sort order")
+	}
+
+	return &domain.Task{
+		ID:        cursor.ID,
+		Title:     cursor.Title,
+		Completed: cursor.Completed,
+		DueDate:   cursor.DueDate,
+		Priority:  cursor.Priority,
+		CreatedAt: cursor.CreatedAt,
+		UpdatedAt: cursor.UpdatedAt,
+	}, nil
+}
+
+// setPaginationHeaders sets the total count and Link headers for a page of tasks
+func setPaginationHeaders(c *gin.Context, query *store.TaskQuery, page *store.TaskPage) {
+	c.Header(totalCountHeader, strconv.Itoa(page.Total))
+
+	if query.Limit == 0 {
+		return
+	}
+
+	var links []string
+	addLink := func(rel string, modify func(url.Values)) {
+		values := c.Request.URL.Query()
+		modify(values)
+		links = append(links, fmt.Sprintf("<%s?%s>; rel=\"%s\"", requestBaseURL(c)+c.Request.URL.Path, values.Encode(), rel))
+	}
+
+	// The next cursor is always exposed so clients can switch to keyset pagination
+	var nextCursor string
+	if page.HasMore && len(page.Tasks) > 0 {
+		nextCursor = encodeTaskCursor(page.Tasks[len(page.Tasks)-1], c.Query("sort"))
+		c.Header(nextCursorHeader, nextCursor)
+	}
+
+	if query.After != nil {
+		// Keyset pagination only supports moving forward
+		if nextCursor != "" {
+			addLink("next", func(v url.Values) { v.Set("cursor", nextCursor) })
+		}
+	} else {
+		limit := query.Limit
+		lastOffset := 0
+		if page.Total > 0 {
+			lastOffset = (page.Total - 1) / limit * limit
+		}
+
+		addLink("first", func(v url.Values) { v.Set("offset", "0") })
+		if query.Offset > 0 {
+			prev := max(query.Offset-limit, 0)
+			addLink("prev", func(v url.Values) { v.Set("offset", strconv.Itoa(prev)) })
+		}
+		if page.HasMore {
+			next := query.Offset + limit
+			addLink("next", func(v url.Values) { v.Set("offset", strconv.Itoa(next)) })
+		}
+		addLink("last", func(v url.Values) { v.Set("offset", strconv.Itoa(lastOffset)) })
+	}
+
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+// requestBaseURL returns the scheme and host the request was made to
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
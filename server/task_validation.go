@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 2000
+	maxTags              = 20
+	maxTagLength         = 50
+)
+
+// dueDateLayouts lists the accepted formats for due_date, in order of preference
+var dueDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// validateTask checks the client-supplied fields of a task and normalizes them in place.
+// Server-managed fields (ID, UserID and timestamps) are left untouched.
+func validateTask(task *domain.Task) error {
+	task.Title = strings.TrimSpace(task.Title)
+	if task.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if utf8.RuneCountInString(task.Title) > maxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxTitleLength)
+	}
+
+	if utf8.RuneCountInString(task.Description) > maxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters", maxDescriptionLength)
+	}
+
+	switch task.Priority {
+	case "":
+		task.Priority = domain.DefaultPriority
+	case domain.PriorityLow, domain.PriorityMedium, domain.PriorityHigh:
+	default:
+		return fmt.Errorf("priority must be one of 'low', 'medium' or 'high'")
+	}
+
+	if task.DueDate != nil {
+		if *task.DueDate == "" {
+			task.DueDate = nil
+		} else {
+			dueDate, err := normalizeDueDate(*task.DueDate)
+			if err != nil {
+				return err
+			}
+			task.DueDate = &dueDate
+		}
+	}
+
+	tags, err := normalizeTags(task.Tags)
+	if err != nil {
+		return err
+	}
+	task.Tags = tags
+
+	return nil
+}
+
+// normalizeDueDate parses a due date in any accepted layout and formats it as RFC 3339 in UTC
+func normalizeDueDate(value string) (string, error) {
+	for _, layout := range dueDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("due_date must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+}
+
+// normalizeTags trims tags and removes duplicates while keeping their order
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("tags must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters", maxTagLength)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a task can have at most %d tags", maxTags)
+	}
+
+	return normalized, nil
+}
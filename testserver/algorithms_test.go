@@ -0,0 +1,157 @@
+package testserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// publicKeyFromJWK rebuilds the public key a relying party would use to verify tokens
+func publicKeyFromJWK(t *testing.T, jwk auth.JWK) interface{} {
+	t.Helper()
+
+	decode := func(value string) *big.Int {
+		bytes, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("invalid JWK parameter %q: %v", value, err)
+		}
+		return new(big.Int).SetBytes(bytes)
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: decode(jwk.N), E: int(decode(jwk.E).Int64())}
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		return &ecdsa.PublicKey{Curve: curves[jwk.Crv], X: decode(jwk.X), Y: decode(jwk.Y)}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			t.Fatalf("invalid JWK parameter x: %v", err)
+		}
+		return ed25519.PublicKey(x)
+	default:
+		t.Fatalf("unexpected key type %s", jwk.Kty)
+		return nil
+	}
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	tests := []struct {
+		keyMode   auth.JWTKeyMode
+		algorithm string
+		kty       string
+		crv       string
+	}{
+		{auth.JWTKeyModeRSA, "PS256", "RSA", ""},
+		{auth.JWTKeyModeRSA, "RS512", "RSA", ""},
+		{auth.JWTKeyModeECDSA, "", "EC", "P-256"},
+		{auth.JWTKeyModeECDSA, "ES384", "EC", "P-384"},
+		{auth.JWTKeyModeECDSA, "ES512", "EC", "P-521"},
+		{auth.JWTKeyModeEd25519, "", "OKP", "Ed25519"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.keyMode)+"-"+tt.algorithm, func(t *testing.T) {
+			config := NewConfig()
+			config.JWTKeyMode = tt.keyMode
+			config.JWTAlgorithm = tt.algorithm
+			s := New(t, config)
+
+			want, err := auth.ResolveAlgorithm(tt.keyMode, tt.algorithm)
+			if err != nil {
+				t.Fatalf("ResolveAlgorithm failed: %v", err)
+			}
+
+			resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+			token := decodeAuthResponse(t, resp).Token
+
+			keys := getJWKSet(t, s).Keys
+			if len(keys) != 1 {
+				t.Fatalf("Expected one published key, got %d", len(keys))
+			}
+			jwk := keys[0]
+			if jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.Alg != want || jwk.Kid != tokenKid(t, token) {
+				t.Errorf("Expected a %s %s key for %s, got %+v", tt.kty, tt.crv, want, jwk)
+			}
+
+			// Verify the token the way a relying party would, from the JWK Set
+			_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+				return publicKeyFromJWK(t, jwk), nil
+			}, jwt.WithValidMethods([]string{want}))
+			if err != nil {
+				t.Errorf("Expected the token to verify with the published key: %v", err)
+			}
+
+			resp, err = s.Client().Get(s.URL + "/.well-known/openid_configuration")
+			if err != nil {
+				t.Fatalf("request to discovery failed: %v", err)
+			}
+			defer resp.Body.Close()
+			var discovery struct {
+				Algorithms []string `json:"id_token_signing_alg_values_supported"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+				t.Fatalf("failed to decode discovery document: %v", err)
+			}
+			if !slices.Equal(discovery.Algorithms, []string{want}) {
+				t.Errorf("Expected discovery to list %s, got %v", want, discovery.Algorithms)
+			}
+		})
+	}
+}
+
+func TestSigningAlgorithmMismatch(t *testing.T) {
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeECDSA
+	config.JWTAlgorithm = "RS256"
+	if _, err := Start(config); err == nil {
+		t.Error("Expected an error for an RSA algorithm with ecdsa keys")
+	}
+
+	// A P-256 key cannot sign ES384 tokens
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	dir := t.TempDir()
+	content := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "p256.pem"), content, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	config = NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeECDSA
+	config.JWTKeyDir = dir
+	s := New(t, config)
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	if kid := tokenKid(t, decodeAuthResponse(t, resp).Token); kid != "p256" {
+		t.Errorf("Expected the provided EC key to sign ES256 tokens, got kid %s", kid)
+	}
+	s.Close()
+
+	config.JWTAlgorithm = "ES384"
+	if _, err := Start(config); err == nil || !strings.Contains(err.Error(), "P-384") {
+		t.Errorf("Expected an error naming the required curve, got %v", err)
+	}
+}
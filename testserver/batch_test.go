@@ -0,0 +1,213 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+)
+
+func decodeBatchResponse(t *testing.T, resp *http.Response) server.BatchResponse {
+	t.Helper()
+
+	var batchResp server.BatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batchResp); err != nil {
+		t.Fatalf("failed to decode batch response: %v", err)
+	}
+	return batchResp
+}
+
+func batchStatuses(batchResp server.BatchResponse) []int {
+	statuses := make([]int, len(batchResp.Results))
+	for i, result := range batchResp.Results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+func TestBatchTasksAtomic(t *testing.T) {
+	stores := map[string]func(*Config){
+		"memory": func(*Config) {},
+		"json":   func(c *Config) { c.JsonFilePath = filepath.Join(t.TempDir(), "data.json") },
+	}
+
+	for name, configure := range stores {
+		t.Run(name, func(t *testing.T) {
+			config := NewConfig()
+			config.AuthRequired = false
+			configure(config)
+			s := New(t, config)
+
+			postJSON(t, s, "/tasks", "", map[string]string{"title": "Existing"})
+
+			resp := postJSON(t, s, "/tasks/batch", "", map[string]interface{}{
+				"operations": []map[string]interface{}{
+					{"method": "create", "body": map[string]string{"title": "Rolled back"}},
+					{"method": "update", "id": 1, "body": map[string]string{"title": "Renamed"}},
+					{"method": "delete", "id": 99},
+					{"method": "delete", "id": 1},
+				},
+			})
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status 422 from a failing atomic batch, got %d", resp.StatusCode)
+			}
+
+			batchResp := decodeBatchResponse(t, resp)
+			want := []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency}
+			if batchResp.Committed || len(batchResp.Results) != len(want) {
+				t.Fatalf("Expected an uncommitted batch with %d results, got %+v", len(want), batchResp)
+			}
+			for i, status := range batchStatuses(batchResp) {
+				if status != want[i] {
+					t.Errorf("Expected result %d to have status %d, got %d", i, want[i], status)
+				}
+			}
+
+			tasks := s.TaskStore.GetAll()
+			if len(tasks) != 1 || tasks[0].Title != "Existing" || tasks[0].Version != 1 {
+				t.Fatalf("Expected the batch to be rolled back, got %+v", tasks)
+			}
+
+			resp = postJSON(t, s, "/tasks/batch", "", map[string]interface{}{
+				"operations": []map[string]interface{}{
+					{"method": "create", "body": map[string]string{"title": "Created"}},
+					{"method": "update", "id": 1, "if_match": `"1-1"`, "body": map[string]string{"title": "Renamed"}},
+				},
+			})
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200 from a successful batch, got %d", resp.StatusCode)
+			}
+			if batchResp := decodeBatchResponse(t, resp); !batchResp.Committed {
+				t.Error("Expected the successful batch to be committed")
+			}
+			if task, _ := s.TaskStore.GetByID(1); task.Title != "Renamed" {
+				t.Errorf("Expected the batch update to be applied, got %+v", task)
+			}
+			if _, exists := s.TaskStore.GetByID(2); !exists {
+				t.Error("Expected the batch create to be applied")
+			}
+		})
+	}
+}
+
+func TestBatchTasksContinueOnError(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	postJSON(t, s, "/tasks", "", map[string]string{"title": "Existing"})
+
+	resp := postJSON(t, s, "/tasks/batch", "", map[string]interface{}{
+		"continue_on_error": true,
+		"operations": []map[string]interface{}{
+			{"method": "create", "body": map[string]string{"title": "Created"}},
+			{"method": "create", "body": map[string]string{"title": ""}},
+			{"method": "update", "id": 1, "if_match": `"1-7"`, "body": map[string]string{"title": "Stale"}},
+			{"method": "archive", "id": 1},
+			{"method": "delete", "id": 1},
+		},
+	})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207 from a partially failing batch, got %d", resp.StatusCode)
+	}
+
+	batchResp := decodeBatchResponse(t, resp)
+	want := []int{
+		http.StatusCreated,
+		http.StatusBadRequest,
+		http.StatusPreconditionFailed,
+		http.StatusBadRequest,
+		http.StatusNoContent,
+	}
+	if !batchResp.Committed || len(batchResp.Results) != len(want) {
+		t.Fatalf("Expected a committed batch with %d results, got %+v", len(want), batchResp)
+	}
+	for i, status := range batchStatuses(batchResp) {
+		if status != want[i] {
+			t.Errorf("Expected result %d to have status %d, got %d", i, want[i], status)
+		}
+	}
+
+	tasks := s.TaskStore.GetAll()
+	if len(tasks) != 1 || tasks[0].Title != "Created" {
+		t.Errorf("Expected only the successful operations to be applied, got %+v", tasks)
+	}
+
+	for _, body := range []map[string]interface{}{
+		{"operations": []map[string]interface{}{}},
+		{"operations": make([]map[string]interface{}, 101)},
+	} {
+		if resp := postJSON(t, s, "/tasks/batch", "", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %d operations, got %d", len(body["operations"].([]map[string]interface{})), resp.StatusCode)
+		}
+	}
+}
+
+func TestBatchTasksServiceClient(t *testing.T) {
+	stores := map[string]func(*Config){
+		"memory": func(*Config) {},
+		"json":   func(c *Config) { c.JsonFilePath = filepath.Join(t.TempDir(), "data.json") },
+		"sqlite": func(c *Config) { c.SQLitePath = filepath.Join(t.TempDir(), "data.db") },
+	}
+
+	for name, configure := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newOIDCServerWithStore(t, auth.OIDCConfig{
+				Issuer: "http://localhost:8080",
+				Scopes: []string{"openid", "tasks:write"},
+				Clients: []*auth.OIDCClient{
+					{ClientID: "writer", ClientSecret: "writer-secret", GrantTypes: []string{"client_credentials"}, Scopes: []string{"tasks:write"}},
+				},
+			}, configure)
+			alice, _ := s.UserStore.GetByUsername("alice")
+
+			status, body := exchangeCode(t, s, url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"writer"},
+				"client_secret": {"writer-secret"},
+				"scope":         {"tasks:write"},
+			})
+			if status != http.StatusOK {
+				t.Fatalf("Expected status 200 from the client credentials grant, got %d %v", status, body)
+			}
+			bearer := http.Header{"Authorization": {"Bearer " + body["access_token"].(string)}}
+
+			// The owners are looked up while the batch runs in a task transaction
+			resp := sendRequest(t, s, http.MethodPost, "/tasks/batch", bearer, `{
+				"continue_on_error": true,
+				"operations": [
+					{"method": "create", "body": {"title": "For alice", "user_id": `+strconv.Itoa(alice.ID)+`}},
+					{"method": "create", "body": {"title": "Unknown owner", "user_id": 99}},
+					{"method": "create", "body": {"title": "No owner"}}
+				]
+			}`)
+			if resp.StatusCode != http.StatusMultiStatus {
+				t.Fatalf("Expected status 207 from a partially failing batch, got %d", resp.StatusCode)
+			}
+			want := []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest}
+			for i, status := range batchStatuses(decodeBatchResponse(t, resp)) {
+				if status != want[i] {
+					t.Errorf("Expected result %d to have status %d, got %d", i, want[i], status)
+				}
+			}
+
+			resp = sendRequest(t, s, http.MethodPost, "/tasks/batch", bearer, `{"operations": [
+				{"method": "create", "body": {"title": "Rolled back", "user_id": `+strconv.Itoa(alice.ID)+`}},
+				{"method": "create", "body": {"title": "Unknown owner", "user_id": 99}}
+			]}`)
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status 422 from an atomic batch with an unknown owner, got %d", resp.StatusCode)
+			}
+
+			tasks := s.TaskStore.GetAll()
+			if len(tasks) != 1 || tasks[0].Title != "For alice" || tasks[0].UserID != alice.ID {
+				t.Errorf("Expected only the task with an existing owner to be created, got %+v", tasks)
+			}
+		})
+	}
+}
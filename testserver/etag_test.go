@@ -0,0 +1,95 @@
+package testserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTaskETagRoundTrip(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	resp := sendRequest(t, s, http.MethodPost, "/tasks", nil, `{"title": "Write tests"}`)
+	created := resp.Header.Get("ETag")
+	if created == "" {
+		t.Fatal("Expected an ETag on the created task")
+	}
+
+	resp = sendRequest(t, s, http.MethodGet, "/tasks/1", nil, "")
+	if got := resp.Header.Get("ETag"); got != created {
+		t.Fatalf("Expected GET to return the ETag %s, got %s", created, got)
+	}
+
+	resp = sendRequest(t, s, http.MethodGet, "/tasks/1", http.Header{"If-None-Match": {created}}, "")
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304 for a matching If-None-Match, got %d", resp.StatusCode)
+	}
+
+	resp = sendRequest(t, s, http.MethodPut, "/tasks/1", http.Header{"If-Match": {created}}, `{"title": "Updated"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 for a matching If-Match, got %d", resp.StatusCode)
+	}
+	updated := resp.Header.Get("ETag")
+	if updated == "" || updated == created {
+		t.Fatalf("Expected a new ETag after the update, got %s", updated)
+	}
+
+	resp = sendRequest(t, s, http.MethodGet, "/tasks/1", http.Header{"If-None-Match": {created}}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 for a stale If-None-Match, got %d", resp.StatusCode)
+	}
+
+	// Writes with the stale ETag fail and report the current one
+	resp = sendRequest(t, s, http.MethodPut, "/tasks/1", http.Header{"If-Match": {created}}, `{"title": "Lost update"}`)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status 412 for a stale If-Match, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("ETag"); got != updated {
+		t.Errorf("Expected the 412 response to carry the current ETag %s, got %s", updated, got)
+	}
+
+	resp = patchTask(t, s, "/tasks/1", "application/merge-patch+json", `{"completed": true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from an unconditional patch, got %d", resp.StatusCode)
+	}
+
+	resp = sendRequest(t, s, http.MethodDelete, "/tasks/1", http.Header{"If-Match": {updated}}, "")
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 deleting with a stale If-Match, got %d", resp.StatusCode)
+	}
+	if task, exists := s.TaskStore.GetByID(1); !exists || task.Title != "Updated" || !task.Completed {
+		t.Fatalf("Expected failed preconditions to leave the task unchanged, got %+v", task)
+	}
+
+	resp = sendRequest(t, s, http.MethodDelete, "/tasks/1", http.Header{"If-Match": {"*"}}, "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting with If-Match *, got %d", resp.StatusCode)
+	}
+}
+
+func TestTaskListETag(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	postJSON(t, s, "/tasks", "", map[string]string{"title": "First"})
+
+	resp := sendRequest(t, s, http.MethodGet, "/tasks", nil, "")
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag on the task list")
+	}
+
+	resp = sendRequest(t, s, http.MethodGet, "/tasks", http.Header{"If-None-Match": {etag}}, "")
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304 for an unchanged list, got %d", resp.StatusCode)
+	}
+
+	postJSON(t, s, "/tasks", "", map[string]string{"title": "Second"})
+
+	resp = sendRequest(t, s, http.MethodGet, "/tasks", http.Header{"If-None-Match": {etag}}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 after the list changed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,107 @@
+package testserver
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server/fault"
+)
+
+func TestFaultInjectionScopedToRoute(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	config.Faults = fault.Config{
+		Seed: 1,
+		Rules: []fault.Rule{{
+			Routes:        []string{"POST /tasks"},
+			ErrorRate:     100,
+			ErrorStatuses: []int{http.StatusServiceUnavailable},
+		}},
+	}
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/tasks", "", map[string]string{"title": "Write tests"})
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503 from create task, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get(fault.InjectedHeader) != "error" {
+		t.Errorf("Expected the %s header on an injected error", fault.InjectedHeader)
+	}
+	if len(s.TaskStore.GetAll()) != 0 {
+		t.Error("Expected the failed request not to reach the handler")
+	}
+
+	getResp, err := s.Client().Get(s.URL + "/tasks")
+	if err != nil {
+		t.Fatalf("GET /tasks failed: %v", err)
+	}
+	getResp.Body.Close()
+	if getResp.StatusCode != http.StatusOK {
+		t.Errorf("Expected GET /tasks to be unaffected, got %d", getResp.StatusCode)
+	}
+
+	s.Faults.Reset()
+
+	resp = postJSON(t, s, "/tasks", "", map[string]string{"title": "Write tests"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status 201 after resetting faults, got %d", resp.StatusCode)
+	}
+}
+
+func TestFaultInjectionIsReproducible(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	config.Faults = fault.Config{
+		Seed:  7,
+		Rules: []fault.Rule{{ErrorRate: 50}},
+	}
+
+	statuses := func() []int {
+		s := New(t, config)
+
+		var result []int
+		for i := 0; i < 20; i++ {
+			resp, err := s.Client().Get(s.URL + "/tasks")
+			if err != nil {
+				t.Fatalf("GET /tasks failed: %v", err)
+			}
+			resp.Body.Close()
+			result = append(result, resp.StatusCode)
+		}
+		return result
+	}
+
+	first, second := statuses(), statuses()
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same statuses for the same seed, got %v and %v", first, second)
+		}
+		if first[i] == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(first) {
+		t.Errorf("Expected some but not all requests to fail, got %v", first)
+	}
+}
+
+func TestFaultInjectionTruncatesBody(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	config.Faults = fault.Config{
+		Rules: []fault.Rule{{Methods: []string{http.MethodGet}, TruncateRate: 100}},
+	}
+	s := New(t, config)
+
+	resp, err := s.Client().Get(s.URL + "/tasks")
+	if err != nil {
+		t.Fatalf("GET /tasks failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.ReadAll(resp.Body); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected an unexpected EOF reading a truncated body, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+func TestStartFailsOnCorruptDataFile(t *testing.T) {
+	content := "{\n  \"tasks\": [\n    {\"id\": 1,}\n  ]\n}"
+	config := NewConfig()
+	config.JsonFilePath = filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(config.JsonFilePath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write data file: %v", err)
+	}
+
+	_, err := Start(config)
+	if err == nil {
+		t.Fatal("Expected error when the data file is corrupt")
+	}
+	if !strings.Contains(err.Error(), "line 3, column") {
+		t.Errorf("Expected the error to point at line 3, got %v", err)
+	}
+
+	// The corrupt file must be left as it is for the user to fix
+	got, err := os.ReadFile(config.JsonFilePath)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("Expected the data file to be untouched, got %q", got)
+	}
+}
+
+func TestFileStoreWritesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	config := NewConfig()
+	config.AuthRequired = false
+	config.JsonFilePath = filepath.Join(dir, "data.json")
+
+	s := New(t, config)
+
+	for i := 0; i < 5; i++ {
+		resp := postJSON(t, s, "/tasks", "", map[string]string{"title": "Task"})
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "data.json" {
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Expected only the data file to remain, got %v", names)
+	}
+
+	s.Close()
+
+	s = New(t, config)
+	if got := len(s.TaskStore.GetAll()); got != 5 {
+		t.Errorf("Expected 5 tasks after a restart, got %d", got)
+	}
+}
+
+func TestFileStoreReloadsExternalEdits(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	config.JsonFilePath = filepath.Join(t.TempDir(), "data.json")
+
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/tasks", "", map[string]string{"title": "First"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+	}
+
+	edited := `{"tasks": [{"id": 1, "title": "First"}, {"id": 7, "title": "Edited"}],
+		"users": [{"id": 3, "username": "carol", "hashed_password": "x", "created_at": "2023-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(config.JsonFilePath, []byte(edited), 0644); err != nil {
+		t.Fatalf("failed to edit data file: %v", err)
+	}
+
+	resp = postJSON(t, s, "/tasks", "", map[string]string{"title": "After edit"})
+	var task domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if task.ID != 8 {
+		t.Errorf("Expected the next task ID to follow the edited file, got %d", task.ID)
+	}
+
+	resp = postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "dave", Password: "password1"})
+	var authResp domain.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+	if authResp.User.ID != 4 {
+		t.Errorf("Expected the next user ID to follow the edited file, got %d", authResp.User.ID)
+	}
+
+	// An invalid edit is never overwritten
+	invalid := `{"tasks": [`
+	if err := os.WriteFile(config.JsonFilePath, []byte(invalid), 0644); err != nil {
+		t.Fatalf("failed to edit data file: %v", err)
+	}
+
+	resp = postJSON(t, s, "/tasks", "", map[string]string{"title": "Rejected"})
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 while the data file is invalid, got %d", resp.StatusCode)
+	}
+	got, err := os.ReadFile(config.JsonFilePath)
+	if err != nil {
+		t.Fatalf("failed to read data file: %v", err)
+	}
+	if string(got) != invalid {
+		t.Errorf("Expected the invalid data file to be untouched, got %q", got)
+	}
+}
+
+// logBuffer collects the log output of the server, which the file watcher writes from its own goroutine
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog redirects the standard logger to a buffer until the test ends
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+
+	logs := &logBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return logs
+}
+
+func TestFileStoreWatcherReloadsExternalEdits(t *testing.T) {
+	const reloaded = "Reloaded data file"
+	edited := `{"tasks": [{"id": 7, "title": "Edited"}], "users": []}`
+
+	for _, watch := range []bool{true, false} {
+		config := NewConfig()
+		config.AuthRequired = false
+		config.WatchFile = watch
+		config.JsonFilePath = filepath.Join(t.TempDir(), "data.json")
+		New(t, config)
+		logs := captureLog(t)
+
+		if err := os.WriteFile(config.JsonFilePath, []byte(edited), 0644); err != nil {
+			t.Fatalf("failed to edit data file: %v", err)
+		}
+
+		// No request is sent, so only the watcher can pick up the edit
+		deadline := time.Now().Add(2 * time.Second)
+		for !strings.Contains(logs.String(), reloaded) && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if got := strings.Contains(logs.String(), reloaded); got != watch {
+			t.Errorf("watch-file=%v: expected a reload without a write to be %v, got logs %q", watch, watch, logs.String())
+		}
+	}
+}
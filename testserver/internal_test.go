@@ -0,0 +1,243 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/export"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+func TestResetRestartsIDs(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	postJSON(t, s, "/tasks", "", map[string]string{"title": "First"})
+	postJSON(t, s, "/tasks", "", map[string]string{"title": "Second"})
+
+	resp := postJSON(t, s, "/internal/reset", "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204 from reset, got %d", resp.StatusCode)
+	}
+	if len(s.TaskStore.GetAll()) != 0 {
+		t.Fatal("Expected no tasks after reset")
+	}
+
+	resp = postJSON(t, s, "/tasks", "", map[string]string{"title": "Third"})
+	var task domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if task.ID != 1 {
+		t.Errorf("Expected task IDs to restart at 1, got %d", task.ID)
+	}
+}
+
+func TestSeedFixtures(t *testing.T) {
+	s := New(t, nil)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from register, got %d", resp.StatusCode)
+	}
+
+	resp = postJSON(t, s, "/internal/seed", "", map[string]interface{}{
+		"users": []map[string]string{{"username": "bob", "password": "secret"}},
+		"tasks": []map[string]string{{"title": "Seeded", "username": "bob"}},
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from seed, got %d", resp.StatusCode)
+	}
+
+	if _, exists := s.UserStore.GetByUsername("alice"); exists {
+		t.Error("Expected seeding to replace existing users")
+	}
+	bob, exists := s.UserStore.GetByUsername("bob")
+	if !exists || bob.ID != 1 {
+		t.Fatalf("Expected seeded user bob with ID 1, got %+v", bob)
+	}
+
+	resp = postJSON(t, s, "/auth/login", "", domain.LoginRequest{Username: "bob", Password: "secret"})
+	var authResp domain.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+	if authResp.Token == "" {
+		t.Error("Expected the seeded user to be able to log in")
+	}
+
+	tasks := s.TaskStore.GetAllByUserID(bob.ID)
+	if len(tasks) != 1 || tasks[0].Title != "Seeded" {
+		t.Errorf("Expected the seeded task to belong to bob, got %+v", tasks)
+	}
+
+	resp = postJSON(t, s, "/internal/seed", "", map[string]interface{}{
+		"tasks": []map[string]string{{"title": "Orphan", "username": "carol"}},
+	})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown username, got %d", resp.StatusCode)
+	}
+}
+
+func TestPutMemoryState(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	snapshot := export.FileData{
+		Tasks: []*domain.Task{{ID: 7, Title: "Restored"}},
+		Users: []*domain.UserStorage{{ID: 3, Username: "dave"}},
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("failed to marshal snapshot: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.URL+"/internal/memory-state", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("PUT /internal/memory-state failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from PUT /internal/memory-state, got %d", resp.StatusCode)
+	}
+
+	if task, exists := s.TaskStore.GetByID(7); !exists || task.Version != 1 {
+		t.Fatalf("Expected the restored task with defaults applied, got %+v", task)
+	}
+
+	resp = postJSON(t, s, "/tasks", "", map[string]string{"title": "Next"})
+	var task domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if task.ID != 8 {
+		t.Errorf("Expected the next task ID to follow the snapshot, got %d", task.ID)
+	}
+}
+
+func TestPutMemoryStateRejectsInvalidSnapshot(t *testing.T) {
+	stores := map[string]func(*Config){
+		"memory": func(*Config) {},
+		"json":   func(c *Config) { c.JsonFilePath = filepath.Join(t.TempDir(), "data.json") },
+		"sqlite": func(c *Config) { c.SQLitePath = filepath.Join(t.TempDir(), "data.db") },
+	}
+
+	for name, configure := range stores {
+		t.Run(name, func(t *testing.T) {
+			config := NewConfig()
+			configure(config)
+			s := New(t, config)
+
+			postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+
+			// The users are valid, so only the duplicate task ID rejects the snapshot
+			resp := sendRequest(t, s, http.MethodPut, "/internal/memory-state", nil, `{
+				"users": [{"id": 1, "username": "bob"}],
+				"tasks": [{"id": 1, "title": "First"}, {"id": 1, "title": "Duplicate"}]
+			}`)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("Expected status 400 for a duplicate task ID, got %d", resp.StatusCode)
+			}
+
+			if _, exists := s.UserStore.GetByUsername("alice"); !exists {
+				t.Error("Expected a rejected snapshot to keep the existing users")
+			}
+			if _, exists := s.UserStore.GetByUsername("bob"); exists {
+				t.Error("Expected a rejected snapshot not to replace the users")
+			}
+			if got := len(s.TaskStore.GetAll()); got != 0 {
+				t.Errorf("Expected a rejected snapshot not to store tasks, got %d", got)
+			}
+		})
+	}
+}
+
+func TestMemoryStateRegisteredClients(t *testing.T) {
+	stores := map[string]func(*Config){
+		"memory": func(*Config) {},
+		"json":   func(c *Config) { c.JsonFilePath = filepath.Join(t.TempDir(), "data.json") },
+		"sqlite": func(c *Config) { c.SQLitePath = filepath.Join(t.TempDir(), "data.db") },
+	}
+
+	for name, configure := range stores {
+		t.Run(name, func(t *testing.T) {
+			content, err := json.Marshal(auth.OIDCConfig{
+				Issuer:  "http://localhost:8080",
+				Scopes:  []string{"openid"},
+				Clients: []*auth.OIDCClient{{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}}},
+			})
+			if err != nil {
+				t.Fatalf("failed to encode OIDC config: %v", err)
+			}
+			oidcConfigPath := filepath.Join(t.TempDir(), "oidc-config.json")
+			if err := os.WriteFile(oidcConfigPath, content, 0600); err != nil {
+				t.Fatalf("failed to write OIDC config: %v", err)
+			}
+
+			config := NewConfig()
+			config.AuthMode = auth.AuthModeOIDC
+			config.OIDCConfigPath = oidcConfigPath
+			configure(config)
+			s := New(t, config)
+
+			resp := sendRequest(t, s, http.MethodPost, "/auth/clients", nil, `{"redirect_uris": ["http://localhost:3000/callback"]}`)
+			var registered auth.ClientInformation
+			if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil || resp.StatusCode != http.StatusCreated {
+				t.Fatalf("Expected status 201 from the registration endpoint, got %d %v", resp.StatusCode, err)
+			}
+			registration := http.Header{"Authorization": {"Bearer " + registered.RegistrationAccessToken}}
+			readRegistration := func() int {
+				t.Helper()
+				return sendRequest(t, s, http.MethodGet, "/auth/clients/"+registered.ClientID, registration, "").StatusCode
+			}
+
+			resp = sendRequest(t, s, http.MethodGet, "/internal/memory-state", nil, "")
+			var snapshot export.FileData
+			if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+				t.Fatalf("failed to decode snapshot: %v", err)
+			}
+			if len(snapshot.Clients) != 1 || snapshot.Clients[0].ClientID != registered.ClientID {
+				t.Fatalf("Expected the snapshot to contain the registered client, got %+v", snapshot.Clients)
+			}
+
+			if resp := postJSON(t, s, "/internal/reset", "", nil); resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("Expected status 204 from reset, got %d", resp.StatusCode)
+			}
+			if status := readRegistration(); status != http.StatusUnauthorized {
+				t.Errorf("Expected the registered client to be removed by reset, got %d", status)
+			}
+
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				t.Fatalf("failed to marshal snapshot: %v", err)
+			}
+			if resp := sendRequest(t, s, http.MethodPut, "/internal/memory-state", nil, string(data)); resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200 from PUT /internal/memory-state, got %d", resp.StatusCode)
+			}
+			if status := readRegistration(); status != http.StatusOK {
+				t.Errorf("Expected the imported client to be readable with its registration token, got %d", status)
+			}
+
+			snapshot.Clients = append(snapshot.Clients, snapshot.Clients[0])
+			data, err = json.Marshal(snapshot)
+			if err != nil {
+				t.Fatalf("failed to marshal snapshot: %v", err)
+			}
+			if resp := sendRequest(t, s, http.MethodPut, "/internal/memory-state", nil, string(data)); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for a duplicate client ID, got %d", resp.StatusCode)
+			}
+		})
+	}
+}
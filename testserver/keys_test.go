@@ -0,0 +1,285 @@
+package testserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func getJWKSet(t *testing.T, s *Server) auth.JWKSet {
+	t.Helper()
+
+	resp, err := s.Client().Get(s.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("request to jwks failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var jwkSet auth.JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&jwkSet); err != nil {
+		t.Fatalf("failed to decode JWK set: %v", err)
+	}
+	return jwkSet
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("failed to parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// writeRSAKey writes a new RSA key named kid to dir, as an operator would
+func writeRSAKey(t *testing.T, dir, kid string) {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), content, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+func meStatus(t *testing.T, s *Server, token string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/auth/me", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request to /auth/me failed: %v", err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestSigningKeysSurviveRestart(t *testing.T) {
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = filepath.Join(t.TempDir(), "keys")
+	config.JsonFilePath = filepath.Join(t.TempDir(), "data.json")
+
+	s := New(t, config)
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	token := decodeAuthResponse(t, resp).Token
+	s.Close()
+
+	s = New(t, config)
+	if status := meStatus(t, s, token); status != http.StatusOK {
+		t.Errorf("Expected a token from before the restart to be accepted, got %d", status)
+	}
+
+	jwkSet := getJWKSet(t, s)
+	if len(jwkSet.Keys) != 1 || jwkSet.Keys[0].Kid != tokenKid(t, token) {
+		t.Errorf("Expected the persisted key to be published, got %+v", jwkSet.Keys)
+	}
+}
+
+func TestRotateSigningKey(t *testing.T) {
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = t.TempDir()
+	// Long enough for the logins and requests within the grace period, even with -race
+	config.JWTKeyGracePeriod = 3 * time.Second
+
+	s := New(t, config)
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	oldToken := decodeAuthResponse(t, resp).Token
+
+	resp = postJSON(t, s, "/internal/keys/rotate", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from key rotation, got %d", resp.StatusCode)
+	}
+	var rotated server.RotateKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotated); err != nil {
+		t.Fatalf("failed to decode rotation response: %v", err)
+	}
+	if rotated.Kid == tokenKid(t, oldToken) {
+		t.Fatal("Expected a new key ID after rotation")
+	}
+
+	if keys := getJWKSet(t, s).Keys; len(keys) != 2 {
+		t.Fatalf("Expected both keys to be published during the grace period, got %d", len(keys))
+	}
+
+	resp = postJSON(t, s, "/auth/login", "", domain.LoginRequest{Username: "alice", Password: "password1"})
+	newToken := decodeAuthResponse(t, resp).Token
+	if kid := tokenKid(t, newToken); kid != rotated.Kid {
+		t.Errorf("Expected new tokens to be signed with %s, got %s", rotated.Kid, kid)
+	}
+	if status := meStatus(t, s, oldToken); status != http.StatusOK {
+		t.Errorf("Expected the old token to be accepted during the grace period, got %d", status)
+	}
+
+	time.Sleep(config.JWTKeyGracePeriod)
+
+	if status := meStatus(t, s, oldToken); status != http.StatusUnauthorized {
+		t.Errorf("Expected the old token to be rejected after the grace period, got %d", status)
+	}
+	if status := meStatus(t, s, newToken); status != http.StatusOK {
+		t.Errorf("Expected the new token to be accepted, got %d", status)
+	}
+	if keys := getJWKSet(t, s).Keys; len(keys) != 1 || keys[0].Kid != rotated.Kid {
+		t.Errorf("Expected only the active key after the grace period, got %+v", keys)
+	}
+}
+
+func TestLoadSigningKeyFromPEM(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	dir := t.TempDir()
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if err := os.WriteFile(filepath.Join(dir, "gateway-key.pem"), content, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = dir
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	token := decodeAuthResponse(t, resp).Token
+	if kid := tokenKid(t, token); kid != "gateway-key" {
+		t.Errorf("Expected the kid to be taken from the file name, got %s", kid)
+	}
+
+	// The token must verify with the provided key
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return &private.PublicKey, nil }); err != nil {
+		t.Errorf("Expected the token to be signed with the provided key: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if _, err := Start(config); err == nil || !strings.Contains(err.Error(), "broken.pem") {
+		t.Errorf("Expected an error naming the invalid key file, got %v", err)
+	}
+}
+
+func TestExpiredKeysAreRemovedOnRotation(t *testing.T) {
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = t.TempDir()
+	config.JWTKeyGracePeriod = 3 * time.Second
+
+	s := New(t, config)
+	firstKid := getJWKSet(t, s).Keys[0].Kid
+
+	if resp := postJSON(t, s, "/internal/keys/rotate", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from key rotation, got %d", resp.StatusCode)
+	}
+	time.Sleep(config.JWTKeyGracePeriod)
+	if resp := postJSON(t, s, "/internal/keys/rotate", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from key rotation, got %d", resp.StatusCode)
+	}
+
+	if _, err := os.Stat(filepath.Join(config.JWTKeyDir, firstKid+".pem")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file of the expired key to be removed, got %v", err)
+	}
+	s.Close()
+
+	s = New(t, config)
+	keys := getJWKSet(t, s).Keys
+	for _, key := range keys {
+		if key.Kid == firstKid {
+			t.Fatalf("Expected the expired key not to be published after a restart, got %+v", keys)
+		}
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected the active and the rotated out key to be published, got %d keys", len(keys))
+	}
+}
+
+func TestExpiredOperatorKeysAreKept(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"old-generated", "old-operator", "current"} {
+		writeRSAKey(t, dir, kid)
+	}
+	// Both old keys were rotated out long before the grace period
+	retiredAt := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	state := `{"active": "current", "retired": {"old-generated": "` + retiredAt + `", "old-operator": "` + retiredAt + `"}, "generated": ["old-generated"]}`
+	if err := os.WriteFile(filepath.Join(dir, "keys.json"), []byte(state), 0600); err != nil {
+		t.Fatalf("failed to write key state: %v", err)
+	}
+
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = dir
+
+	s := New(t, config)
+	if resp := postJSON(t, s, "/internal/keys/rotate", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from key rotation, got %d", resp.StatusCode)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "old-generated.pem")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file of the expired generated key to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old-operator.pem")); err != nil {
+		t.Errorf("Expected the expired key of the operator to stay on disk, got %v", err)
+	}
+	s.Close()
+
+	s = New(t, config)
+	keys := getJWKSet(t, s).Keys
+	for _, key := range keys {
+		if key.Kid == "old-operator" || key.Kid == "old-generated" {
+			t.Fatalf("Expected expired keys to stay retired after a restart, got %+v", keys)
+		}
+	}
+	if len(keys) != 2 {
+		t.Errorf("Expected the active and the rotated out key to be published, got %d keys", len(keys))
+	}
+}
+
+func TestKeyDirRequiresActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"key-a", "key-b"} {
+		writeRSAKey(t, dir, kid)
+	}
+
+	config := NewConfig()
+	config.JWTKeyMode = auth.JWTKeyModeRSA
+	config.JWTKeyDir = dir
+
+	if _, err := Start(config); err == nil || !strings.Contains(err.Error(), "keys.json") {
+		t.Fatalf("Expected an error when several keys are given without an active key, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "keys.json"), []byte(`{"active": "key-a"}`), 0600); err != nil {
+		t.Fatalf("failed to write key state: %v", err)
+	}
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	if kid := tokenKid(t, decodeAuthResponse(t, resp).Token); kid != "key-a" {
+		t.Errorf("Expected tokens to be signed with the key named in keys.json, got %s", kid)
+	}
+}
@@ -0,0 +1,1617 @@
+package testserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const oidcRedirectURI = "http://localhost:3000/callback"
+
+// newOIDCServer starts a server in OIDC mode for the given client config and registers alice
+func newOIDCServer(t *testing.T, oidcConfig auth.OIDCConfig) *Server {
+	t.Helper()
+
+	return newOIDCServerWithStore(t, oidcConfig, func(*Config) {})
+}
+
+// newOIDCServerWithStore starts an OIDC server like newOIDCServer, with the store set up by configure
+func newOIDCServerWithStore(t *testing.T, oidcConfig auth.OIDCConfig, configure func(*Config)) *Server {
+	t.Helper()
+
+	content, err := json.Marshal(oidcConfig)
+	if err != nil {
+		t.Fatalf("failed to encode OIDC config: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "oidc-config.json")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("failed to write OIDC config: %v", err)
+	}
+
+	config := NewConfig()
+	config.AuthMode = auth.AuthModeOIDC
+	config.OIDCConfigPath = path
+	configure(config)
+	s := New(t, config)
+
+	resp, err := s.Client().PostForm(s.URL+"/auth/register", url.Values{"username": {"alice"}, "password": {"password1"}})
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	resp.Body.Close()
+
+	return s
+}
+
+// authorize logs alice in at the authorization endpoint and returns the redirect location
+func authorize(t *testing.T, s *Server, query url.Values) *url.URL {
+	t.Helper()
+
+	client := s.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.PostForm(s.URL+"/auth/authorize?"+query.Encode(), url.Values{"username": {"alice"}, "password": {"password1"}})
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect from the authorization endpoint, got %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect location: %v", err)
+	}
+	return location
+}
+
+// exchangeCode posts to the token endpoint and decodes the JSON response
+func exchangeCode(t *testing.T, s *Server, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+
+	resp, err := s.Client().PostForm(s.URL+"/auth/token", form)
+	if err != nil {
+		t.Fatalf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestPKCEPublicClient(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		ClientID:     "spa",
+		RedirectURIs: []string{oidcRedirectURI},
+		Issuer:       "http://localhost:8080",
+	})
+	verifier := strings.Repeat("verifier-", 6)
+
+	query := url.Values{
+		"client_id":     {"spa"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid profile"},
+	}
+	if location := authorize(t, s, query); location.Query().Get("error") != "invalid_request" {
+		t.Errorf("Expected public clients to be required to use PKCE, got %s", location)
+	}
+
+	query.Set("code_challenge", s256(verifier))
+	query.Set("code_challenge_method", "S256")
+	code := authorize(t, s, query).Query().Get("code")
+	if code == "" {
+		t.Fatal("Expected an authorization code")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"spa"},
+		"code_verifier": {strings.Repeat("wrong-verifier-", 3)},
+	}
+	if status, body := exchangeCode(t, s, form); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Expected invalid_grant for a wrong verifier, got %d %v", status, body)
+	}
+
+	form.Set("code_verifier", verifier)
+	status, body := exchangeCode(t, s, form)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 with the right verifier, got %d %v", status, body)
+	}
+	if body["access_token"] == nil || body["id_token"] == nil {
+		t.Errorf("Expected access and ID tokens, got %v", body)
+	}
+
+	// The code is consumed by the successful exchange
+	if status, _ := exchangeCode(t, s, form); status != http.StatusBadRequest {
+		t.Errorf("Expected a reused code to be rejected, got %d", status)
+	}
+}
+
+func TestPKCEConfidentialClient(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		ClientID:     "web",
+		ClientSecret: "web-secret",
+		RedirectURIs: []string{oidcRedirectURI},
+		Issuer:       "http://localhost:8080",
+	})
+	verifier := strings.Repeat("plain-verifier-", 3)
+
+	query := url.Values{
+		"client_id":      {"web"},
+		"redirect_uri":   {oidcRedirectURI},
+		"response_type":  {"code"},
+		"scope":          {"openid"},
+		"code_challenge": {verifier},
+	}
+	code := authorize(t, s, query).Query().Get("code")
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"code_verifier": {verifier},
+	}
+	if status, _ := exchangeCode(t, s, form); status != http.StatusUnauthorized {
+		t.Errorf("Expected confidential clients to still need their secret, got %d", status)
+	}
+
+	// plain is the default method
+	form.Set("client_secret", "web-secret")
+	if status, body := exchangeCode(t, s, form); status != http.StatusOK {
+		t.Errorf("Expected status 200 for a plain challenge, got %d %v", status, body)
+	}
+
+	query.Set("code_challenge_method", "S512")
+	if location := authorize(t, s, query); location.Query().Get("error") != "invalid_request" {
+		t.Errorf("Expected an unsupported method to be rejected, got %s", location)
+	}
+
+	resp, err := s.Client().Get(s.URL + "/.well-known/openid_configuration")
+	if err != nil {
+		t.Fatalf("request to discovery failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var discovery struct {
+		Methods []string `json:"code_challenge_methods_supported"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		t.Fatalf("failed to decode discovery document: %v", err)
+	}
+	if !slices.Equal(discovery.Methods, []string{"S256", "plain"}) {
+		t.Errorf("Expected S256 and plain to be advertised, got %v", discovery.Methods)
+	}
+}
+
+func TestMultipleOIDCClients(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, AccessTokenTTL: 120},
+			{ClientID: "mobile", RedirectURIs: []string{"com.example.app:/callback"}, Scopes: []string{"openid"}},
+		},
+	})
+
+	query := url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid profile"},
+	}
+	code := authorize(t, s, query).Query().Get("code")
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	}
+	status, body := exchangeCode(t, s, form)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 for the web client, got %d %v", status, body)
+	}
+	if body["expires_in"] != float64(120) {
+		t.Errorf("Expected the access token lifetime of the client, got %v", body["expires_in"])
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body["id_token"].(string), claims); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	if claims["aud"] != "web" {
+		t.Errorf("Expected the ID token audience to be the client, got %v", claims["aud"])
+	}
+
+	// Each client only accepts its own redirect URIs and scopes
+	query.Set("client_id", "mobile")
+	resp, err := s.Client().Get(s.URL + "/auth/authorize?" + query.Encode())
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the redirect URI of another client to be rejected, got %d", resp.StatusCode)
+	}
+
+	query.Set("redirect_uri", "com.example.app:/callback")
+	query.Set("code_challenge", s256(strings.Repeat("verifier-", 6)))
+	query.Set("code_challenge_method", "S256")
+	if location := authorize(t, s, query); location.Query().Get("error") != "invalid_scope" {
+		t.Errorf("Expected a scope not allowed for the client to be rejected, got %s", location)
+	}
+
+	// A secret only authenticates its own client
+	form.Set("client_id", "mobile")
+	if status, _ := exchangeCode(t, s, form); status != http.StatusUnauthorized {
+		t.Errorf("Expected the secret of another client to be rejected, got %d", status)
+	}
+}
+
+func TestOIDCConfigRejectsDuplicateClients(t *testing.T) {
+	content := `{"issuer": "http://localhost:8080", "clients": [
+		{"client_id": "web", "redirect_uris": ["http://localhost:3000/callback"]},
+		{"client_id": "web", "redirect_uris": ["http://localhost:4000/callback"]}
+	]}`
+	path := filepath.Join(t.TempDir(), "oidc-config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write OIDC config: %v", err)
+	}
+
+	config := NewConfig()
+	config.AuthMode = auth.AuthModeOIDC
+	config.OIDCConfigPath = path
+	if _, err := Start(config); err == nil || !strings.Contains(err.Error(), "duplicate client_id web") {
+		t.Errorf("Expected an error for duplicate clients, got %v", err)
+	}
+}
+
+func TestOIDCRefreshTokenGrant(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile", "offline_access"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"authorization_code", "refresh_token"}},
+			{ClientID: "other", ClientSecret: "other-secret", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"authorization_code", "refresh_token"}},
+		},
+	})
+
+	query := url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {authorize(t, s, query).Query().Get("code")},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	}
+	if _, body := exchangeCode(t, s, form); body["refresh_token"] != nil {
+		t.Errorf("Expected no refresh token without offline_access, got %v", body)
+	}
+
+	query.Set("scope", "openid offline_access")
+	form.Set("code", authorize(t, s, query).Query().Get("code"))
+	_, body := exchangeCode(t, s, form)
+	refreshToken, _ := body["refresh_token"].(string)
+	if refreshToken == "" {
+		t.Fatalf("Expected a refresh token with offline_access, got %v", body)
+	}
+
+	// OIDC access tokens authorize API calls as the user
+	if status := meStatus(t, s, body["access_token"].(string)); status != http.StatusOK {
+		t.Errorf("Expected the access token to be accepted, got %d", status)
+	}
+
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {"other"},
+		"client_secret": {"other-secret"},
+	}
+	if status, _ := exchangeCode(t, s, refresh); status != http.StatusBadRequest {
+		t.Errorf("Expected a refresh token of another client to be rejected, got %d", status)
+	}
+
+	refresh.Set("client_id", "web")
+	refresh.Set("client_secret", "web-secret")
+	status, body := exchangeCode(t, s, refresh)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the refresh grant, got %d %v", status, body)
+	}
+	rotated, _ := body["refresh_token"].(string)
+	if rotated == "" || rotated == refreshToken || body["id_token"] == nil || body["scope"] != "openid offline_access" {
+		t.Errorf("Expected a rotated refresh token, an ID token and the original scopes, got %v", body)
+	}
+
+	// Reusing the rotated out token revokes the whole family
+	if status, _ := exchangeCode(t, s, refresh); status != http.StatusBadRequest {
+		t.Errorf("Expected a reused refresh token to be rejected, got %d", status)
+	}
+	refresh.Set("refresh_token", rotated)
+	if status, _ := exchangeCode(t, s, refresh); status != http.StatusBadRequest {
+		t.Errorf("Expected the family to be revoked after reuse, got %d", status)
+	}
+}
+
+func TestOIDCClientCredentialsGrant(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "tasks:read"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "backend", ClientSecret: "backend-secret", GrantTypes: []string{"client_credentials"}, Scopes: []string{"tasks:read"}},
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}},
+		},
+	})
+	alice, _ := s.UserStore.GetByUsername("alice")
+	s.TaskStore.Create(&domain.Task{Title: "Alice's task", UserID: alice.ID})
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	}
+	if status, body := exchangeCode(t, s, form); status != http.StatusBadRequest || body["error"] != "unauthorized_client" {
+		t.Errorf("Expected unauthorized_client for a client without the grant, got %d %v", status, body)
+	}
+
+	form.Set("client_id", "backend")
+	form.Set("client_secret", "backend-secret")
+	form.Set("scope", "openid")
+	if status, body := exchangeCode(t, s, form); status != http.StatusBadRequest || body["error"] != "invalid_scope" {
+		t.Errorf("Expected invalid_scope for a scope not allowed for the client, got %d %v", status, body)
+	}
+
+	form.Set("scope", "tasks:read")
+	status, body := exchangeCode(t, s, form)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the client credentials grant, got %d %v", status, body)
+	}
+	accessToken := body["access_token"].(string)
+	if body["refresh_token"] != nil || body["id_token"] != nil {
+		t.Errorf("Expected only an access token, got %v", body)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+	if _, hasSubject := claims["sub"]; hasSubject || claims["client_id"] != "backend" {
+		t.Errorf("Expected a token for the client without a subject, got %v", claims)
+	}
+
+	// Service clients reach the tasks of all users
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/tasks", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request to /tasks failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var tasks []domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		t.Fatalf("failed to decode tasks: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(tasks) != 1 {
+		t.Errorf("Expected the service client to see alice's task, got %d %v", resp.StatusCode, tasks)
+	}
+}
+
+func TestOIDCClientCredentialsScopes(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "tasks:read", "tasks:write"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "reader", ClientSecret: "reader-secret", GrantTypes: []string{"client_credentials"}, Scopes: []string{"tasks:read"}},
+			{ClientID: "writer", ClientSecret: "writer-secret", GrantTypes: []string{"client_credentials"}, Scopes: []string{"tasks:write"}},
+		},
+	})
+	alice, _ := s.UserStore.GetByUsername("alice")
+	s.TaskStore.Create(&domain.Task{Title: "Alice's task", UserID: alice.ID})
+
+	clientToken := func(clientID, scope string) string {
+		status, body := exchangeCode(t, s, url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {clientID + "-secret"},
+			"scope":         {scope},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("Expected status 200 from the client credentials grant, got %d %v", status, body)
+		}
+		return body["access_token"].(string)
+	}
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	// A read-only token cannot change tasks
+	readToken := clientToken("reader", "tasks:read")
+	if resp := sendRequest(t, s, http.MethodGet, "/tasks/1", bearer(readToken), ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the read scope to allow reading, got %d", resp.StatusCode)
+	}
+	writes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/tasks", `{"title": "Injected", "user_id": 1}`},
+		{http.MethodPut, "/tasks/1", `{"title": "Renamed"}`},
+		{http.MethodDelete, "/tasks/1", ""},
+		{http.MethodPost, "/tasks/batch", `{"operations": [{"method": "delete", "id": 1}]}`},
+	}
+	for _, w := range writes {
+		resp := sendRequest(t, s, w.method, w.path, bearer(readToken), w.body)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: expected status 403 with a read-only token, got %d", w.method, w.path, resp.StatusCode)
+			continue
+		}
+		if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_scope"`) {
+			t.Errorf("%s %s: expected an insufficient_scope challenge, got %q", w.method, w.path, challenge)
+		}
+	}
+	if task, _ := s.TaskStore.GetByID(1); task == nil || task.Title != "Alice's task" {
+		t.Fatalf("Expected the task to be unchanged, got %+v", task)
+	}
+
+	// A write token can change tasks, but created tasks need an existing owner
+	writeToken := clientToken("writer", "tasks:write")
+	if resp := sendRequest(t, s, http.MethodGet, "/tasks", bearer(writeToken), ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the write scope to allow reading, got %d", resp.StatusCode)
+	}
+	for _, body := range []string{`{"title": "Orphan"}`, `{"title": "Orphan", "user_id": 99}`} {
+		if resp := sendRequest(t, s, http.MethodPost, "/tasks", bearer(writeToken), body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 creating %s, got %d", body, resp.StatusCode)
+		}
+	}
+	resp := sendRequest(t, s, http.MethodPost, "/tasks/batch", bearer(writeToken), `{"operations": [{"method": "create", "body": {"title": "Orphan"}}]}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 from a batch creating a task without an owner, got %d", resp.StatusCode)
+	}
+
+	resp = sendRequest(t, s, http.MethodPost, "/tasks", bearer(writeToken), `{"title": "For alice", "user_id": `+strconv.Itoa(alice.ID)+`}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 creating a task for alice, got %d", resp.StatusCode)
+	}
+	if task := decodeTask(t, resp); task.UserID != alice.ID {
+		t.Errorf("Expected the task to belong to alice, got user %d", task.UserID)
+	}
+	if got := len(s.TaskStore.GetAll()); got != 2 {
+		t.Errorf("Expected only the task with an owner to be created, got %d tasks", got)
+	}
+}
+
+func TestOIDCIntrospectionAndRevocation(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "offline_access"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"authorization_code", "refresh_token"}},
+			{ClientID: "gateway", ClientSecret: "gateway-secret", GrantTypes: []string{"client_credentials"}},
+			{ClientID: "spa", RedirectURIs: []string{oidcRedirectURI}},
+		},
+	})
+
+	query := url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid offline_access"},
+	}
+	_, body := exchangeCode(t, s, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {authorize(t, s, query).Query().Get("code")},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	accessToken := body["access_token"].(string)
+	refreshToken := body["refresh_token"].(string)
+
+	introspect := func(token string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := s.Client().PostForm(s.URL+"/auth/introspect", url.Values{
+			"token":         {token},
+			"client_id":     {"gateway"},
+			"client_secret": {"gateway-secret"},
+		})
+		if err != nil {
+			t.Fatalf("introspection request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode introspection response: %v", err)
+		}
+		return resp.StatusCode, result
+	}
+	revoke := func(clientID, clientSecret, token string) int {
+		t.Helper()
+		resp, err := s.Client().PostForm(s.URL+"/auth/revoke", url.Values{
+			"token":         {token},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+		if err != nil {
+			t.Fatalf("revocation request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	status, result := introspect(accessToken)
+	if status != http.StatusOK || result["active"] != true || result["client_id"] != "web" || result["username"] != "alice" || result["scope"] != "openid offline_access" {
+		t.Errorf("Expected an active access token of alice, got %d %v", status, result)
+	}
+	if _, result := introspect(refreshToken); result["active"] != true || result["token_type"] != "refresh_token" {
+		t.Errorf("Expected an active refresh token, got %v", result)
+	}
+	if _, result := introspect("not-a-token"); result["active"] != false || len(result) != 1 {
+		t.Errorf("Expected only active=false for an invalid token, got %v", result)
+	}
+
+	resp, err := s.Client().PostForm(s.URL+"/auth/introspect", url.Values{"token": {accessToken}, "client_id": {"spa"}})
+	if err != nil {
+		t.Fatalf("introspection request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected public clients to be refused introspection, got %d", resp.StatusCode)
+	}
+
+	// Tokens of other clients are left alone
+	if status := revoke("gateway", "gateway-secret", accessToken); status != http.StatusOK {
+		t.Errorf("Expected status 200 from revocation, got %d", status)
+	}
+	if status := meStatus(t, s, accessToken); status != http.StatusOK {
+		t.Errorf("Expected the token of another client to stay valid, got %d", status)
+	}
+
+	if status := revoke("web", "wrong-secret", accessToken); status != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for invalid client credentials, got %d", status)
+	}
+
+	if status := revoke("web", "web-secret", accessToken); status != http.StatusOK {
+		t.Errorf("Expected status 200 from revocation, got %d", status)
+	}
+	if status := meStatus(t, s, accessToken); status != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked access token to be rejected, got %d", status)
+	}
+	if _, result := introspect(accessToken); result["active"] != false {
+		t.Errorf("Expected a revoked access token to be inactive, got %v", result)
+	}
+
+	revoke("web", "web-secret", refreshToken)
+	if _, result := introspect(refreshToken); result["active"] != false {
+		t.Errorf("Expected a revoked refresh token to be inactive, got %v", result)
+	}
+	status, _ = exchangeCode(t, s, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected a revoked refresh token to be rejected, got %d", status)
+	}
+
+	resp, err = s.Client().Get(s.URL + "/.well-known/openid_configuration")
+	if err != nil {
+		t.Fatalf("request to discovery failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var discovery map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		t.Fatalf("failed to decode discovery document: %v", err)
+	}
+	if discovery["introspection_endpoint"] != "http://localhost:8080/auth/introspect" || discovery["revocation_endpoint"] != "http://localhost:8080/auth/revoke" {
+		t.Errorf("Expected both endpoints in the discovery document, got %v", discovery)
+	}
+}
+
+func TestOIDCClientAuthentication(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwk := auth.JWK{
+		Kty: "EC",
+		Use: "sig",
+		Crv: "P-256",
+		Kid: "signer-key",
+		X:   base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, 32))),
+	}
+
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Clients: []*auth.OIDCClient{
+			{ClientID: "backend", ClientSecret: "secret:with+special&chars", GrantTypes: []string{"client_credentials"}},
+			{ClientID: "signer", JWKS: &auth.JWKSet{Keys: []auth.JWK{jwk}}, GrantTypes: []string{"client_credentials"}},
+		},
+	})
+
+	// tokenRequest posts a client credentials grant, with HTTP Basic credentials if username is set
+	tokenRequest := func(form url.Values, username, password string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+
+		form.Set("grant_type", "client_credentials")
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/auth/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if username != "" {
+			req.SetBasicAuth(url.QueryEscape(username), url.QueryEscape(password))
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatalf("token request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode token response: %v", err)
+		}
+		return resp, body
+	}
+
+	if resp, body := tokenRequest(url.Values{}, "backend", "secret:with+special&chars"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 with Basic credentials, got %d %v", resp.StatusCode, body)
+	}
+
+	resp, body := tokenRequest(url.Values{}, "backend", "wrong")
+	if resp.StatusCode != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Errorf("Expected invalid_client for a wrong secret, got %d %v", resp.StatusCode, body)
+	}
+	if challenge := resp.Header.Get("WWW-Authenticate"); !strings.HasPrefix(challenge, "Basic ") {
+		t.Errorf("Expected a Basic WWW-Authenticate challenge, got %q", challenge)
+	}
+
+	form := url.Values{"client_secret": {"secret:with+special&chars"}}
+	if resp, body := tokenRequest(form, "backend", "secret:with+special&chars"); resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_request" {
+		t.Errorf("Expected invalid_request for two authentication methods, got %d %v", resp.StatusCode, body)
+	}
+
+	// A client with registered keys authenticates with a signed assertion
+	if resp, body := tokenRequest(url.Values{"client_id": {"signer"}}, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without credentials, got %d %v", resp.StatusCode, body)
+	}
+
+	sign := func(key *ecdsa.PrivateKey, jti string) string {
+		t.Helper()
+
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"iss": "signer",
+			"sub": "signer",
+			"aud": "http://localhost:8080/auth/token",
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"jti": jti,
+		})
+		token.Header["kid"] = "signer-key"
+		assertion, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign client assertion: %v", err)
+		}
+		return assertion
+	}
+	assertionForm := func(assertion string) url.Values {
+		return url.Values{
+			"client_assertion_type": {auth.ClientAssertionTypeJWTBearer},
+			"client_assertion":      {assertion},
+		}
+	}
+
+	assertion := sign(private, "assertion-1")
+	resp, body = tokenRequest(assertionForm(assertion), "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 with a client assertion, got %d %v", resp.StatusCode, body)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body["access_token"].(string), claims); err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+	if claims["client_id"] != "signer" {
+		t.Errorf("Expected a token for the signer client, got %v", claims)
+	}
+
+	if resp, body := tokenRequest(assertionForm(assertion), "", ""); resp.StatusCode != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Errorf("Expected a replayed assertion to be rejected, got %d %v", resp.StatusCode, body)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if resp, body := tokenRequest(assertionForm(sign(other, "assertion-2")), "", ""); resp.StatusCode != http.StatusUnauthorized || body["error"] != "invalid_client" {
+		t.Errorf("Expected an assertion signed with an unregistered key to be rejected, got %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestOIDCLoginSessionAndLogout(t *testing.T) {
+	const postLogoutURI = "http://localhost:3000/logged-out"
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Clients: []*auth.OIDCClient{
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, PostLogoutRedirectURIs: []string{postLogoutURI}},
+		},
+	})
+
+	// A browser keeps the session cookie of the provider
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	browser := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	get := func(path string, query url.Values) *http.Response {
+		t.Helper()
+
+		resp, err := browser.Get(s.URL + path + "?" + query.Encode())
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	query := url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"prompt":        {"none"},
+	}
+	if location, _ := get("/auth/authorize", query).Location(); location == nil || location.Query().Get("error") != "login_required" {
+		t.Errorf("Expected login_required without a session, got %v", location)
+	}
+
+	query.Del("prompt")
+	resp, err := browser.PostForm(s.URL+"/auth/authorize?"+query.Encode(), url.Values{"username": {"alice"}, "password": {"password1"}})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect after login, got %d", resp.StatusCode)
+	}
+
+	// The session skips the login form, unless the client asks for a fresh login
+	resp = get("/auth/authorize", query)
+	location, _ := resp.Location()
+	if resp.StatusCode != http.StatusFound || location.Query().Get("code") == "" {
+		t.Fatalf("Expected a code without the login form, got %d %v", resp.StatusCode, location)
+	}
+	code := location.Query().Get("code")
+
+	query.Set("prompt", "login")
+	if resp := get("/auth/authorize", query); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the login form for prompt=login, got %d", resp.StatusCode)
+	}
+	query.Del("prompt")
+	query.Set("max_age", "0")
+	if resp := get("/auth/authorize", query); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the login form for an expired max_age, got %d", resp.StatusCode)
+	}
+	query.Del("max_age")
+
+	status, body := exchangeCode(t, s, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the token endpoint, got %d %v", status, body)
+	}
+	idToken := body["id_token"].(string)
+
+	logout := url.Values{
+		"id_token_hint":            {idToken},
+		"post_logout_redirect_uri": {"http://localhost:3000/elsewhere"},
+	}
+	if resp := get("/auth/logout", logout); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unregistered post_logout_redirect_uri, got %d", resp.StatusCode)
+	}
+
+	logout.Set("post_logout_redirect_uri", postLogoutURI)
+	logout.Set("state", "logout-state")
+	resp = get("/auth/logout", logout)
+	location, _ = resp.Location()
+	if resp.StatusCode != http.StatusFound || location == nil || location.Query().Get("state") != "logout-state" {
+		t.Fatalf("Expected a redirect to the post_logout_redirect_uri, got %d %v", resp.StatusCode, location)
+	}
+
+	query.Set("prompt", "none")
+	if location, _ := get("/auth/authorize", query).Location(); location == nil || location.Query().Get("error") != "login_required" {
+		t.Errorf("Expected login_required after logout, got %v", location)
+	}
+}
+
+func TestOIDCIDTokenClaims(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile", "email", "phone", "address", "offline_access"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"authorization_code", "refresh_token"}},
+		},
+	})
+	alice, _ := s.UserStore.GetByUsername("alice")
+	alice.Profile = domain.Profile{
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		PhoneNumber:   "+81 90-0000-0000",
+		Address:       &domain.Address{Locality: "Tokyo", Country: "JP"},
+	}
+	s.UserStore.Update(alice.ID, alice)
+
+	code := authorize(t, s, url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid email phone offline_access"},
+		"nonce":         {"nonce-123"},
+	}).Query().Get("code")
+
+	status, body := exchangeCode(t, s, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the token endpoint, got %d %v", status, body)
+	}
+	accessToken := body["access_token"].(string)
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body["id_token"].(string), claims); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	atHash := base64.RawURLEncoding.EncodeToString(sum[:16])
+	if claims["nonce"] != "nonce-123" || claims["azp"] != "web" || claims["acr"] == nil || claims["at_hash"] != atHash {
+		t.Errorf("Expected nonce, azp, acr and at_hash claims, got %v", claims)
+	}
+	authTime, ok := claims["auth_time"].(float64)
+	if !ok || time.Since(time.Unix(int64(authTime), 0)) > time.Minute {
+		t.Errorf("Expected a recent auth_time, got %v", claims["auth_time"])
+	}
+	if claims["email"] != "alice@example.com" || claims["email_verified"] != true || claims["phone_number"] != "+81 90-0000-0000" {
+		t.Errorf("Expected the email and phone claims, got %v", claims)
+	}
+	if _, hasAddress := claims["address"]; hasAddress {
+		t.Errorf("Expected no address without the address scope, got %v", claims["address"])
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/auth/userinfo", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request to userinfo failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var userInfo map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
+		t.Fatalf("failed to decode userinfo: %v", err)
+	}
+	if userInfo["email"] != "alice@example.com" || userInfo["phone_number"] != "+81 90-0000-0000" || userInfo["name"] != nil {
+		t.Errorf("Expected the claims of the granted scopes from userinfo, got %v", userInfo)
+	}
+
+	// Refreshed ID tokens keep the time of the original login but not the nonce
+	status, body = exchangeCode(t, s, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {body["refresh_token"].(string)},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the refresh, got %d %v", status, body)
+	}
+	refreshed := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body["id_token"].(string), refreshed); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	if refreshed["auth_time"] != claims["auth_time"] || refreshed["nonce"] != nil {
+		t.Errorf("Expected the original auth_time without a nonce, got %v", refreshed)
+	}
+}
+
+func TestOIDCImplicitAndHybridFlows(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Clients: []*auth.OIDCClient{
+			{ClientID: "legacy", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"implicit"}},
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}, GrantTypes: []string{"authorization_code", "implicit"}},
+		},
+	})
+	fragment := func(location *url.URL) url.Values {
+		t.Helper()
+
+		values, err := url.ParseQuery(location.Fragment)
+		if err != nil {
+			t.Fatalf("invalid fragment %q: %v", location.Fragment, err)
+		}
+		return values
+	}
+
+	query := url.Values{
+		"client_id":     {"legacy"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"token id_token"},
+		"scope":         {"openid profile"},
+		"state":         {"state-1"},
+	}
+	if params := fragment(authorize(t, s, query)); params.Get("error") != "invalid_request" || params.Get("state") != "state-1" {
+		t.Errorf("Expected invalid_request in the fragment without a nonce, got %v", params)
+	}
+
+	query.Set("response_mode", "query")
+	query.Set("nonce", "nonce-1")
+	if params := fragment(authorize(t, s, query)); params.Get("error") != "invalid_request" {
+		t.Errorf("Expected tokens to be refused in the query, got %v", params)
+	}
+
+	query.Del("response_mode")
+	params := fragment(authorize(t, s, query))
+	accessToken, idToken := params.Get("access_token"), params.Get("id_token")
+	if accessToken == "" || idToken == "" || params.Get("token_type") != "Bearer" || params.Get("state") != "state-1" {
+		t.Fatalf("Expected an access token and ID token in the fragment, got %v", params)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	if claims["nonce"] != "nonce-1" || claims["at_hash"] != base64.RawURLEncoding.EncodeToString(sum[:16]) {
+		t.Errorf("Expected the nonce and at_hash claims, got %v", claims)
+	}
+
+	query.Set("response_type", "code")
+	if location := authorize(t, s, query); location.Query().Get("error") != "unauthorized_client" {
+		t.Errorf("Expected unauthorized_client for the code flow of an implicit client, got %v", location)
+	}
+	query.Set("response_type", "token")
+	if location := authorize(t, s, query); location.Query().Get("error") != "unsupported_response_type" {
+		t.Errorf("Expected unsupported_response_type for token alone, got %v", location)
+	}
+
+	// The hybrid flow posts the code and ID token back with form_post
+	query = url.Values{
+		"client_id":     {"web"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code id_token"},
+		"response_mode": {"form_post"},
+		"scope":         {"openid"},
+		"nonce":         {"nonce-2"},
+	}
+	resp, err := s.Client().PostForm(s.URL+"/auth/authorize?"+query.Encode(), url.Values{"username": {"alice"}, "password": {"password1"}})
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read form_post page: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `action="`+oidcRedirectURI+`"`) {
+		t.Fatalf("Expected a form posting to the redirect URI, got %d %s", resp.StatusCode, page)
+	}
+	field := func(name string) string {
+		match := regexp.MustCompile(`name="` + name + `" value="([^"]*)"`).FindStringSubmatch(string(page))
+		if match == nil {
+			t.Fatalf("Expected a %s field in the form_post page", name)
+		}
+		return html.UnescapeString(match[1])
+	}
+	code := field("code")
+
+	claims = jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(field("id_token"), claims); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	sum = sha256.Sum256([]byte(code))
+	if claims["c_hash"] != base64.RawURLEncoding.EncodeToString(sum[:16]) || claims["nonce"] != "nonce-2" {
+		t.Errorf("Expected the c_hash and nonce claims, got %v", claims)
+	}
+
+	status, body := exchangeCode(t, s, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oidcRedirectURI},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+	})
+	if status != http.StatusOK || body["access_token"] == nil {
+		t.Errorf("Expected the hybrid code to be exchangeable, got %d %v", status, body)
+	}
+}
+
+func TestOIDCDeviceAuthorizationGrant(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile", "offline_access"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "tv", GrantTypes: []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"}},
+			{ClientID: "short", GrantTypes: []string{"urn:ietf:params:oauth:grant-type:device_code"}, DeviceCodeTTL: 1},
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}},
+		},
+	})
+
+	startDevice := func(form url.Values) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := s.Client().PostForm(s.URL+"/auth/device_authorization", form)
+		if err != nil {
+			t.Fatalf("device authorization request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode device authorization response: %v", err)
+		}
+		return resp.StatusCode, body
+	}
+
+	if status, body := startDevice(url.Values{"client_id": {"web"}, "client_secret": {"web-secret"}}); status != http.StatusBadRequest || body["error"] != "unauthorized_client" {
+		t.Errorf("Expected unauthorized_client for a client without the device grant, got %d %v", status, body)
+	}
+
+	status, body := startDevice(url.Values{"client_id": {"tv"}, "scope": {"openid offline_access"}})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200 from the device authorization endpoint, got %d %v", status, body)
+	}
+	deviceCode, _ := body["device_code"].(string)
+	userCode, _ := body["user_code"].(string)
+	if deviceCode == "" || !regexp.MustCompile(`^[A-Z]{4}-[A-Z]{4}$`).MatchString(userCode) {
+		t.Fatalf("Expected a device code and a XXXX-XXXX user code, got %v", body)
+	}
+	if body["verification_uri"] != "http://localhost:8080/auth/device" || body["verification_uri_complete"] != "http://localhost:8080/auth/device?user_code="+userCode {
+		t.Errorf("Unexpected verification URIs: %v", body)
+	}
+	if body["expires_in"] != float64(600) || body["interval"] != float64(5) {
+		t.Errorf("Expected expires_in 600 and interval 5, got %v", body)
+	}
+
+	poll := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceCode},
+		"client_id":   {"tv"},
+	}
+	if status, body := exchangeCode(t, s, poll); status != http.StatusBadRequest || body["error"] != "authorization_pending" {
+		t.Errorf("Expected authorization_pending before approval, got %d %v", status, body)
+	}
+	if _, body := exchangeCode(t, s, poll); body["error"] != "slow_down" {
+		t.Errorf("Expected slow_down when polling again at once, got %v", body)
+	}
+
+	// The user enters the code at the verification page and logs in
+	resp, err := s.Client().Get(s.URL + "/auth/device?user_code=INVALID")
+	if err != nil {
+		t.Fatalf("verification request failed: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "Invalid or expired code") {
+		t.Errorf("Expected an error for an unknown user code, got %s", page)
+	}
+
+	// User codes are case insensitive and the dash is optional
+	verificationURL := s.URL + "/auth/device?user_code=" + strings.ToLower(strings.ReplaceAll(userCode, "-", ""))
+	resp, err = s.Client().Get(verificationURL)
+	if err != nil {
+		t.Fatalf("verification request failed: %v", err)
+	}
+	page, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), `name="password"`) {
+		t.Fatalf("Expected the login form for a valid user code, got %s", page)
+	}
+
+	resp, err = s.Client().PostForm(verificationURL, url.Values{"username": {"alice"}, "password": {"password1"}})
+	if err != nil {
+		t.Fatalf("device login failed: %v", err)
+	}
+	page, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "Your device has been connected") {
+		t.Fatalf("Expected the device to be approved, got %s", page)
+	}
+
+	status, body = exchangeCode(t, s, poll)
+	if status != http.StatusOK || body["access_token"] == nil || body["id_token"] == nil || body["refresh_token"] == nil {
+		t.Fatalf("Expected tokens once the device is approved, got %d %v", status, body)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(body["id_token"].(string), claims); err != nil {
+		t.Fatalf("failed to parse ID token: %v", err)
+	}
+	alice, _ := s.UserStore.GetByUsername("alice")
+	if claims["sub"] != strconv.Itoa(alice.ID) || claims["azp"] != "tv" {
+		t.Errorf("Expected the ID token to be issued to tv for alice, got %v", claims)
+	}
+
+	if _, body := exchangeCode(t, s, poll); body["error"] != "invalid_grant" {
+		t.Errorf("Expected a used device code to be rejected, got %v", body)
+	}
+
+	// Device codes expire after the lifetime of the client
+	_, body = startDevice(url.Values{"client_id": {"short"}})
+	poll.Set("client_id", "short")
+	poll.Set("device_code", body["device_code"].(string))
+	time.Sleep(1100 * time.Millisecond)
+	if _, body := exchangeCode(t, s, poll); body["error"] != "expired_token" {
+		t.Errorf("Expected expired_token after the device code expired, got %v", body)
+	}
+}
+
+var csrfTokenPattern = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+
+// csrfToken returns the CSRF token embedded in a consent page
+func csrfToken(t *testing.T, page string) string {
+	t.Helper()
+
+	match := csrfTokenPattern.FindStringSubmatch(page)
+	if match == nil {
+		t.Fatalf("Expected a CSRF token on the consent page, got %s", page)
+	}
+	return match[1]
+}
+
+func TestOIDCConsent(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile", "email"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "third-party", ClientSecret: "secret", RedirectURIs: []string{oidcRedirectURI}, RequireConsent: true},
+			{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}},
+		},
+	})
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	browser := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	send := func(query, form url.Values) (*http.Response, string) {
+		t.Helper()
+
+		var resp *http.Response
+		var err error
+		if form == nil {
+			resp, err = browser.Get(s.URL + "/auth/authorize?" + query.Encode())
+		} else {
+			resp, err = browser.PostForm(s.URL+"/auth/authorize?"+query.Encode(), form)
+		}
+		if err != nil {
+			t.Fatalf("authorization request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		page, _ := io.ReadAll(resp.Body)
+		return resp, string(page)
+	}
+	scopesOf := func(resp *http.Response, clientID, clientSecret string) string {
+		t.Helper()
+
+		location, err := resp.Location()
+		if err != nil {
+			t.Fatalf("Expected a redirect, got %d", resp.StatusCode)
+		}
+		_, body := exchangeCode(t, s, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {location.Query().Get("code")},
+			"redirect_uri":  {oidcRedirectURI},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+		scope, _ := body["scope"].(string)
+		return scope
+	}
+
+	query := url.Values{
+		"client_id":     {"third-party"},
+		"redirect_uri":  {oidcRedirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid profile email"},
+		"state":         {"xyz"},
+	}
+	resp, page := send(query, url.Values{"username": {"alice"}, "password": {"password1"}})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(page, `name="consent"`) {
+		t.Fatalf("Expected the consent page after login, got %d %s", resp.StatusCode, page)
+	}
+	token := csrfToken(t, page)
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "oidc_session" && cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("Expected the session cookie to be SameSite=Lax, got %v", cookie.SameSite)
+		}
+	}
+
+	// A consent form posted without the token of the session, as by another site, is rejected
+	for _, form := range []url.Values{
+		{"consent": {"approve"}},
+		{"consent": {"approve"}, "csrf_token": {strings.Repeat("0", len(token))}},
+	} {
+		if resp, _ := send(query, form); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status 403 for a consent form with an invalid CSRF token, got %d", resp.StatusCode)
+		}
+	}
+
+	resp, _ = send(query, url.Values{"consent": {"deny"}, "csrf_token": {token}})
+	if location, _ := resp.Location(); location == nil || location.Query().Get("error") != "access_denied" || location.Query().Get("state") != "xyz" {
+		t.Errorf("Expected access_denied with the state after denial, got %v", location)
+	}
+
+	// Deselected scopes are not granted, and openid cannot be deselected
+	resp, _ = send(query, url.Values{"consent": {"approve"}, "csrf_token": {token}, "granted_scopes": {"profile"}})
+	if scope := scopesOf(resp, "third-party", "secret"); scope != "openid profile" {
+		t.Errorf("Expected the partially approved scopes, got %q", scope)
+	}
+
+	// Granted scopes skip the consent page, further scopes need consent again
+	query.Set("scope", "openid profile")
+	resp, _ = send(query, nil)
+	if scope := scopesOf(resp, "third-party", "secret"); scope != "openid profile" {
+		t.Errorf("Expected a code without consent for granted scopes, got %q", scope)
+	}
+	query.Set("scope", "openid email")
+	if resp, page := send(query, nil); resp.StatusCode != http.StatusOK || !strings.Contains(page, `value="email"`) {
+		t.Errorf("Expected the consent page for a new scope, got %d", resp.StatusCode)
+	}
+	query.Set("prompt", "none")
+	if resp, _ := send(query, nil); resp.Header.Get("Location") == "" || !strings.Contains(resp.Header.Get("Location"), "error=consent_required") {
+		t.Errorf("Expected consent_required with prompt=none, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// prompt=consent asks again even for granted scopes and clients without required consent
+	query.Set("scope", "openid profile")
+	query.Set("prompt", "consent")
+	if resp, page := send(query, nil); resp.StatusCode != http.StatusOK || !strings.Contains(page, `name="consent"`) {
+		t.Errorf("Expected the consent page with prompt=consent, got %d", resp.StatusCode)
+	}
+	query.Set("client_id", "web")
+	query.Del("prompt")
+	resp, _ = send(query, nil)
+	if scope := scopesOf(resp, "web", "web-secret"); scope != "openid profile" {
+		t.Errorf("Expected no consent page for a client without required consent, got %q", scope)
+	}
+	query.Set("prompt", "consent")
+	resp, _ = send(query, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the consent page with prompt=consent, got %d", resp.StatusCode)
+	}
+	resp, _ = send(query, url.Values{"consent": {"approve"}, "csrf_token": {token}})
+	if scope := scopesOf(resp, "web", "web-secret"); scope != "openid" {
+		t.Errorf("Expected only openid when every optional scope is deselected, got %q", scope)
+	}
+}
+
+func TestOIDCDeviceConsent(t *testing.T) {
+	s := newOIDCServer(t, auth.OIDCConfig{
+		Issuer: "http://localhost:8080",
+		Scopes: []string{"openid", "profile", "email"},
+		Clients: []*auth.OIDCClient{
+			{ClientID: "tv", GrantTypes: []string{"urn:ietf:params:oauth:grant-type:device_code"}, RequireConsent: true},
+		},
+	})
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	browser := &http.Client{Jar: jar}
+
+	// startDevice lets alice log in for a new device code and returns the code and the page shown after login
+	startDevice := func(scope string) (url.Values, string, string) {
+		t.Helper()
+
+		resp, err := s.Client().PostForm(s.URL+"/auth/device_authorization", url.Values{"client_id": {"tv"}, "scope": {scope}})
+		if err != nil {
+			t.Fatalf("device authorization request failed: %v", err)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode device authorization response: %v", err)
+		}
+		resp.Body.Close()
+
+		verificationURL := body["verification_uri_complete"].(string)
+		verificationURL = s.URL + strings.TrimPrefix(verificationURL, "http://localhost:8080")
+		resp, err = browser.PostForm(verificationURL, url.Values{"username": {"alice"}, "password": {"password1"}})
+		if err != nil {
+			t.Fatalf("device login failed: %v", err)
+		}
+		page, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		poll := url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {body["device_code"].(string)},
+			"client_id":   {"tv"},
+		}
+		return poll, verificationURL, string(page)
+	}
+	submit := func(verificationURL string, form url.Values) string {
+		t.Helper()
+
+		resp, err := browser.PostForm(verificationURL, form)
+		if err != nil {
+			t.Fatalf("consent request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		page, _ := io.ReadAll(resp.Body)
+		return string(page)
+	}
+
+	poll, verificationURL, page := startDevice("openid profile email")
+	if !strings.Contains(page, `name="consent"`) {
+		t.Fatalf("Expected the consent page after the device login, got %s", page)
+	}
+	token := csrfToken(t, page)
+	if page := submit(verificationURL, url.Values{"consent": {"approve"}}); strings.Contains(page, "Your device has been connected") {
+		t.Error("Expected the device consent to require the CSRF token")
+	}
+
+	submit(verificationURL, url.Values{"consent": {"deny"}, "csrf_token": {token}})
+	if _, body := exchangeCode(t, s, poll); body["error"] != "access_denied" {
+		t.Errorf("Expected access_denied after the user denied the device, got %v", body)
+	}
+
+	poll, verificationURL, page = startDevice("openid profile email")
+	token = csrfToken(t, page)
+	page = submit(verificationURL, url.Values{"consent": {"approve"}, "csrf_token": {token}, "granted_scopes": {"profile"}})
+	if !strings.Contains(page, "Your device has been connected") {
+		t.Fatalf("Expected the device to be approved, got %s", page)
+	}
+	if status, body := exchangeCode(t, s, poll); status != http.StatusOK || body["scope"] != "openid profile" {
+		t.Errorf("Expected tokens with the granted scopes, got %d %v", status, body)
+	}
+
+	// Granted scopes skip the consent page
+	_, _, page = startDevice("openid profile")
+	if strings.Contains(page, `name="consent"`) {
+		t.Error("Expected no consent page after the scopes were granted")
+	}
+}
+
+func TestOIDCDynamicClientRegistration(t *testing.T) {
+	for _, backend := range []string{"file", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			content, err := json.Marshal(auth.OIDCConfig{
+				Issuer:  "http://localhost:8080",
+				Scopes:  []string{"openid", "profile"},
+				Clients: []*auth.OIDCClient{{ClientID: "web", ClientSecret: "web-secret", RedirectURIs: []string{oidcRedirectURI}}},
+			})
+			if err != nil {
+				t.Fatalf("failed to encode OIDC config: %v", err)
+			}
+			dir := t.TempDir()
+			config := NewConfig()
+			config.AuthMode = auth.AuthModeOIDC
+			config.OIDCConfigPath = filepath.Join(dir, "oidc-config.json")
+			if err := os.WriteFile(config.OIDCConfigPath, content, 0600); err != nil {
+				t.Fatalf("failed to write OIDC config: %v", err)
+			}
+			if backend == "file" {
+				config.JsonFilePath = filepath.Join(dir, "data.json")
+			} else {
+				config.SQLitePath = filepath.Join(dir, "data.db")
+			}
+
+			s := New(t, config)
+			resp, err := s.Client().PostForm(s.URL+"/auth/register", url.Values{"username": {"alice"}, "password": {"password1"}})
+			if err != nil {
+				t.Fatalf("registration failed: %v", err)
+			}
+			resp.Body.Close()
+
+			send := func(method, path, token string, body interface{}) (int, map[string]interface{}) {
+				t.Helper()
+
+				var reader io.Reader
+				if body != nil {
+					encoded, _ := json.Marshal(body)
+					reader = strings.NewReader(string(encoded))
+				}
+				req, _ := http.NewRequest(method, s.URL+path, reader)
+				req.Header.Set("Content-Type", "application/json")
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				resp, err := s.Client().Do(req)
+				if err != nil {
+					t.Fatalf("%s %s failed: %v", method, path, err)
+				}
+				defer resp.Body.Close()
+
+				var decoded map[string]interface{}
+				json.NewDecoder(resp.Body).Decode(&decoded)
+				return resp.StatusCode, decoded
+			}
+			exchangeWithBasic := func(clientID, clientSecret, code string) int {
+				t.Helper()
+
+				req, _ := http.NewRequest(http.MethodPost, s.URL+"/auth/token", strings.NewReader(url.Values{
+					"grant_type":   {"authorization_code"},
+					"code":         {code},
+					"redirect_uri": {oidcRedirectURI},
+				}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.SetBasicAuth(clientID, clientSecret)
+				resp, err := s.Client().Do(req)
+				if err != nil {
+					t.Fatalf("token request failed: %v", err)
+				}
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+
+			if status, body := send(http.MethodPost, "/auth/clients", "", map[string]interface{}{"redirect_uris": []string{"http://localhost:3000/cb#fragment"}}); status != http.StatusBadRequest || body["error"] != "invalid_redirect_uri" {
+				t.Errorf("Expected invalid_redirect_uri for a redirect URI with a fragment, got %d %v", status, body)
+			}
+			if status, body := send(http.MethodPost, "/auth/clients", "", map[string]interface{}{"redirect_uris": []string{oidcRedirectURI}, "response_types": []string{"id_token"}}); status != http.StatusBadRequest || body["error"] != "invalid_client_metadata" {
+				t.Errorf("Expected invalid_client_metadata for a response type without its grant type, got %d %v", status, body)
+			}
+			if status, body := send(http.MethodPost, "/auth/clients", "", map[string]interface{}{"grant_types": []string{"client_credentials"}}); status != http.StatusBadRequest || body["error"] != "invalid_client_metadata" {
+				t.Errorf("Expected invalid_client_metadata for the client_credentials grant, got %d %v", status, body)
+			}
+
+			status, registered := send(http.MethodPost, "/auth/clients", "", map[string]interface{}{
+				"redirect_uris": []string{oidcRedirectURI},
+				"client_name":   "Integration Test",
+				"scope":         "openid",
+			})
+			if status != http.StatusCreated {
+				t.Fatalf("Expected status 201 from the registration endpoint, got %d %v", status, registered)
+			}
+			clientID, _ := registered["client_id"].(string)
+			clientSecret, _ := registered["client_secret"].(string)
+			registrationToken, _ := registered["registration_access_token"].(string)
+			if clientID == "" || clientSecret == "" || registrationToken == "" || registered["client_secret_expires_at"] != float64(0) {
+				t.Fatalf("Expected a client ID, secret and registration access token, got %v", registered)
+			}
+			if registered["registration_client_uri"] != "http://localhost:8080/auth/clients/"+clientID || registered["token_endpoint_auth_method"] != "client_secret_basic" ||
+				registered["client_name"] != "Integration Test" || !slices.Equal(registered["grant_types"].([]interface{}), []interface{}{"authorization_code"}) {
+				t.Errorf("Expected the registered metadata with its defaults, got %v", registered)
+			}
+
+			query := url.Values{
+				"client_id":     {clientID},
+				"redirect_uri":  {oidcRedirectURI},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			}
+			if status := exchangeWithBasic(clientID, clientSecret, authorize(t, s, query).Query().Get("code")); status != http.StatusOK {
+				t.Errorf("Expected the registered client to get tokens, got %d", status)
+			}
+			// The client registered client_secret_basic and may not use another method
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {authorize(t, s, query).Query().Get("code")},
+				"redirect_uri":  {oidcRedirectURI},
+				"client_id":     {clientID},
+				"client_secret": {clientSecret},
+			}
+			if status, body := exchangeCode(t, s, form); status != http.StatusUnauthorized {
+				t.Errorf("Expected client_secret_post to be rejected, got %d %v", status, body)
+			}
+
+			path := "/auth/clients/" + clientID
+			if status, _ := send(http.MethodGet, path, "wrong-token", nil); status != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 with a wrong registration access token, got %d", status)
+			}
+			status, read := send(http.MethodGet, path, registrationToken, nil)
+			if status != http.StatusOK || read["client_secret"] != clientSecret || read["registration_access_token"] != nil {
+				t.Errorf("Expected the registration without its access token, got %d %v", status, read)
+			}
+
+			// Registered clients survive a restart of the server
+			s.Close()
+			s = New(t, config)
+			if status := exchangeWithBasic(clientID, clientSecret, authorize(t, s, query).Query().Get("code")); status != http.StatusOK {
+				t.Errorf("Expected the registered client to work after a restart, got %d", status)
+			}
+
+			const newRedirectURI = "http://localhost:3000/new-callback"
+			if status, body := send(http.MethodPut, path, registrationToken, map[string]interface{}{"client_id": "other", "redirect_uris": []string{newRedirectURI}}); status != http.StatusBadRequest {
+				t.Errorf("Expected the client ID to be immutable, got %d %v", status, body)
+			}
+			if status, body := send(http.MethodPut, path, registrationToken, map[string]interface{}{"client_id": clientID, "grant_types": []string{"authorization_code", "client_credentials"}}); status != http.StatusBadRequest || body["error"] != "invalid_client_metadata" {
+				t.Errorf("Expected an update to the client_credentials grant to be rejected, got %d %v", status, body)
+			}
+			status, updated := send(http.MethodPut, path, registrationToken, map[string]interface{}{
+				"client_id":                  clientID,
+				"redirect_uris":              []string{newRedirectURI},
+				"token_endpoint_auth_method": "none",
+			})
+			if status != http.StatusOK || updated["client_id"] != clientID || updated["client_secret"] != nil || updated["scope"] != "openid profile" {
+				t.Errorf("Expected a public client with the provider scopes after the update, got %d %v", status, updated)
+			}
+
+			resp, err = s.Client().Get(s.URL + "/auth/authorize?" + query.Encode())
+			if err != nil {
+				t.Fatalf("authorization request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected the replaced redirect URI to be rejected, got %d", resp.StatusCode)
+			}
+
+			if status, _ := send(http.MethodDelete, path, registrationToken, nil); status != http.StatusNoContent {
+				t.Errorf("Expected status 204 from delete, got %d", status)
+			}
+			if status, _ := send(http.MethodGet, path, registrationToken, nil); status != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 for a deleted client, got %d", status)
+			}
+			query.Set("redirect_uri", newRedirectURI)
+			resp, err = s.Client().Get(s.URL + "/auth/authorize?" + query.Encode())
+			if err != nil {
+				t.Fatalf("authorization request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected the deleted client to be unknown, got %d", resp.StatusCode)
+			}
+
+			resp, err = s.Client().Get(s.URL + "/.well-known/openid_configuration")
+			if err != nil {
+				t.Fatalf("discovery request failed: %v", err)
+			}
+			var discovery map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&discovery)
+			resp.Body.Close()
+			if discovery["registration_endpoint"] != "http://localhost:8080/auth/clients" {
+				t.Errorf("Expected registration_endpoint in the discovery document, got %v", discovery["registration_endpoint"])
+			}
+		})
+	}
+}
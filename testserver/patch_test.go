@@ -0,0 +1,121 @@
+package testserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func patchTask(t *testing.T, s *Server, path, contentType, body string) *http.Response {
+	t.Helper()
+
+	return sendRequest(t, s, http.MethodPatch, path, http.Header{"Content-Type": {contentType}}, body)
+}
+
+func TestPatchTaskMergePatch(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	sendRequest(t, s, http.MethodPost, "/tasks", nil,
+		`{"title": "Write tests", "description": "Cover patch", "due_date": "2025-03-01", "tags": ["work"]}`)
+
+	resp := patchTask(t, s, "/tasks/1", "application/merge-patch+json",
+		`{"completed": true, "due_date": null, "user_id": 42}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from merge patch, got %d", resp.StatusCode)
+	}
+
+	task := decodeTask(t, resp)
+	if !task.Completed || task.DueDate != nil {
+		t.Errorf("Expected completed to be set and the due date removed, got %+v", task)
+	}
+	if task.Title != "Write tests" || task.Description != "Cover patch" || len(task.Tags) != 1 {
+		t.Errorf("Expected fields missing from the patch to be kept, got %+v", task)
+	}
+	if task.UserID != 0 {
+		t.Errorf("Expected user_id not to be patchable, got %d", task.UserID)
+	}
+	if task.Version != 2 {
+		t.Errorf("Expected the version to be incremented, got %d", task.Version)
+	}
+}
+
+func TestPatchTaskJSONPatch(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	sendRequest(t, s, http.MethodPost, "/tasks", nil, `{"title": "Write tests", "tags": ["work"]}`)
+
+	resp := patchTask(t, s, "/tasks/1", "application/json-patch+json", `[
+		{"op": "test", "path": "/title", "value": "Write tests"},
+		{"op": "replace", "path": "/priority", "value": "high"},
+		{"op": "add", "path": "/tags/-", "value": "urgent"},
+		{"op": "copy", "from": "/title", "path": "/description"}
+	]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from JSON patch, got %d", resp.StatusCode)
+	}
+
+	task := decodeTask(t, resp)
+	if task.Priority != "high" || task.Description != "Write tests" {
+		t.Errorf("Expected the operations to be applied, got %+v", task)
+	}
+	if len(task.Tags) != 2 || task.Tags[1] != "urgent" {
+		t.Errorf("Expected a tag to be appended, got %v", task.Tags)
+	}
+
+	resp = patchTask(t, s, "/tasks/1", "application/json-patch+json", `[
+		{"op": "replace", "path": "", "value": {"title": "Replaced", "completed": true}}
+	]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 replacing the whole task, got %d", resp.StatusCode)
+	}
+	if task := decodeTask(t, resp); task.Title != "Replaced" || !task.Completed || task.Description != "" || len(task.Tags) != 0 {
+		t.Errorf("Expected the task to be replaced as a whole, got %+v", task)
+	}
+}
+
+func TestPatchTaskErrors(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	created := decodeTask(t, sendRequest(t, s, http.MethodPost, "/tasks", nil, `{"title": "Write tests"}`))
+
+	resp := patchTask(t, s, "/tasks/1", "application/json", `{"completed": true}`)
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected status 415 for a plain JSON body, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Accept-Patch") == "" {
+		t.Error("Expected the Accept-Patch header on a 415 response")
+	}
+
+	unprocessable := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"merge patch that is not an object", "application/merge-patch+json", `["completed"]`},
+		{"merge patch leaving an invalid task", "application/merge-patch+json", `{"title": ""}`},
+		{"merge patch with a mistyped field", "application/merge-patch+json", `{"completed": "yes"}`},
+		{"failing test operation", "application/json-patch+json",
+			`[{"op": "replace", "path": "/completed", "value": true}, {"op": "test", "path": "/title", "value": "Other"}]`},
+		{"missing path", "application/json-patch+json", `[{"op": "remove", "path": "/tags/3"}]`},
+		{"unknown operation", "application/json-patch+json", `[{"op": "increment", "path": "/version"}]`},
+	}
+	for _, tc := range unprocessable {
+		if resp := patchTask(t, s, "/tasks/1", tc.contentType, tc.body); resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status 422, got %d", tc.name, resp.StatusCode)
+		}
+	}
+
+	if resp := patchTask(t, s, "/tasks/1", "application/json-patch+json", `{"op": "add"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a JSON patch that is not an array, got %d", resp.StatusCode)
+	}
+
+	task, _ := s.TaskStore.GetByID(created.ID)
+	if task.Completed || task.Version != created.Version {
+		t.Errorf("Expected rejected patches to leave the task unchanged, got %+v", task)
+	}
+}
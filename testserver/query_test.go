@@ -0,0 +1,158 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+// listTasks sends GET /tasks with the given query string and decodes the page
+func listTasks(t *testing.T, s *Server, query string) (*http.Response, []domain.Task) {
+	t.Helper()
+
+	resp := sendRequest(t, s, http.MethodGet, "/tasks?"+query, nil, "")
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var tasks []domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		t.Fatalf("failed to decode tasks: %v", err)
+	}
+	return resp, tasks
+}
+
+func taskTitles(tasks []domain.Task) []string {
+	titles := make([]string, len(tasks))
+	for i, task := range tasks {
+		titles[i] = task.Title
+	}
+	return titles
+}
+
+func TestListTasksFilterAndSort(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	for _, body := range []string{
+		`{"title": "Write report", "priority": "high", "due_date": "2025-03-01T15:00:00Z", "tags": ["work"]}`,
+		`{"title": "Buy milk", "priority": "low", "due_date": "2025-03-02", "tags": ["home"]}`,
+		`{"title": "Review report", "priority": "medium", "completed": true, "tags": ["work", "review"]}`,
+		`{"title": "Call mom", "priority": "high", "due_date": "2025-02-20"}`,
+	} {
+		if resp := sendRequest(t, s, http.MethodPost, "/tasks", nil, body); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"completed=false", []string{"Write report", "Buy milk", "Call mom"}},
+		{"tag=work", []string{"Write report", "Review report"}},
+		{"tag=work&tag=review", []string{"Review report"}},
+		{"title=REPORT", []string{"Write report", "Review report"}},
+		// A date-only upper bound covers the whole day
+		{"due_before=2025-03-01", []string{"Write report", "Call mom"}},
+		{"due_after=2025-03-01&due_before=2025-03-01T12:00:00Z", nil},
+		{"due_after=2025-02-21", []string{"Write report", "Buy milk"}},
+		{"sort=-priority", []string{"Write report", "Call mom", "Review report", "Buy milk"}},
+		{"sort=due_date", []string{"Call mom", "Write report", "Buy milk", "Review report"}},
+		{"sort=-completed,title", []string{"Review report", "Buy milk", "Call mom", "Write report"}},
+	}
+	for _, tc := range tests {
+		resp, tasks := listTasks(t, s, tc.query)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", tc.query, resp.StatusCode)
+			continue
+		}
+		if got := taskTitles(tasks); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: expected %v, got %v", tc.query, tc.want, got)
+		}
+		if got := resp.Header.Get("X-Total-Count"); got != strconv.Itoa(len(tc.want)) {
+			t.Errorf("%s: expected X-Total-Count %d, got %s", tc.query, len(tc.want), got)
+		}
+	}
+
+	for _, query := range []string{"completed=maybe", "due_before=soon", "sort=owner", "limit=0", "offset=-1"} {
+		if resp, _ := listTasks(t, s, query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestListTasksPagination(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		postJSON(t, s, "/tasks", "", map[string]string{"title": title})
+	}
+
+	resp, tasks := listTasks(t, s, "limit=2&offset=2")
+	if got := strings.Join(taskTitles(tasks), ","); got != "C,D" {
+		t.Fatalf("Expected the second page to be C,D, got %s", got)
+	}
+	if got := resp.Header.Get("X-Total-Count"); got != "5" {
+		t.Errorf("Expected X-Total-Count 5, got %q", got)
+	}
+	link := resp.Header.Get("Link")
+	for _, want := range []string{
+		`offset=0>; rel="first"`,
+		`offset=0>; rel="prev"`,
+		`offset=4>; rel="next"`,
+		`offset=4>; rel="last"`,
+	} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Expected the Link header to contain %s, got %s", want, link)
+		}
+	}
+
+	// Walk all pages in descending title order with the cursor
+	var titles []string
+	query := "sort=-title&limit=2"
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("Cursor pagination did not terminate")
+		}
+		resp, tasks := listTasks(t, s, query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 from %s, got %d", query, resp.StatusCode)
+		}
+		titles = append(titles, taskTitles(tasks)...)
+
+		cursor := resp.Header.Get("X-Next-Cursor")
+		if cursor == "" {
+			if strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+				t.Error("Expected no next link on the last page")
+			}
+			break
+		}
+		if page > 0 && !strings.Contains(resp.Header.Get("Link"), `rel="next"`) {
+			t.Error("Expected a next link while following the cursor")
+		}
+		query = "sort=-title&limit=2&cursor=" + cursor
+	}
+	if got := strings.Join(titles, ","); got != "E,D,C,B,A" {
+		t.Errorf("Expected cursor pagination to return every task once, got %s", got)
+	}
+
+	resp, _ = listTasks(t, s, "sort=-title&limit=2")
+	cursor := resp.Header.Get("X-Next-Cursor")
+	for _, query := range []string{
+		"cursor=not-a-cursor",
+		"sort=title&cursor=" + cursor,
+		"sort=-title&offset=2&cursor=" + cursor,
+	} {
+		if resp, _ := listTasks(t, s, query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
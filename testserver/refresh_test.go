@@ -0,0 +1,80 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+func decodeAuthResponse(t *testing.T, resp *http.Response) domain.AuthResponse {
+	t.Helper()
+
+	var authResp domain.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+	return authResp
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	config := NewConfig()
+	config.AccessTokenTTL = 30 * time.Second
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	registered := decodeAuthResponse(t, resp)
+	if registered.RefreshToken == "" {
+		t.Fatal("Expected a refresh token from register")
+	}
+	if registered.ExpiresIn != 30 {
+		t.Errorf("Expected expires_in to be 30, got %d", registered.ExpiresIn)
+	}
+
+	resp = postJSON(t, s, "/auth/refresh", "", domain.RefreshRequest{RefreshToken: registered.RefreshToken})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from refresh, got %d", resp.StatusCode)
+	}
+	refreshed := decodeAuthResponse(t, resp)
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == registered.RefreshToken {
+		t.Fatal("Expected a rotated refresh token")
+	}
+	if refreshed.User.Username != "alice" {
+		t.Errorf("Expected the refreshed token to belong to alice, got %q", refreshed.User.Username)
+	}
+
+	resp = postJSON(t, s, "/tasks", refreshed.Token, map[string]string{"title": "After refresh"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected the refreshed access token to be accepted, got %d", resp.StatusCode)
+	}
+
+	// Reusing a rotated token revokes the whole family, including its successor
+	resp = postJSON(t, s, "/auth/refresh", "", domain.RefreshRequest{RefreshToken: registered.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 when reusing a refresh token, got %d", resp.StatusCode)
+	}
+	resp = postJSON(t, s, "/auth/refresh", "", domain.RefreshRequest{RefreshToken: refreshed.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 after reuse was detected, got %d", resp.StatusCode)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	s := New(t, nil)
+
+	postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "bob", Password: "password1"})
+	resp := postJSON(t, s, "/auth/login", "", domain.LoginRequest{Username: "bob", Password: "password1"})
+	loggedIn := decodeAuthResponse(t, resp)
+
+	resp = postJSON(t, s, "/auth/logout", loggedIn.Token, domain.LogoutRequest{RefreshToken: loggedIn.RefreshToken})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from logout, got %d", resp.StatusCode)
+	}
+
+	resp = postJSON(t, s, "/auth/refresh", "", domain.RefreshRequest{RefreshToken: loggedIn.RefreshToken})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a revoked refresh token, got %d", resp.StatusCode)
+	}
+}
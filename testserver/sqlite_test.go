@@ -0,0 +1,99 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/export"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
+)
+
+func TestSQLiteStorePersistsData(t *testing.T) {
+	config := NewConfig()
+	config.SQLitePath = filepath.Join(t.TempDir(), "data.db")
+
+	s := New(t, config)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	var authResp domain.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+
+	resp = postJSON(t, s, "/tasks", authResp.Token, map[string]interface{}{"title": "Persisted", "tags": []string{"work"}})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+	}
+
+	// A failing atomic batch must not leave the created task behind
+	resp = postJSON(t, s, "/tasks/batch", authResp.Token, map[string]interface{}{
+		"operations": []map[string]interface{}{
+			{"method": "create", "body": map[string]string{"title": "Rolled back"}},
+			{"method": "delete", "id": 99},
+		},
+	})
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 from failing batch, got %d", resp.StatusCode)
+	}
+
+	alice, _ := s.UserStore.GetByUsername("alice")
+	alice.Profile = domain.Profile{Email: "alice@example.com", Address: &domain.Address{Country: "JP"}}
+	s.UserStore.Update(alice.ID, alice)
+
+	s.Close()
+
+	s = New(t, config)
+	alice, exists := s.UserStore.GetByUsername("alice")
+	if !exists {
+		t.Fatal("Expected the user to survive a restart")
+	}
+	if alice.Email != "alice@example.com" || alice.Address == nil || alice.Address.Country != "JP" {
+		t.Errorf("Expected the profile to survive a restart, got %+v", alice.Profile)
+	}
+
+	tasks := s.TaskStore.GetAll()
+	if len(tasks) != 1 || tasks[0].Title != "Persisted" || len(tasks[0].Tags) != 1 || tasks[0].Version != 1 {
+		t.Fatalf("Expected only the persisted task after a restart, got %+v", tasks)
+	}
+
+	if _, err := s.TaskStore.UpdateIfVersion(tasks[0].ID, 2, &domain.Task{Title: "Stale"}); err != store.ErrVersionMismatch {
+		t.Errorf("Expected ErrVersionMismatch for a stale version, got %v", err)
+	}
+	if err := s.TaskStore.DeleteIfVersion(42, store.AnyVersion); err != store.ErrTaskNotFound {
+		t.Errorf("Expected ErrTaskNotFound for a missing task, got %v", err)
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	resp = postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "bob", Password: "password2"})
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+	if authResp.User.ID != 1 {
+		t.Errorf("Expected user IDs to restart at 1 after reset, got %d", authResp.User.ID)
+	}
+}
+
+func TestExportStoreToSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.sqlite")
+	if err := export.Store(path); err != nil {
+		t.Fatalf("export.Store failed: %v", err)
+	}
+
+	config := NewConfig()
+	config.SQLitePath = path
+	s := New(t, config)
+
+	if len(s.UserStore.GetAll()) != 2 || len(s.TaskStore.GetAll()) != 2 {
+		t.Fatalf("Expected the sample users and tasks in the database")
+	}
+
+	resp := postJSON(t, s, "/auth/login", "", domain.LoginRequest{Username: "user1", Password: "password1"})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected sample user to log in, got status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,107 @@
+// Package testserver runs the mock TODO server in-process for Go tests.
+//
+// Each server listens on an ephemeral port through httptest and owns its own
+// stores and auth service, so several isolated servers can run side by side
+// without touching PID files, signal handlers or package-level state.
+package testserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server"
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/fault"
+	"github.com/KasumiMercury/mock-todo-server/server/store"
+)
+
+// Config is the server configuration used by testserver.
+// The Port field is ignored because the server always listens on an ephemeral port.
+type Config = server.Config
+
+// Server is a running in-process mock TODO server
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:54321
+	URL string
+
+	TaskStore   store.TaskStore
+	UserStore   store.UserStore
+	AuthService *auth.AuthService
+	// Faults changes the injected latency and failures while the server runs
+	Faults *fault.Injector
+
+	server     *server.Server
+	httpServer *httptest.Server
+}
+
+// NewConfig returns a Config with the same defaults as the serve command
+func NewConfig() *Config {
+	return server.NewServerConfig()
+}
+
+// Start builds a server from config and starts it on an ephemeral port.
+// A nil config uses the defaults from NewConfig. The caller must call Close.
+func Start(config *Config) (*Server, error) {
+	if config == nil {
+		config = NewConfig()
+	}
+
+	if config.AuthMode == auth.AuthModeOIDC && config.OIDCConfigPath == "" {
+		return nil, fmt.Errorf("OIDC config file path is required when using OIDC auth mode")
+	}
+
+	s, err := server.NewServerFromConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server: %w", err)
+	}
+
+	httpServer := httptest.NewServer(s.Handler())
+
+	return &Server{
+		URL:         httpServer.URL,
+		TaskStore:   s.TaskStore(),
+		UserStore:   s.UserStore(),
+		AuthService: s.AuthService(),
+		Faults:      s.FaultInjector(),
+		server:      s,
+		httpServer:  httpServer,
+	}, nil
+}
+
+// New starts a server for the duration of the test and stops it with t.Cleanup.
+// A nil config uses the defaults from NewConfig.
+func New(t testing.TB, config *Config) *Server {
+	t.Helper()
+
+	s, err := Start(config)
+	if err != nil {
+		t.Fatalf("testserver: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Client returns an HTTP client configured for the server
+func (s *Server) Client() *http.Client {
+	return s.httpServer.Client()
+}
+
+// Server returns the underlying mock server
+func (s *Server) Server() *server.Server {
+	return s.server
+}
+
+// Reset removes all tasks, users, registered clients, sessions and authorization
+// codes so the server can be reused by the next test case
+func (s *Server) Reset() error {
+	return s.server.ResetState()
+}
+
+// Close shuts down the server and blocks until all outstanding requests have completed
+func (s *Server) Close() {
+	s.httpServer.Close()
+	_ = s.server.Close()
+}
@@ -0,0 +1,108 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server/auth"
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+func postJSON(t *testing.T, s *Server, path, token string, body interface{}) *http.Response {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request to %s failed: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestNewWithDefaultConfig(t *testing.T) {
+	s := New(t, nil)
+
+	resp := postJSON(t, s, "/auth/register", "", domain.RegisterRequest{Username: "alice", Password: "password1"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from register, got %d", resp.StatusCode)
+	}
+
+	var authResp domain.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("failed to decode auth response: %v", err)
+	}
+
+	resp = postJSON(t, s, "/tasks", authResp.Token, map[string]string{"title": "Write tests"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+	}
+
+	tasks := s.TaskStore.GetAllByUserID(authResp.User.ID)
+	if len(tasks) != 1 || tasks[0].Title != "Write tests" {
+		t.Errorf("Expected the created task in the store, got %+v", tasks)
+	}
+}
+
+func TestServersAreIsolated(t *testing.T) {
+	first := New(t, nil)
+	second := New(t, nil)
+
+	if first.URL == second.URL {
+		t.Fatalf("Expected distinct URLs, both servers use %s", first.URL)
+	}
+
+	resp := postJSON(t, first, "/auth/register", "", domain.RegisterRequest{Username: "bob", Password: "password1"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from register, got %d", resp.StatusCode)
+	}
+
+	if _, exists := second.UserStore.GetByUsername("bob"); exists {
+		t.Error("User registered on the first server leaked into the second server")
+	}
+}
+
+func TestStartWithoutAuth(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+
+	s, err := Start(config)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Close()
+
+	resp := postJSON(t, s, "/tasks", "", map[string]string{"title": "Anonymous task"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+	}
+
+	if got := len(s.TaskStore.GetAll()); got != 1 {
+		t.Errorf("Expected 1 task in the store, got %d", got)
+	}
+}
+
+func TestStartRequiresOIDCConfigPath(t *testing.T) {
+	config := NewConfig()
+	config.AuthMode = auth.AuthModeOIDC
+
+	if _, err := Start(config); err == nil {
+		t.Error("Expected error when OIDC mode is used without a config path")
+	}
+}
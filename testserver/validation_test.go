@@ -0,0 +1,124 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KasumiMercury/mock-todo-server/server/domain"
+)
+
+// sendRequest sends body with the given method and headers and returns the response
+func sendRequest(t *testing.T, s *Server, method, path string, header http.Header, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func decodeTask(t *testing.T, resp *http.Response) domain.Task {
+	t.Helper()
+
+	var task domain.Task
+	if err := json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	return task
+}
+
+func TestCreateTaskValidation(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	invalid := []struct {
+		name string
+		body string
+	}{
+		{"missing title", `{"description": "No title"}`},
+		{"blank title", `{"title": "   "}`},
+		{"title too long", `{"title": "` + strings.Repeat("a", 201) + `"}`},
+		{"description too long", `{"title": "Task", "description": "` + strings.Repeat("a", 2001) + `"}`},
+		{"unknown priority", `{"title": "Task", "priority": "urgent"}`},
+		{"malformed due date", `{"title": "Task", "due_date": "tomorrow"}`},
+		{"empty tag", `{"title": "Task", "tags": ["work", " "]}`},
+		{"invalid JSON", `{"title": `},
+	}
+	for _, tc := range invalid {
+		resp := sendRequest(t, s, http.MethodPost, "/tasks", nil, tc.body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tc.name, resp.StatusCode)
+		}
+	}
+	if got := len(s.TaskStore.GetAll()); got != 0 {
+		t.Fatalf("Expected invalid tasks not to be stored, got %d tasks", got)
+	}
+
+	resp := sendRequest(t, s, http.MethodPost, "/tasks", nil,
+		`{"title": "  Write tests  ", "due_date": "2025-03-01", "tags": [" work ", "work", "home"]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201 from create task, got %d", resp.StatusCode)
+	}
+
+	task := decodeTask(t, resp)
+	if task.Title != "Write tests" {
+		t.Errorf("Expected the title to be trimmed, got %q", task.Title)
+	}
+	if task.Priority != domain.DefaultPriority {
+		t.Errorf("Expected the default priority, got %q", task.Priority)
+	}
+	if task.DueDate == nil || *task.DueDate != "2025-03-01T00:00:00Z" {
+		t.Errorf("Expected the due date to be normalized to RFC 3339, got %v", task.DueDate)
+	}
+	if len(task.Tags) != 2 || task.Tags[0] != "work" || task.Tags[1] != "home" {
+		t.Errorf("Expected trimmed and deduplicated tags, got %v", task.Tags)
+	}
+}
+
+func TestUpdateTaskValidation(t *testing.T) {
+	config := NewConfig()
+	config.AuthRequired = false
+	s := New(t, config)
+
+	created := decodeTask(t, postJSON(t, s, "/tasks", "", map[string]string{"title": "Original"}))
+
+	resp := sendRequest(t, s, http.MethodPut, "/tasks/1", nil, `{"title": "", "completed": true}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a blank title, got %d", resp.StatusCode)
+	}
+
+	resp = sendRequest(t, s, http.MethodPut, "/tasks/1", nil, `{"title": "Updated", "priority": "someday"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an unknown priority, got %d", resp.StatusCode)
+	}
+
+	task, exists := s.TaskStore.GetByID(created.ID)
+	if !exists || task.Title != "Original" || task.Completed || task.Version != created.Version {
+		t.Errorf("Expected rejected updates to leave the task unchanged, got %+v", task)
+	}
+
+	resp = sendRequest(t, s, http.MethodPut, "/tasks/1", nil, `{"title": "Updated", "priority": "high", "due_date": ""}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 from update task, got %d", resp.StatusCode)
+	}
+	if updated := decodeTask(t, resp); updated.Priority != domain.PriorityHigh || updated.DueDate != nil {
+		t.Errorf("Expected the update to be applied, got %+v", updated)
+	}
+}